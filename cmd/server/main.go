@@ -3,131 +3,113 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 
+	"lemara_blog/internal/app"
 	"lemara_blog/internal/config"
-
-	"lemara_blog/internal/handler"
-	"lemara_blog/internal/repository"
-	"lemara_blog/internal/service"
+	"lemara_blog/internal/logging"
+	"lemara_blog/internal/tracing"
 )
 
 func main() {
     // Load environment variables
-    if err := godotenv.Load(); err != nil {
-        log.Println("No .env file found, using system environment variables")
+    envErr := godotenv.Load()
+
+    // "server config print [flags]" prints the effective configuration
+    args := os.Args[1:]
+    printConfig := len(args) >= 2 && args[0] == "config" && args[1] == "print"
+    if printConfig {
+        args = args[2:]
     }
 
     // Load configuration
-    cfg := config.Load()
+    cfg, err := config.Load(args)
+    if err != nil {
+        if config.IsHelp(err) {
+            os.Exit(0)
+        }
+        fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+        os.Exit(1)
+    }
+    validationErr := cfg.Validate()
 
-    // Setup database connection
-    dbPool, err := setupDatabase(cfg)
+    if printConfig {
+        if err := cfg.Print(os.Stdout); err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to print configuration: %v\n", err)
+            os.Exit(1)
+        }
+        if validationErr != nil {
+            fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%v\n", validationErr)
+            os.Exit(1)
+        }
+        return
+    }
+
+    if validationErr != nil {
+        fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", validationErr)
+        os.Exit(1)
+    }
+
+    // Setup logging
+    logger, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
     if err != nil {
-        log.Fatalf("Unable to connect to database: %v\n", err)
+        fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+        os.Exit(1)
     }
-    defer dbPool.Close()
+    slog.SetDefault(logger)
 
-    // Initialize repositories
-    userRepo := repository.NewUserRepository(dbPool)
-    postRepo := repository.NewPostRepository(dbPool)
+    if envErr != nil {
+        logger.Info("no .env file found, using system environment variables")
+    }
 
-    // Initialize services
-    authService := service.NewAuthService(userRepo, &config.Config{
-        JWTSecret:     cfg.JWTSecret,
-        JWTExpiration: cfg.JWTExpiration,
-        BcryptCost:    cfg.BcryptCost,
+    // Setup tracing
+    shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+        ServiceName:  "lemara_blog",
+        Environment:  cfg.AppEnv,
+        Exporter:     cfg.TracingExporter,
+        OTLPEndpoint: cfg.TracingOTLPEndpoint,
+        OTLPInsecure: cfg.TracingOTLPInsecure,
+        SampleRatio:  cfg.TracingSampleRatio,
     })
-    postService := service.NewPostService(postRepo)
-
-    // Initialize handlers
-    authHandler := handler.NewAuthHandler(authService)
-    userHandler := handler.NewUserHandler(userRepo)
-    postHandler := handler.NewPostHandler(*postService)
-    healthHandler := handler.NewHealthHandler(dbPool)
-
-    // Setup router
-    mux := http.NewServeMux()
-
-    // Public routes
-    mux.HandleFunc("POST /auth/register", authHandler.Register)
-    mux.HandleFunc("POST /auth/login", authHandler.Login)
-    mux.HandleFunc("GET /health", healthHandler.Check)
-
-    // Protected routes (with auth middleware)
-    protected := http.NewServeMux()
-    protected.HandleFunc("GET /api/users/me", userHandler.GetProfile)
-    protected.HandleFunc("PUT /api/users/me", userHandler.UpdateProfile)
-    protected.HandleFunc("DELETE /api/users/me", userHandler.DeleteProfile)
-    // Посты
-    protected.HandleFunc("POST /api/posts", postHandler.CreatePost)
-    protected.HandleFunc("GET /api/posts/{id}", postHandler.GetPost)
-
-    // Вот тут важно подключить защищенные роуты к mux
-    mux.Handle("/api/", handler.AuthMiddleware(cfg.JWTSecret)(protected))
-
-    // Setup server
-    server := &http.Server{
-        Addr:         ":" + cfg.ServerPort,
-        Handler:      mux,
-        ReadTimeout:  15 * time.Second,
-        WriteTimeout: 15 * time.Second,
-        IdleTimeout:  60 * time.Second,
+    if err != nil {
+        fatal("unable to set up tracing", err)
+    }
+
+    // Build the application: database, services and routes
+    blog, err := app.New(cfg, app.WithLogger(logger))
+    if err != nil {
+        fatal("unable to start application", err)
+    }
+    if err := blog.Start(context.Background()); err != nil {
+        fatal("server failed", err)
     }
 
     // Graceful shutdown
     done := make(chan os.Signal, 1)
     signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-
-    go func() {
-        log.Printf("Server starting on port %s", cfg.ServerPort)
-        if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-            log.Fatalf("Server failed: %v", err)
-        }
-    }()
-
     <-done
-    log.Println("Server shutting down...")
+    logger.Info("server shutting down")
 
     ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
     defer cancel()
 
-    if err := server.Shutdown(ctx); err != nil {
-        log.Fatalf("Server shutdown failed: %v", err)
+    if err := blog.Shutdown(ctx); err != nil {
+        fatal("server shutdown failed", err)
     }
-
-    log.Println("Server stopped")
-}
-
-func setupDatabase(cfg *config.Config) (*pgxpool.Pool, error) {
-    connStr := fmt.Sprintf(
-        "postgres://%s:%s@%s:%s/%s?sslmode=%s",
-        cfg.DBUser,
-        cfg.DBPassword,
-        cfg.DBHost,
-        cfg.DBPort,
-        cfg.DBName,
-        cfg.DBSSLMode,
-    )
-
-    poolConfig, err := pgxpool.ParseConfig(connStr)
-    if err != nil {
-        return nil, err
+    if err := shutdownTracing(ctx); err != nil {
+        logger.Error("failed to flush traces", "error", err)
     }
 
-    // Connection pool settings
-    poolConfig.MaxConns = 25
-    poolConfig.MinConns = 5
-    poolConfig.MaxConnLifetime = time.Hour
-    poolConfig.MaxConnIdleTime = 30 * time.Minute
+    logger.Info("server stopped")
+}
 
-    return pgxpool.NewWithConfig(context.Background(), poolConfig)
+func fatal(msg string, err error) {
+    slog.Error(msg, "error", err)
+    os.Exit(1)
 }
@@ -0,0 +1,402 @@
+// Package app wires configuration, storage, services and HTTP routes into a
+// runnable blog application. cmd/server is a thin wrapper around it; other
+// services can embed the blog by mounting an App as an http.Handler.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"lemara_blog/internal/cache"
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/config"
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/health"
+	"lemara_blog/internal/mail"
+	"lemara_blog/internal/metrics"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/service"
+	"lemara_blog/internal/storage"
+)
+
+// App is the blog application. It serves HTTP requests directly (ServeHTTP)
+// or runs its own server with Start and Shutdown.
+type App struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	clock  clock.Clock
+	mailer mail.Mailer
+	prefix string
+
+	db         *database.Cluster
+	ownsDB     bool
+	users      repository.UserRepository
+	posts      repository.PostRepository
+	tokens     repository.TokenRepository
+	identities repository.IdentityRepository
+	media      repository.MediaRepository
+	reactions  repository.ReactionRepository
+	bookmarks  repository.BookmarkRepository
+	lists      repository.ReadingListRepository
+	tx         service.Transactor
+	cache      cache.Cache
+	closeCache func() error
+	files      storage.Storage
+	processor  *service.MediaProcessor
+	// Снимают метрики пулов db; метрики глобальные, а App может быть не один
+	unregisterPools []func()
+
+	health   *health.Registry
+	handler  http.Handler
+	server   *http.Server
+	listener net.Listener
+	// /metrics на METRICS_PORT, отдельно от API
+	metricsServer   *http.Server
+	metricsListener net.Listener
+}
+
+// New builds the application. Repositories that are not injected with
+// options are backed by PostgreSQL: the App then connects using cfg, applies
+// migrations and closes the connections on Shutdown.
+func New(cfg *config.Config, opts ...Option) (*App, error) {
+	a := &App{
+		cfg:    cfg,
+		logger: slog.Default(),
+		clock:  clock.System,
+		health: health.NewRegistry(2 * time.Second),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.mailer == nil {
+		a.mailer = mail.LogMailer{Logger: a.logger}
+	}
+
+	if err := a.setupStorage(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := a.setupCache(context.Background()); err != nil {
+		a.closeDB()
+		return nil, err
+	}
+	if err := a.setupFiles(); err != nil {
+		a.closeStorage()
+		return nil, err
+	}
+
+	h, err := a.routes()
+	if err != nil {
+		a.closeStorage()
+		return nil, err
+	}
+	if a.prefix != "" {
+		h = http.StripPrefix(a.prefix, h)
+	}
+	a.handler = h
+
+	// Обработка изображений не зависит от HTTP-сервера: встраивающее
+	// приложение может не вызывать Start
+	a.processor.Start(context.Background())
+	a.health.Register(a.processor.Heartbeat())
+
+	return a, nil
+}
+
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.ServeHTTP(w, r)
+}
+
+// Health exposes the readiness checks so an embedding service can add its own
+func (a *App) Health() *health.Registry {
+	return a.health
+}
+
+func (a *App) Mailer() mail.Mailer {
+	return a.mailer
+}
+
+// MetricsHandler serves the Prometheus metrics. Start exposes it on
+// METRICS_PORT; an embedding service can mount it on its own internal port.
+func (a *App) MetricsHandler() http.Handler {
+	return metrics.Handler()
+}
+
+// Start listens on SERVER_PORT and serves requests in the background, and
+// serves the metrics on METRICS_PORT if it is set. It returns once the
+// listeners are open, so port conflicts are reported here.
+func (a *App) Start(ctx context.Context) error {
+	if a.server != nil {
+		return errors.New("app: already started")
+	}
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", ":"+a.cfg.ServerPort)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if a.cfg.MetricsPort != "" {
+		metricsListener, err := lc.Listen(ctx, "tcp", ":"+a.cfg.MetricsPort)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("listen metrics: %w", err)
+		}
+		a.startMetrics(metricsListener)
+	}
+
+	a.listener = listener
+	a.server = &http.Server{
+		Handler:      a,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	go func() {
+		a.logger.Info("server starting", "addr", listener.Addr().String(), "env", a.cfg.AppEnv)
+		if err := a.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Error("server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (a *App) startMetrics(listener net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", a.MetricsHandler())
+
+	a.metricsListener = listener
+	a.metricsServer = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+
+	go func() {
+		a.logger.Info("metrics server starting", "addr", listener.Addr().String())
+		if err := a.metricsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Error("metrics server failed", "error", err)
+		}
+	}()
+}
+
+// Addr is the address the server listens on, nil before Start
+func (a *App) Addr() net.Addr {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// MetricsAddr is the address of the metrics listener, nil before Start or
+// without METRICS_PORT
+func (a *App) MetricsAddr() net.Addr {
+	if a.metricsListener == nil {
+		return nil
+	}
+	return a.metricsListener.Addr()
+}
+
+// Shutdown fails readiness checks, waits for in-flight requests and image
+// processing, and closes the database connections the App opened itself
+func (a *App) Shutdown(ctx context.Context) error {
+	a.health.SetShuttingDown()
+
+	var err error
+	if a.server != nil {
+		err = a.server.Shutdown(ctx)
+	}
+	if a.metricsServer != nil {
+		err = errors.Join(err, a.metricsServer.Shutdown(ctx))
+	}
+	if a.processor != nil {
+		err = errors.Join(err, a.processor.Stop(ctx))
+	}
+	a.closeStorage()
+	return err
+}
+
+func (a *App) setupStorage(ctx context.Context) error {
+	if a.users != nil && a.posts != nil && a.tokens != nil && a.identities != nil && a.media != nil && a.reactions != nil &&
+		a.bookmarks != nil && a.lists != nil && a.tx != nil {
+		return nil
+	}
+
+	if a.db == nil {
+		db, err := connect(ctx, a.cfg)
+		if err != nil {
+			return fmt.Errorf("connect to database: %w", err)
+		}
+		a.db, a.ownsDB = db, true
+
+		if err := a.registerPoolMetrics(); err != nil {
+			a.closeDB()
+			return err
+		}
+		if err := database.Migrate(ctx, db.Primary()); err != nil {
+			a.closeDB()
+			return fmt.Errorf("apply migrations: %w", err)
+		}
+	}
+
+	a.health.Register(database.PingChecker("database", a.db.Primary()))
+	if a.db.Replica() != nil {
+		a.health.Register(database.PingChecker("database_replica", a.db.Replica()))
+	}
+	a.health.Register(database.MigrationsChecker(a.db.Primary()))
+
+	if a.users == nil {
+		a.users = repository.NewUserRepository(a.db)
+	}
+	if a.posts == nil {
+		a.posts = repository.NewPostRepository(a.db)
+	}
+	if a.tokens == nil {
+		a.tokens = repository.NewTokenRepository(a.db)
+	}
+	if a.identities == nil {
+		a.identities = repository.NewIdentityRepository(a.db)
+	}
+	if a.media == nil {
+		a.media = repository.NewMediaRepository(a.db)
+	}
+	if a.reactions == nil {
+		a.reactions = repository.NewReactionRepository(a.db)
+	}
+	if a.bookmarks == nil {
+		a.bookmarks = repository.NewBookmarkRepository(a.db)
+	}
+	if a.lists == nil {
+		a.lists = repository.NewReadingListRepository(a.db)
+	}
+	if a.tx == nil {
+		a.tx = database.NewTxManager(a.db)
+	}
+	return nil
+}
+
+// setupCache wraps the post and user repositories with the read cache
+// selected by CACHE_DRIVER (or injected with WithCache)
+func (a *App) setupCache(ctx context.Context) error {
+	if a.cache == nil {
+		switch a.cfg.CacheDriver {
+		case "memory":
+			a.cache = cache.NewLRU(a.cfg.CacheSize, a.clock)
+		case "redis":
+			redis, err := cache.NewRedis(ctx, a.cfg.RedisURL, "lemara_blog:")
+			if err != nil {
+				return fmt.Errorf("connect to redis: %w", err)
+			}
+			a.cache, a.closeCache = redis, redis.Close
+			a.health.Register(health.NewChecker("redis", redis.Ping))
+		default:
+			return nil
+		}
+	}
+
+	a.posts = repository.NewCachedPostRepository(a.posts, a.cache, a.cfg.CacheTTL)
+	a.users = repository.NewCachedUserRepository(a.users, a.cache)
+	return nil
+}
+
+// setupFiles opens the storage for uploaded files selected by MEDIA_STORAGE
+// (or injected with WithFileStorage)
+func (a *App) setupFiles() error {
+	if a.files != nil {
+		return nil
+	}
+
+	switch a.cfg.MediaStorage {
+	case "s3":
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:        a.cfg.S3Endpoint,
+			Region:          a.cfg.S3Region,
+			Bucket:          a.cfg.S3Bucket,
+			AccessKeyID:     a.cfg.S3AccessKeyID,
+			SecretAccessKey: a.cfg.S3SecretAccessKey,
+			PathStyle:       a.cfg.S3PathStyle,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		a.files = s3
+		a.health.Register(health.NewChecker("media_storage", s3.Ping))
+	default:
+		local, err := storage.NewLocal(a.cfg.MediaDir)
+		if err != nil {
+			return fmt.Errorf("media directory: %w", err)
+		}
+		a.files = local
+	}
+	return nil
+}
+
+func (a *App) closeStorage() {
+	if a.closeCache != nil {
+		if err := a.closeCache(); err != nil {
+			a.logger.Error("failed to close cache", "error", err)
+		}
+		a.closeCache = nil
+	}
+	a.closeDB()
+}
+
+func (a *App) closeDB() {
+	for _, unregister := range a.unregisterPools {
+		unregister()
+	}
+	a.unregisterPools = nil
+	if a.ownsDB && a.db != nil {
+		a.db.Close()
+		a.db = nil
+	}
+}
+
+// Подключение к primary и, если указан DATABASE_REPLICA_URL, к реплике
+func connect(ctx context.Context, cfg *config.Config) (*database.Cluster, error) {
+	poolConfig := database.PoolConfig{
+		MaxConns:          int32(cfg.DBMaxConns),
+		MinConns:          int32(cfg.DBMinConns),
+		MaxConnLifetime:   cfg.DBMaxConnLifetime,
+		MaxConnIdleTime:   cfg.DBMaxConnIdleTime,
+		HealthCheckPeriod: cfg.DBHealthCheckPeriod,
+		StatementTimeout:  cfg.DBStatementTimeout,
+	}
+
+	primary, err := database.NewPool(ctx, cfg.DatabaseDSN(), poolConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DatabaseReplicaURL == "" {
+		return database.NewCluster(primary, nil), nil
+	}
+
+	replica, err := database.NewPool(ctx, cfg.DatabaseReplicaURL, poolConfig, true)
+	if err != nil {
+		primary.Close()
+		return nil, fmt.Errorf("replica: %w", err)
+	}
+	return database.NewCluster(primary, replica), nil
+}
+
+// registerPoolMetrics exposes the pools of a.db until closeDB removes them
+// again, so a later App can register its own pools
+func (a *App) registerPoolMetrics() error {
+	unregister, err := metrics.RegisterPool("primary", a.db.Primary())
+	if err != nil {
+		return fmt.Errorf("register pool metrics: %w", err)
+	}
+	a.unregisterPools = append(a.unregisterPools, unregister)
+	if a.db.Replica() != nil {
+		unregister, err := metrics.RegisterPool("replica", a.db.Replica())
+		if err != nil {
+			return fmt.Errorf("register pool metrics: %w", err)
+		}
+		a.unregisterPools = append(a.unregisterPools, unregister)
+	}
+	return nil
+}
@@ -0,0 +1,1185 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/app"
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/config"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/handler"
+	"lemara_blog/internal/logging"
+	"lemara_blog/internal/oidc/oidctest"
+	"lemara_blog/internal/repository/memory"
+)
+
+// testApp is the whole application backed by in-memory repositories
+type testApp struct {
+	t      *testing.T
+	server *httptest.Server
+	store  *memory.Store
+}
+
+func newTestApp(t *testing.T, configure ...func(cfg *config.Config, serverURL string)) *testApp {
+	t.Helper()
+	return newTestAppWith(t, nil, configure...)
+}
+
+// newTestAppWith passes extra options (a manual clock) to the application
+func newTestAppWith(t *testing.T, opts []app.Option, configure ...func(cfg *config.Config, serverURL string)) *testApp {
+	t.Helper()
+
+	// The application is built after the server starts so configuration
+	// can refer to the server URL (OIDC redirect URLs)
+	var h http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := testConfig(t)
+	for _, fn := range configure {
+		fn(cfg, server.URL)
+	}
+
+	store := memory.NewStore()
+	blog, err := app.New(cfg, append(memoryOptions(t, store), opts...)...)
+	if err != nil {
+		t.Fatalf("new app: %v", err)
+	}
+	t.Cleanup(func() { blog.Shutdown(context.Background()) })
+	h = blog
+
+	return &testApp{t: t, server: server, store: store}
+}
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	cfg, err := config.Load([]string{
+		"-app-env", "test",
+		"-jwt-secret", "test-secret-that-is-long-enough-for-tests",
+		// Cheap hashing keeps the suite fast
+		"-password-hasher", "bcrypt",
+		"-bcrypt-cost", "4",
+		"-media-dir", t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.OIDCProviders = nil
+	return cfg
+}
+
+func memoryOptions(t *testing.T, store *memory.Store) []app.Option {
+	logger, err := logging.New(io.Discard, "text", "error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []app.Option{
+		app.WithLogger(logger),
+		app.WithUserRepository(memory.NewUserRepository(store)),
+		app.WithPostRepository(memory.NewPostRepository(store)),
+		app.WithTokenRepository(memory.NewTokenRepository(store)),
+		app.WithIdentityRepository(memory.NewIdentityRepository(store)),
+		app.WithMediaRepository(memory.NewMediaRepository(store)),
+		app.WithReactionRepository(memory.NewReactionRepository(store)),
+		app.WithBookmarkRepository(memory.NewBookmarkRepository(store)),
+		app.WithReadingListRepository(memory.NewReadingListRepository(store)),
+		app.WithTransactor(memory.NewTransactor(store)),
+	}
+}
+
+// do sends a JSON request and decodes the JSON response into out (if non-nil)
+func (a *testApp) do(method, path, token string, body, out any) int {
+	a.t.Helper()
+
+	resp, data := a.send(method, path, token, body, nil)
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			a.t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// send is do with extra request headers, returning the raw response
+func (a *testApp) send(method, path, token string, body any, headers map[string]string) (*http.Response, []byte) {
+	a.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, a.server.URL+path, reader)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := a.server.Client().Do(req)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp, data
+}
+
+func (a *testApp) register(email, password string) domain.AuthResponse {
+	a.t.Helper()
+
+	var auth domain.AuthResponse
+	status := a.do("POST", "/auth/register", "", domain.CreateUserRequest{Email: email, Password: password}, &auth)
+	if status != http.StatusCreated {
+		a.t.Fatalf("register %s: status %d", email, status)
+	}
+	return auth
+}
+
+func expectStatus(t *testing.T, what string, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("%s: status %d, want %d", what, got, want)
+	}
+}
+
+func expectProblem(t *testing.T, what string, problem handler.Problem, status int, code string) {
+	t.Helper()
+	if problem.Status != status || problem.Code != code {
+		t.Fatalf("%s: got %d %q, want %d %q", what, problem.Status, problem.Code, status, code)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	app := newTestApp(t)
+
+	auth := app.register("alice@example.com", "correct-horse")
+	if auth.Token == "" || auth.User.Email != "alice@example.com" {
+		t.Fatalf("unexpected register response: %+v", auth)
+	}
+
+	var problem handler.Problem
+	app.do("POST", "/auth/register", "", domain.CreateUserRequest{Email: "alice@example.com", Password: "another-password"}, &problem)
+	expectProblem(t, "duplicate register", problem, http.StatusConflict, "email_taken")
+
+	var login domain.AuthResponse
+	status := app.do("POST", "/auth/login", "", domain.LoginRequest{Email: "alice@example.com", Password: "correct-horse"}, &login)
+	expectStatus(t, "login", status, http.StatusOK)
+	if login.User.ID != auth.User.ID {
+		t.Fatalf("login returned user %q, want %q", login.User.ID, auth.User.ID)
+	}
+
+	problem = handler.Problem{}
+	app.do("POST", "/auth/login", "", domain.LoginRequest{Email: "alice@example.com", Password: "wrong-password"}, &problem)
+	expectProblem(t, "wrong password", problem, http.StatusUnauthorized, "invalid_credentials")
+
+	problem = handler.Problem{}
+	app.do("POST", "/auth/register", "", map[string]string{"email": "not-an-email", "password": "short"}, &problem)
+	expectProblem(t, "invalid register", problem, http.StatusUnprocessableEntity, "validation_failed")
+	if len(problem.Errors) != 2 {
+		t.Fatalf("expected errors for email and password, got %+v", problem.Errors)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	app.register("bob@example.com", "correct-horse")
+
+	var problem handler.Problem
+	app.do("GET", "/api/users/me", "", nil, &problem)
+	expectProblem(t, "anonymous profile", problem, http.StatusUnauthorized, "missing_authorization")
+
+	firstName := "Alice"
+	status := app.do("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{FirstName: &firstName}, nil)
+	expectStatus(t, "update profile", status, http.StatusOK)
+
+	var profile domain.UserResponse
+	status = app.do("GET", "/api/users/me", alice.Token, nil, &profile)
+	expectStatus(t, "get profile", status, http.StatusOK)
+	if profile.FirstName != "Alice" || profile.Email != "alice@example.com" {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+
+	taken := "bob@example.com"
+	problem = handler.Problem{}
+	app.do("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{Email: &taken}, &problem)
+	expectProblem(t, "take another email", problem, http.StatusConflict, "email_taken")
+
+	status = app.do("DELETE", "/api/users/me", alice.Token, domain.DeleteUserRequest{Password: "correct-horse"}, nil)
+	expectStatus(t, "delete profile", status, http.StatusOK)
+
+	problem = handler.Problem{}
+	app.do("GET", "/api/users/me", alice.Token, nil, &problem)
+	expectProblem(t, "deleted profile", problem, http.StatusNotFound, "user_not_found")
+
+	problem = handler.Problem{}
+	app.do("POST", "/auth/login", "", domain.LoginRequest{Email: "alice@example.com", Password: "correct-horse"}, &problem)
+	expectProblem(t, "deleted login", problem, http.StatusUnauthorized, "invalid_credentials")
+
+	// Soft-deleted users release their email
+	app.register("alice@example.com", "new-password")
+}
+
+func TestPosts(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+
+	var created domain.Post
+	status := app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{
+		Title:   "Hello",
+		Content: "First post",
+		Tags:    []string{"go", "testing", "go"},
+	}, &created)
+	expectStatus(t, "create post", status, http.StatusOK)
+	if created.Author != alice.User.ID || len(created.Tags) != 2 {
+		t.Fatalf("unexpected post: %+v", created)
+	}
+
+	var post domain.PostSearchResponse
+	status = app.do("GET", "/api/posts/"+created.ID.String(), alice.Token, nil, &post)
+	expectStatus(t, "get post", status, http.StatusOK)
+	if post.Title != "Hello" || post.Author.ID != alice.User.ID {
+		t.Fatalf("unexpected post: %+v", post)
+	}
+	if len(post.Tags) != 2 || post.Tags[0].Name != "go" || post.Tags[1].Name != "testing" {
+		t.Fatalf("unexpected tags: %+v", post.Tags)
+	}
+
+	var problem handler.Problem
+	app.do("GET", "/api/posts/00000000-0000-0000-0000-000000000000", alice.Token, nil, &problem)
+	expectProblem(t, "missing post", problem, http.StatusNotFound, "post_not_found")
+
+	problem = handler.Problem{}
+	app.do("GET", "/api/posts/not-a-uuid", alice.Token, nil, &problem)
+	expectProblem(t, "invalid id", problem, http.StatusUnprocessableEntity, "validation_failed")
+
+	problem = handler.Problem{}
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "No content", Tags: []string{"Not A Slug"}}, &problem)
+	expectProblem(t, "invalid post", problem, http.StatusUnprocessableEntity, "validation_failed")
+}
+
+func TestDrafts(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	var draft domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Draft", Content: "Text", Status: domain.PostStatusDraft}, &draft)
+	if draft.Status != domain.PostStatusDraft {
+		t.Fatalf("status %q, want draft", draft.Status)
+	}
+	path := "/api/posts/" + draft.ID.String()
+
+	expectStatus(t, "author reads draft", app.do("GET", path, alice.Token, nil, nil), http.StatusOK)
+	expectStatus(t, "other user reads draft", app.do("GET", path, bob.Token, nil, nil), http.StatusNotFound)
+	title := "Hijacked"
+	expectStatus(t, "other user edits draft", app.do("PUT", path, bob.Token, domain.PostUpdateRequest{Title: &title}, nil), http.StatusNotFound)
+
+	var list domain.PostListResponse
+	app.do("GET", "/api/posts", bob.Token, nil, &list)
+	if len(list.Posts) != 0 {
+		t.Fatalf("bob sees %d posts, want 0", len(list.Posts))
+	}
+	app.do("GET", "/api/posts?status=draft", alice.Token, nil, &list)
+	if len(list.Posts) != 1 {
+		t.Fatalf("alice sees %d drafts, want 1", len(list.Posts))
+	}
+
+	published := domain.PostStatusPublished
+	var post domain.PostSearchResponse
+	app.do("PUT", path, alice.Token, domain.PostUpdateRequest{Status: &published}, &post)
+	if post.Status != domain.PostStatusPublished {
+		t.Fatalf("status after publishing %q", post.Status)
+	}
+	expectStatus(t, "other user reads published post", app.do("GET", path, bob.Token, nil, nil), http.StatusOK)
+}
+
+func TestPostSummaries(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	str := func(s string) *string { return &s }
+
+	content := "# Title\n\n" +
+		"Some **bold** and _quiet_ words with a [link](https://example.com) and `code`.\n\n" +
+		"```go\nfmt.Println(\"not counted\")\n```\n\n" +
+		strings.Repeat("word ", 400)
+	var created domain.Post
+	status := app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{
+		Title:   "Markdown",
+		Content: content,
+	}, &created)
+	expectStatus(t, "create post", status, http.StatusOK)
+
+	// 1 heading word, 10 in the paragraph, 400 more; the code block is skipped
+	want := "Some bold and quiet words with a link and code."
+	if created.Excerpt != want || created.WordCount != 411 || created.ReadingTime != 3 {
+		t.Fatalf("summary: %q, %d words, %d min", created.Excerpt, created.WordCount, created.ReadingTime)
+	}
+
+	var list domain.PostListResponse
+	app.do("GET", "/api/posts", alice.Token, nil, &list)
+	if len(list.Posts) != 1 || list.Posts[0].Excerpt != want || list.Posts[0].ReadingTime != 3 {
+		t.Fatalf("list: %+v", list.Posts)
+	}
+
+	// An explicit excerpt wins until it is cleared; content changes are
+	// summarized again
+	path := "/api/posts/" + created.ID.String()
+	long := strings.Repeat("long ", 100)
+	var post domain.PostSearchResponse
+	app.do("PUT", path, alice.Token, domain.PostUpdateRequest{Excerpt: str("Hand-written"), Content: &long}, &post)
+	if post.Excerpt != "Hand-written" || post.CustomExcerpt != "Hand-written" || post.WordCount != 100 || post.ReadingTime != 1 {
+		t.Fatalf("after update: %+v", post)
+	}
+	post = domain.PostSearchResponse{}
+	app.do("PUT", path, alice.Token, domain.PostUpdateRequest{Excerpt: str("")}, &post)
+	if post.CustomExcerpt != "" || !strings.HasSuffix(post.Excerpt, "long…") || len([]rune(post.Excerpt)) > 281 {
+		t.Fatalf("auto excerpt %q", post.Excerpt)
+	}
+	app.do("GET", "/public/posts/"+created.ID.String(), "", nil, &post)
+	if post.Excerpt == "" {
+		t.Fatalf("public post: %+v", post)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	var post, draft domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &post)
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Draft", Content: "Text", Status: domain.PostStatusDraft}, &draft)
+	path := "/api/posts/" + post.ID.String()
+
+	// Repeated requests change nothing
+	var reactions domain.ReactionsResponse
+	for range 2 {
+		status := app.do("PUT", path+"/reactions/like", bob.Token, nil, &reactions)
+		expectStatus(t, "react", status, http.StatusOK)
+	}
+	app.do("PUT", path+"/reactions/rocket", bob.Token, nil, nil)
+	app.do("PUT", path+"/reactions/like", alice.Token, nil, &reactions)
+	want := []domain.ReactionSummary{{Kind: "like", Count: 2, Reacted: true}, {Kind: "rocket", Count: 1}}
+	if !reflect.DeepEqual(reactions.Reactions, want) {
+		t.Fatalf("alice's reactions %+v", reactions.Reactions)
+	}
+
+	var got domain.PostSearchResponse
+	app.do("GET", path, bob.Token, nil, &got)
+	want = []domain.ReactionSummary{{Kind: "like", Count: 2, Reacted: true}, {Kind: "rocket", Count: 1, Reacted: true}}
+	if !reflect.DeepEqual(got.Reactions, want) {
+		t.Fatalf("bob's post %+v", got.Reactions)
+	}
+	var list domain.PostListResponse
+	app.do("GET", "/api/posts", alice.Token, nil, &list)
+	if len(list.Posts) != 2 || len(list.Posts[1].Reactions) != 2 || !list.Posts[1].Reactions[0].Reacted || list.Posts[1].Reactions[1].Reacted {
+		t.Fatalf("alice's list %+v", list.Posts)
+	}
+	app.do("GET", "/public/posts/"+post.ID.String(), "", nil, &got)
+	if len(got.Reactions) != 2 || got.Reactions[0].Reacted {
+		t.Fatalf("anonymous reader %+v", got.Reactions)
+	}
+	// Signed-in readers of the public API see their own reactions too
+	app.do("GET", "/public/posts/"+post.ID.String(), bob.Token, nil, &got)
+	if len(got.Reactions) != 2 || !got.Reactions[0].Reacted || !got.Reactions[1].Reacted {
+		t.Fatalf("signed-in public post %+v", got.Reactions)
+	}
+	app.do("GET", "/public/posts", bob.Token, nil, &list)
+	if len(list.Posts) != 1 || len(list.Posts[0].Reactions) != 2 || !list.Posts[0].Reactions[1].Reacted {
+		t.Fatalf("signed-in public list %+v", list.Posts)
+	}
+	var profile domain.AuthorProfileResponse
+	app.do("GET", "/public/authors/"+alice.User.ID, alice.Token, nil, &profile)
+	if len(profile.Posts.Posts) != 1 || !profile.Posts.Posts[0].Reactions[0].Reacted || profile.Posts.Posts[0].Reactions[1].Reacted {
+		t.Fatalf("signed-in author profile %+v", profile.Posts.Posts)
+	}
+	expectStatus(t, "own draft in public", app.do("GET", "/public/posts/"+draft.ID.String(), alice.Token, nil, nil), http.StatusNotFound)
+
+	for range 2 {
+		status := app.do("DELETE", path+"/reactions/rocket", bob.Token, nil, &reactions)
+		expectStatus(t, "remove reaction", status, http.StatusOK)
+	}
+	want = []domain.ReactionSummary{{Kind: "like", Count: 2, Reacted: true}}
+	if !reflect.DeepEqual(reactions.Reactions, want) {
+		t.Fatalf("after removing %+v", reactions.Reactions)
+	}
+
+	var problem handler.Problem
+	app.do("PUT", path+"/reactions/facepalm", bob.Token, nil, &problem)
+	expectProblem(t, "unknown kind", problem, http.StatusUnprocessableEntity, "validation_failed")
+	problem = handler.Problem{}
+	app.do("PUT", "/api/posts/"+draft.ID.String()+"/reactions/like", bob.Token, nil, &problem)
+	expectProblem(t, "someone else's draft", problem, http.StatusNotFound, "post_not_found")
+	expectStatus(t, "own draft", app.do("PUT", "/api/posts/"+draft.ID.String()+"/reactions/like", alice.Token, nil, nil), http.StatusOK)
+}
+
+func TestBookmarks(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	posts := make([]domain.Post, 3)
+	for i := range posts {
+		app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: fmt.Sprintf("Post %d", i), Content: "Text"}, &posts[i])
+	}
+	var draft domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Draft", Content: "Text", Status: domain.PostStatusDraft}, &draft)
+
+	// Repeated requests change nothing
+	for _, post := range []domain.Post{posts[0], posts[0], posts[1], posts[2]} {
+		expectStatus(t, "bookmark", app.do("PUT", "/api/users/me/bookmarks/"+post.ID.String(), bob.Token, nil, nil), http.StatusNoContent)
+	}
+	var problem handler.Problem
+	app.do("PUT", "/api/users/me/bookmarks/"+draft.ID.String(), bob.Token, nil, &problem)
+	expectProblem(t, "someone else's draft", problem, http.StatusNotFound, "post_not_found")
+
+	var page domain.BookmarkListResponse
+	app.do("GET", "/api/users/me/bookmarks?limit=2", bob.Token, nil, &page)
+	if len(page.Bookmarks) != 2 || page.Bookmarks[0].Post.ID != posts[2].ID || page.Bookmarks[1].Post.ID != posts[1].ID {
+		t.Fatalf("first page %+v", page.Bookmarks)
+	}
+	app.do("GET", "/api/users/me/bookmarks?limit=2&offset=2", bob.Token, nil, &page)
+	if len(page.Bookmarks) != 1 || page.Bookmarks[0].Post.ID != posts[0].ID || page.Bookmarks[0].BookmarkedAt.IsZero() {
+		t.Fatalf("second page %+v", page.Bookmarks)
+	}
+	for range 2 {
+		expectStatus(t, "unbookmark", app.do("DELETE", "/api/users/me/bookmarks/"+posts[1].ID.String(), bob.Token, nil, nil), http.StatusNoContent)
+	}
+
+	// Posts keep the order they are put in
+	var list domain.ReadingListResponse
+	expectStatus(t, "create list", app.do("POST", "/api/users/me/lists", bob.Token, domain.ReadingListRequest{Name: "Later"}, &list), http.StatusCreated)
+	if list.Shared || list.ShareURL != "" {
+		t.Fatalf("new list %+v", list)
+	}
+	listPath := "/api/users/me/lists/" + list.ID.String()
+	position := func(n int) *domain.ReadingListItemRequest { return &domain.ReadingListItemRequest{Position: &n} }
+	app.do("PUT", listPath+"/posts/"+posts[0].ID.String(), bob.Token, nil, nil)
+	app.do("PUT", listPath+"/posts/"+posts[1].ID.String(), bob.Token, nil, nil)
+	app.do("PUT", listPath+"/posts/"+posts[2].ID.String(), bob.Token, position(0), nil)
+	app.do("PUT", listPath+"/posts/"+posts[1].ID.String(), bob.Token, position(0), nil)
+	expectStatus(t, "add again", app.do("PUT", listPath+"/posts/"+posts[0].ID.String(), bob.Token, nil, &list), http.StatusOK)
+	order := func(list domain.ReadingListResponse) []uuid.UUID {
+		ids := []uuid.UUID{}
+		for _, item := range list.Posts {
+			ids = append(ids, item.Post.ID)
+		}
+		return ids
+	}
+	if want := []uuid.UUID{posts[1].ID, posts[2].ID, posts[0].ID}; !reflect.DeepEqual(order(list), want) || list.PostCount != 3 {
+		t.Fatalf("list order %v, want %v", order(list), want)
+	}
+	problem = handler.Problem{}
+	app.do("GET", listPath, alice.Token, nil, &problem)
+	expectProblem(t, "someone else's list", problem, http.StatusNotFound, "reading_list_not_found")
+
+	// Shared lists are readable by link
+	shared := true
+	app.do("PUT", listPath, bob.Token, domain.ReadingListUpdateRequest{Shared: &shared}, &list)
+	sharePath := strings.TrimPrefix(list.ShareURL, app.server.URL)
+	if !list.Shared || !strings.HasPrefix(sharePath, "/public/lists/") {
+		t.Fatalf("shared list %+v", list)
+	}
+	var public domain.ReadingListResponse
+	expectStatus(t, "shared list", app.do("GET", sharePath, "", nil, &public), http.StatusOK)
+	if public.Name != "Later" || len(public.Posts) != 3 {
+		t.Fatalf("public list %+v", public)
+	}
+	var lists domain.ReadingListsResponse
+	app.do("GET", "/api/users/me/lists", bob.Token, nil, &lists)
+	if len(lists.Lists) != 1 || lists.Lists[0].PostCount != 3 || lists.Lists[0].Posts != nil {
+		t.Fatalf("lists %+v", lists.Lists)
+	}
+
+	// The author's drafts are only visible to the author
+	var own domain.ReadingListResponse
+	app.do("POST", "/api/users/me/lists", alice.Token, domain.ReadingListRequest{Name: "Mine", Shared: true}, &own)
+	ownPath := "/api/users/me/lists/" + own.ID.String()
+	app.do("PUT", ownPath+"/posts/"+draft.ID.String(), alice.Token, nil, nil)
+	app.do("PUT", ownPath+"/posts/"+posts[0].ID.String(), alice.Token, nil, nil)
+	app.do("GET", strings.TrimPrefix(own.ShareURL, app.server.URL), "", nil, &public)
+	if len(public.Posts) != 1 || public.PostCount != 1 {
+		t.Fatalf("public list with a draft %+v", public)
+	}
+
+	// Unpublished posts leave the bookmarks and lists of readers
+	status := domain.PostStatusDraft
+	app.do("PUT", "/api/posts/"+posts[0].ID.String(), alice.Token, domain.PostUpdateRequest{Status: &status}, nil)
+	app.do("GET", "/api/users/me/bookmarks", bob.Token, nil, &page)
+	if len(page.Bookmarks) != 1 || page.Bookmarks[0].Post.ID != posts[2].ID {
+		t.Fatalf("bookmarks after unpublishing %+v", page.Bookmarks)
+	}
+	app.do("GET", listPath, bob.Token, nil, &list)
+	if want := []uuid.UUID{posts[1].ID, posts[2].ID}; !reflect.DeepEqual(order(list), want) {
+		t.Fatalf("list after unpublishing %v", order(list))
+	}
+	app.do("GET", ownPath, alice.Token, nil, &own)
+	if len(own.Posts) != 2 {
+		t.Fatalf("author's list after unpublishing %+v", own.Posts)
+	}
+
+	// Turning sharing off invalidates the link
+	shared = false
+	app.do("PUT", listPath, bob.Token, domain.ReadingListUpdateRequest{Shared: &shared}, &list)
+	problem = handler.Problem{}
+	app.do("GET", sharePath, "", nil, &problem)
+	expectProblem(t, "unshared list", problem, http.StatusNotFound, "reading_list_not_found")
+
+	expectStatus(t, "delete list", app.do("DELETE", listPath, bob.Token, nil, nil), http.StatusNoContent)
+	expectStatus(t, "deleted list", app.do("GET", listPath, bob.Token, nil, nil), http.StatusNotFound)
+}
+
+func TestPublicAPI(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+
+	var published, draft domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &published)
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Draft", Content: "Text", Status: domain.PostStatusDraft}, &draft)
+
+	resp, body := app.send("GET", "/public/posts", "", nil, nil)
+	expectStatus(t, "anonymous list", resp.StatusCode, http.StatusOK)
+	if strings.Contains(string(body), "alice@example.com") {
+		t.Fatal("public responses must not contain the author's email")
+	}
+	var list domain.PostListResponse
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Posts) != 1 || list.Posts[0].ID != published.ID {
+		t.Fatalf("public list: %+v", list.Posts)
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.HasPrefix(cc, "public") {
+		t.Fatalf("anonymous Cache-Control %q", cc)
+	}
+
+	expectStatus(t, "anonymous post", app.do("GET", "/public/posts/"+published.ID.String(), "", nil, nil), http.StatusOK)
+	// Drafts are not public, even for their author
+	expectStatus(t, "draft", app.do("GET", "/public/posts/"+draft.ID.String(), alice.Token, nil, nil), http.StatusNotFound)
+
+	// A token is optional, but a present one must be valid
+	resp, _ = app.send("GET", "/public/posts", alice.Token, nil, nil)
+	expectStatus(t, "signed-in list", resp.StatusCode, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "private, no-cache" {
+		t.Fatalf("signed-in Cache-Control %q", cc)
+	}
+	var problem handler.Problem
+	app.do("GET", "/public/posts", "not-a-token", nil, &problem)
+	expectProblem(t, "invalid token", problem, http.StatusUnauthorized, "invalid_token")
+
+	var profile domain.AuthorProfileResponse
+	expectStatus(t, "author", app.do("GET", "/public/authors/"+alice.User.ID, "", nil, &profile), http.StatusOK)
+	if profile.ID != alice.User.ID || len(profile.Posts.Posts) != 1 {
+		t.Fatalf("author profile: %+v", profile)
+	}
+	expectStatus(t, "missing author", app.do("GET", "/public/authors/missing", "", nil, nil), http.StatusNotFound)
+}
+
+// Posts of a deleted account disappear from every reader-facing listing
+func TestDeletedAuthorPosts(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	var post domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Farewell", Content: "Text"}, &post)
+	app.do("PUT", "/api/users/me/bookmarks/"+post.ID.String(), bob.Token, nil, nil)
+	var list domain.ReadingListResponse
+	app.do("POST", "/api/users/me/lists", bob.Token, domain.ReadingListRequest{Name: "Later", Shared: true}, &list)
+	app.do("PUT", "/api/users/me/lists/"+list.ID.String()+"/posts/"+post.ID.String(), bob.Token, nil, nil)
+	sharePath := strings.TrimPrefix(list.ShareURL, app.server.URL)
+
+	status := app.do("DELETE", "/api/users/me", alice.Token, domain.DeleteUserRequest{Password: "correct-horse"}, nil)
+	expectStatus(t, "delete account", status, http.StatusOK)
+
+	expectStatus(t, "public post", app.do("GET", "/public/posts/"+post.ID.String(), "", nil, nil), http.StatusNotFound)
+	expectStatus(t, "post", app.do("GET", "/api/posts/"+post.ID.String(), bob.Token, nil, nil), http.StatusNotFound)
+	var posts domain.PostListResponse
+	app.do("GET", "/public/posts", "", nil, &posts)
+	if len(posts.Posts) != 0 {
+		t.Fatalf("public list %+v", posts.Posts)
+	}
+	if _, body := app.send("GET", "/feed.json", "", nil, nil); strings.Contains(string(body), "Farewell") {
+		t.Fatalf("feed %s", body)
+	}
+	var bookmarks domain.BookmarkListResponse
+	app.do("GET", "/api/users/me/bookmarks", bob.Token, nil, &bookmarks)
+	if len(bookmarks.Bookmarks) != 0 {
+		t.Fatalf("bookmarks %+v", bookmarks.Bookmarks)
+	}
+	var shared domain.ReadingListResponse
+	app.do("GET", sharePath, "", nil, &shared)
+	if len(shared.Posts) != 0 {
+		t.Fatalf("shared list %+v", shared.Posts)
+	}
+}
+
+func TestUsernames(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	update := func(token string, req domain.UpdateUserRequest) int {
+		t.Helper()
+		return app.do("PUT", "/api/users/me", token, req, nil)
+	}
+	str := func(s string) *string { return &s }
+
+	var problem handler.Problem
+	app.do("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{Username: str("admin")}, &problem)
+	expectProblem(t, "reserved username", problem, http.StatusUnprocessableEntity, "validation_failed")
+	problem = handler.Problem{}
+	app.do("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{Website: str("javascript:alert(1)")}, &problem)
+	expectProblem(t, "invalid website", problem, http.StatusUnprocessableEntity, "validation_failed")
+
+	expectStatus(t, "set profile", update(alice.Token, domain.UpdateUserRequest{
+		Username: str(" Alice "),
+		Bio:      str("Writes about Go"),
+		Website:  str("https://alice.example.com"),
+	}), http.StatusOK)
+	problem = handler.Problem{}
+	app.do("PUT", "/api/users/me", bob.Token, domain.UpdateUserRequest{Username: str("alice")}, &problem)
+	expectProblem(t, "taken username", problem, http.StatusConflict, "username_taken")
+
+	// An empty string clears the optional fields, but not the username
+	expectStatus(t, "set avatar", update(bob.Token, domain.UpdateUserRequest{
+		Website:   str("https://bob.example.com"),
+		AvatarURL: str("https://bob.example.com/me.png"),
+	}), http.StatusOK)
+	expectStatus(t, "clear website and avatar", update(bob.Token, domain.UpdateUserRequest{Website: str(""), AvatarURL: str("")}), http.StatusOK)
+	var cleared domain.UserResponse
+	app.do("GET", "/api/users/me", bob.Token, nil, &cleared)
+	if cleared.Website != "" || cleared.AvatarURL != "" {
+		t.Fatalf("cleared profile: %+v", cleared)
+	}
+	expectStatus(t, "empty username", update(bob.Token, domain.UpdateUserRequest{Username: str("")}), http.StatusUnprocessableEntity)
+
+	var post domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &post)
+
+	resp, body := app.send("GET", "/public/users/ALICE", "", nil, nil)
+	expectStatus(t, "public profile", resp.StatusCode, http.StatusOK)
+	if strings.Contains(string(body), "alice@example.com") {
+		t.Fatal("public profile must not contain the email")
+	}
+	var profile domain.AuthorProfileResponse
+	if err := json.Unmarshal(body, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Username != "alice" || profile.Bio != "Writes about Go" || len(profile.Posts.Posts) != 1 {
+		t.Fatalf("profile: %+v", profile)
+	}
+
+	// Posts show the public author, even in the authenticated API
+	_, body = app.send("GET", "/api/posts/"+post.ID.String(), bob.Token, nil, nil)
+	if strings.Contains(string(body), "alice@example.com") || !strings.Contains(string(body), `"username":"alice"`) {
+		t.Fatalf("post author: %s", body)
+	}
+
+	// Renaming keeps the old name as a redirect reserved for its owner
+	expectStatus(t, "rename", update(alice.Token, domain.UpdateUserRequest{Username: str("alice-writes")}), http.StatusOK)
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirects.Get(app.server.URL + "/public/users/alice?limit=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/public/users/alice-writes?limit=5" {
+		t.Fatalf("old username: %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	expectStatus(t, "bob claims old name", update(bob.Token, domain.UpdateUserRequest{Username: str("alice")}), http.StatusConflict)
+	expectStatus(t, "alice takes it back", update(alice.Token, domain.UpdateUserRequest{Username: str("alice")}), http.StatusOK)
+	expectStatus(t, "current name", app.do("GET", "/public/users/alice", "", nil, nil), http.StatusOK)
+	expectStatus(t, "unknown name", app.do("GET", "/public/users/nobody", "", nil, nil), http.StatusNotFound)
+}
+
+func TestPostCache(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.CacheDriver = "memory"
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+
+	var created domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &created)
+	path := "/api/posts/" + created.ID.String()
+
+	var post domain.PostSearchResponse
+	expectStatus(t, "get post", app.do("GET", path, alice.Token, nil, &post), http.StatusOK)
+
+	// Edits and author renames are visible right away
+	title := "Changed"
+	expectStatus(t, "update post", app.do("PUT", path, alice.Token, domain.PostUpdateRequest{Title: &title}, nil), http.StatusOK)
+	firstName := "Alicia"
+	expectStatus(t, "rename", app.do("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{FirstName: &firstName}, nil), http.StatusOK)
+
+	post = domain.PostSearchResponse{}
+	app.do("GET", path, alice.Token, nil, &post)
+	if post.Title != "Changed" || post.Author.FirstName != "Alicia" {
+		t.Fatalf("stale post: %q by %q", post.Title, post.Author.FirstName)
+	}
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+
+	var post domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &post)
+
+	var created domain.CreateTokenResponse
+	status := app.do("POST", "/api/users/me/tokens", alice.Token, domain.CreateTokenRequest{
+		Name:   "reader",
+		Scopes: []string{domain.ScopePostsRead},
+	}, &created)
+	expectStatus(t, "create token", status, http.StatusCreated)
+
+	status = app.do("GET", "/api/posts/"+post.ID.String(), created.Token, nil, nil)
+	expectStatus(t, "read with token", status, http.StatusOK)
+
+	var problem handler.Problem
+	app.do("POST", "/api/posts", created.Token, domain.PostCreateRequest{Title: "Nope", Content: "Text"}, &problem)
+	expectProblem(t, "write with read token", problem, http.StatusForbidden, "insufficient_scope")
+
+	problem = handler.Problem{}
+	app.do("POST", "/api/users/me/tokens", created.Token, domain.CreateTokenRequest{Name: "x", Scopes: []string{domain.ScopePostsRead}}, &problem)
+	expectProblem(t, "mint token with token", problem, http.StatusForbidden, "session_required")
+
+	// A token that may edit the profile still can't take over the account
+	var writer domain.CreateTokenResponse
+	app.do("POST", "/api/users/me/tokens", alice.Token, domain.CreateTokenRequest{Name: "profile", Scopes: []string{domain.ScopeUsersWrite}}, &writer)
+	password, email, bio := "new-password-123", "mallory@example.com", "Hi"
+	for what, req := range map[string]domain.UpdateUserRequest{
+		"password change": {Password: &password},
+		"email change":    {Email: &email},
+	} {
+		problem = handler.Problem{}
+		app.do("PUT", "/api/users/me", writer.Token, req, &problem)
+		expectProblem(t, what+" with token", problem, http.StatusForbidden, "session_required")
+	}
+	expectStatus(t, "bio change with token", app.do("PUT", "/api/users/me", writer.Token, domain.UpdateUserRequest{Bio: &bio}, nil), http.StatusOK)
+	expectStatus(t, "old password", app.do("POST", "/auth/login", "", domain.LoginRequest{Email: "alice@example.com", Password: "correct-horse"}, nil), http.StatusOK)
+
+	var tokens []domain.TokenResponse
+	app.do("GET", "/api/users/me/tokens", alice.Token, nil, &tokens)
+	if len(tokens) != 2 {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+
+	status = app.do("DELETE", "/api/users/me/tokens/"+created.Info.ID, alice.Token, nil, nil)
+	if status >= 300 {
+		t.Fatalf("revoke token: status %d", status)
+	}
+
+	problem = handler.Problem{}
+	app.do("GET", "/api/posts/"+post.ID.String(), created.Token, nil, &problem)
+	expectProblem(t, "revoked token", problem, http.StatusUnauthorized, "invalid_token")
+}
+
+// Tokens are stamped with the application clock, not the wall clock
+func TestPersonalAccessTokenTimestamps(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	app := newTestAppWith(t, []app.Option{app.WithClock(clock.NewManual(now))})
+	alice := app.register("alice@example.com", "correct-horse")
+
+	days := 30
+	var created domain.CreateTokenResponse
+	status := app.do("POST", "/api/users/me/tokens", alice.Token, domain.CreateTokenRequest{
+		Name:          "reader",
+		Scopes:        []string{domain.ScopePostsRead},
+		ExpiresInDays: days,
+	}, &created)
+	expectStatus(t, "create token", status, http.StatusCreated)
+
+	var tokens []domain.TokenResponse
+	app.do("GET", "/api/users/me/tokens", alice.Token, nil, &tokens)
+	if len(tokens) != 1 || !tokens[0].CreatedAt.Equal(now) ||
+		tokens[0].ExpiresAt == nil || !tokens[0].ExpiresAt.Equal(now.AddDate(0, 0, days)) {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := oidctest.NewProvider("blog")
+	defer provider.Close()
+	provider.SetIdentity(oidctest.Identity{
+		Subject:       "subject-1",
+		Email:         "carol@example.com",
+		EmailVerified: true,
+		GivenName:     "Carol",
+	})
+
+	app := newTestApp(t, func(cfg *config.Config, serverURL string) {
+		cfg.OIDCProviders = []config.OIDCProvider{{
+			Name:        "test",
+			Issuer:      provider.Issuer,
+			ClientID:    provider.ClientID,
+			RedirectURL: serverURL + "/auth/oidc/test/callback",
+		}}
+	})
+
+	login := func() domain.AuthResponse {
+		t.Helper()
+
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		resp, err := client.Get(app.server.URL + "/auth/oidc/test/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		expectStatus(t, "oidc login", resp.StatusCode, http.StatusOK)
+
+		var auth domain.AuthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+			t.Fatal(err)
+		}
+		return auth
+	}
+
+	first := login()
+	if first.User.Email != "carol@example.com" || first.User.FirstName != "Carol" {
+		t.Fatalf("unexpected user: %+v", first.User)
+	}
+	if second := login(); second.User.ID != first.User.ID {
+		t.Fatalf("second login created another user: %q != %q", second.User.ID, first.User.ID)
+	}
+
+	// The user has no password, so password login must fail
+	var problem handler.Problem
+	app.do("POST", "/auth/login", "", domain.LoginRequest{Email: "carol@example.com", Password: "anything"}, &problem)
+	expectProblem(t, "password login", problem, http.StatusUnauthorized, "invalid_credentials")
+}
+
+func TestOIDCStateExpiry(t *testing.T) {
+	provider := oidctest.NewProvider("blog")
+	defer provider.Close()
+	provider.SetIdentity(oidctest.Identity{Subject: "subject-1", Email: "carol@example.com", EmailVerified: true})
+
+	clk := clock.NewManual(time.Now())
+	app := newTestAppWith(t, []app.Option{app.WithClock(clk)}, func(cfg *config.Config, serverURL string) {
+		cfg.OIDCProviders = []config.OIDCProvider{{
+			Name:        "test",
+			Issuer:      provider.Issuer,
+			ClientID:    provider.ClientID,
+			RedirectURL: serverURL + "/auth/oidc/test/callback",
+		}}
+	})
+
+	// login stops at the redirect back from the provider, waits and then
+	// follows it
+	login := func(wait time.Duration) *http.Response {
+		t.Helper()
+
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			if strings.HasSuffix(req.URL.Path, "/callback") {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}}
+		resp, err := client.Get(app.server.URL + "/auth/oidc/test/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		expectStatus(t, "redirect to callback", resp.StatusCode, http.StatusFound)
+
+		clk.Set(clk.Now().Add(wait))
+		resp, err = client.Get(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	expectStatus(t, "callback in time", login(9*time.Minute).StatusCode, http.StatusOK)
+
+	resp := login(11 * time.Minute)
+	var problem handler.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	expectProblem(t, "expired state", problem, http.StatusBadRequest, "invalid_state")
+}
+
+func TestHealth(t *testing.T) {
+	app := newTestApp(t)
+	expectStatus(t, "livez", app.do("GET", "/livez", "", nil, nil), http.StatusOK)
+	expectStatus(t, "readyz", app.do("GET", "/readyz", "", nil, nil), http.StatusOK)
+}
+
+func TestPathPrefixAndLifecycle(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ServerPort = "0"
+	cfg.MetricsPort = "0"
+
+	blog, err := app.New(cfg, append(memoryOptions(t, memory.NewStore()), app.WithPathPrefix("/blog"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blog.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	base := "http://" + blog.Addr().String()
+	resp, err := http.Post(base+"/blog/auth/register", "application/json",
+		strings.NewReader(`{"email":"dave@example.com","password":"correct-horse"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expectStatus(t, "register under prefix", resp.StatusCode, http.StatusCreated)
+
+	resp, err = http.Get(base + "/livez")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expectStatus(t, "route outside prefix", resp.StatusCode, http.StatusNotFound)
+
+	// Metrics are served on their own port only
+	resp, err = http.Get(base + "/blog/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expectStatus(t, "metrics on the API port", resp.StatusCode, http.StatusNotFound)
+
+	metricsURL := "http://" + blog.MetricsAddr().String() + "/metrics"
+	resp, err = http.Get(metricsURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	expectStatus(t, "metrics", resp.StatusCode, http.StatusOK)
+	if !strings.Contains(string(body), `lemara_user_registrations_total{method="password"}`) {
+		t.Fatalf("registration not counted by method:\n%s", body)
+	}
+
+	if err := blog.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(base + "/blog/livez"); err == nil {
+		t.Fatal("server still accepts connections after Shutdown")
+	}
+	if _, err := http.Get(metricsURL); err == nil {
+		t.Fatal("metrics server still accepts connections after Shutdown")
+	}
+}
+
+func TestCORSAndSecurityHeaders(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.CORSAllowedOrigins = []string{"https://spa.example.com"}
+	})
+
+	req, _ := http.NewRequest("OPTIONS", app.server.URL+"/api/posts", nil)
+	req.Header.Set("Origin", "https://spa.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expectStatus(t, "preflight", resp.StatusCode, http.StatusNoContent)
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://spa.example.com" {
+		t.Fatalf("Access-Control-Allow-Origin = %q", got)
+	}
+	if !strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), "POST") {
+		t.Fatalf("Access-Control-Allow-Methods = %q", resp.Header.Get("Access-Control-Allow-Methods"))
+	}
+
+	req, _ = http.NewRequest("GET", app.server.URL+"/livez", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("disallowed origin got Access-Control-Allow-Origin %q", got)
+	}
+	for _, header := range []string{"Content-Security-Policy", "X-Content-Type-Options", "X-Frame-Options"} {
+		if resp.Header.Get(header) == "" {
+			t.Errorf("missing %s", header)
+		}
+	}
+	// Plain HTTP must not get HSTS
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("HSTS sent over plain HTTP: %q", got)
+	}
+}
+
+func TestBodyLimits(t *testing.T) {
+	app := newTestApp(t)
+
+	var problem handler.Problem
+	app.do("POST", "/auth/login", "", domain.LoginRequest{
+		Email:    "alice@example.com",
+		Password: strings.Repeat("x", 100<<10),
+	}, &problem)
+	expectProblem(t, "oversized login", problem, http.StatusRequestEntityTooLarge, "body_too_large")
+
+	// Posts get the larger default limit
+	alice := app.register("alice@example.com", "correct-horse")
+	status := app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{
+		Title:   "Long read",
+		Content: strings.Repeat("word ", 40<<10),
+	}, nil)
+	expectStatus(t, "long post", status, http.StatusOK)
+}
+
+// Reactions don't change UpdatedAt, but they move Last-Modified of the post
+// and of the listings it is on
+func TestLastModifiedWithReactions(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	app := newTestAppWith(t, []app.Option{app.WithClock(clk)})
+	app.store.SetClock(clk.Now)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	var post domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &post)
+	paths := []string{
+		"/api/posts/" + post.ID.String(),
+		"/api/posts",
+		"/public/posts/" + post.ID.String(),
+		"/public/posts",
+		"/public/authors/" + alice.User.ID,
+	}
+	expect := func(what string, want time.Time) {
+		t.Helper()
+		for _, path := range paths {
+			resp, _ := app.send("GET", path, alice.Token, nil, nil)
+			if got := resp.Header.Get("Last-Modified"); got != want.Format(http.TimeFormat) {
+				t.Fatalf("%s: %s: Last-Modified %q, want %s", what, path, got, want.Format(http.TimeFormat))
+			}
+		}
+	}
+	created := clk.Now()
+	expect("new post", created)
+
+	clk.Set(created.Add(time.Hour))
+	app.do("PUT", paths[0]+"/reactions/like", bob.Token, nil, nil)
+	expect("reaction", clk.Now())
+	resp, _ := app.send("GET", paths[0], alice.Token, nil, map[string]string{"If-Modified-Since": created.Format(http.TimeFormat)})
+	expectStatus(t, "If-Modified-Since before the reaction", resp.StatusCode, http.StatusOK)
+
+	// Taking the last reaction back is a change too
+	clk.Set(created.Add(2 * time.Hour))
+	app.do("DELETE", paths[0]+"/reactions/like", bob.Token, nil, nil)
+	expect("removed reaction", clk.Now())
+}
+
+func TestConditionalRequests(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	var post domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Hello", Content: "Text"}, &post)
+	path := "/api/posts/" + post.ID.String()
+
+	resp, _ := app.send("GET", path, alice.Token, nil, nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("missing validators: %v", resp.Header)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "private, no-cache" {
+		t.Fatalf("Cache-Control = %q", got)
+	}
+
+	lastModified := resp.Header.Get("Last-Modified")
+	resp, body := app.send("GET", path, alice.Token, nil, map[string]string{"If-None-Match": etag})
+	expectStatus(t, "If-None-Match", resp.StatusCode, http.StatusNotModified)
+	if len(body) != 0 || resp.Header.Get("ETag") != etag {
+		t.Fatalf("304 must have no body and repeat the ETag")
+	}
+	resp, _ = app.send("GET", path, alice.Token, nil, map[string]string{"If-Modified-Since": lastModified})
+	expectStatus(t, "If-Modified-Since", resp.StatusCode, http.StatusNotModified)
+
+	// A reaction changes the response, but not what the author edits
+	app.do("PUT", path+"/reactions/like", bob.Token, nil, nil)
+	resp, _ = app.send("GET", path, alice.Token, nil, map[string]string{"If-None-Match": etag})
+	expectStatus(t, "If-None-Match after a reaction", resp.StatusCode, http.StatusOK)
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("a reaction must change the ETag")
+	}
+
+	resp, _ = app.send("GET", "/api/posts", alice.Token, nil, nil)
+	listETag := resp.Header.Get("ETag")
+	resp, _ = app.send("GET", "/api/posts", alice.Token, nil, map[string]string{"If-None-Match": listETag})
+	expectStatus(t, "listing If-None-Match", resp.StatusCode, http.StatusNotModified)
+
+	title := "Hello again"
+	var problem handler.Problem
+	app.do("PUT", path, bob.Token, domain.PostUpdateRequest{Title: &title}, &problem)
+	expectProblem(t, "update by another user", problem, http.StatusForbidden, "not_post_author")
+
+	resp, _ = app.send("PUT", path, alice.Token, domain.PostUpdateRequest{Title: &title}, map[string]string{"If-Match": etag})
+	expectStatus(t, "update with an ETag from before the reaction", resp.StatusCode, http.StatusOK)
+	newETag := resp.Header.Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("update must return a new ETag, got %q", newETag)
+	}
+
+	// A second writer still holding the old ETag loses
+	stale := "Stale"
+	resp, body = app.send("PUT", path, alice.Token, domain.PostUpdateRequest{Title: &stale}, map[string]string{"If-Match": etag})
+	expectStatus(t, "update with stale ETag", resp.StatusCode, http.StatusPreconditionFailed)
+	json.Unmarshal(body, &problem)
+	expectProblem(t, "stale ETag", problem, http.StatusPreconditionFailed, "etag_mismatch")
+
+	resp, _ = app.send("GET", path, alice.Token, nil, map[string]string{"If-None-Match": etag})
+	expectStatus(t, "old ETag after update", resp.StatusCode, http.StatusOK)
+
+	var listing domain.PostListResponse
+	app.do("GET", "/api/posts?author="+alice.User.ID+"&limit=5", alice.Token, nil, &listing)
+	if len(listing.Posts) != 1 || listing.Posts[0].Title != "Hello again" || listing.Limit != 5 {
+		t.Fatalf("unexpected listing: %+v", listing)
+	}
+
+	// Profiles support the same validators
+	resp, _ = app.send("GET", "/api/users/me", alice.Token, nil, nil)
+	profileETag := resp.Header.Get("ETag")
+	firstName := "Alice"
+	resp, _ = app.send("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{FirstName: &firstName}, map[string]string{"If-Match": `"outdated"`})
+	expectStatus(t, "profile update with wrong ETag", resp.StatusCode, http.StatusPreconditionFailed)
+	resp, _ = app.send("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{FirstName: &firstName}, map[string]string{"If-Match": profileETag})
+	expectStatus(t, "profile update with current ETag", resp.StatusCode, http.StatusOK)
+}
@@ -0,0 +1,157 @@
+package app_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"lemara_blog/internal/config"
+	"lemara_blog/internal/domain"
+)
+
+func TestFeeds(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.SiteTitle = "Test Blog"
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	firstName := "Alice"
+	app.do("PUT", "/api/users/me", alice.Token, domain.UpdateUserRequest{FirstName: &firstName}, nil)
+
+	var hello domain.Post
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{
+		Title:   "Hello <World>",
+		Content: "First paragraph & more.\n\nSecond paragraph.",
+		Tags:    []string{"go"},
+	}, &hello)
+	app.do("POST", "/api/posts", bob.Token, domain.PostCreateRequest{Title: "Bob's post", Content: "Text"}, nil)
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Draft", Content: "Secret", Status: domain.PostStatusDraft}, nil)
+
+	// RSS
+	resp, body := app.send("GET", "/feed.xml", "", nil, nil)
+	expectStatus(t, "rss", resp.StatusCode, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Fatalf("rss content type %q", ct)
+	}
+	var rss struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title       string `xml:"title"`
+				Description string `xml:"description"`
+				PubDate     string `xml:"pubDate"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(body, &rss); err != nil {
+		t.Fatalf("decode rss: %v", err)
+	}
+	if rss.Channel.Title != "Test Blog" || len(rss.Channel.Items) != 2 {
+		t.Fatalf("rss: %q with %d items, want 2 published posts", rss.Channel.Title, len(rss.Channel.Items))
+	}
+	item := rss.Channel.Items[1]
+	if item.Title != "Hello <World>" || item.Description != "<p>First paragraph &amp; more.</p><p>Second paragraph.</p>" {
+		t.Fatalf("rss item: %+v", item)
+	}
+
+	// Conditional GET
+	etag := resp.Header.Get("ETag")
+	if resp.Header.Get("Last-Modified") != "" {
+		t.Fatal("feeds are validated by their ETag only")
+	}
+	resp, _ = app.send("GET", "/feed.xml", "", nil, map[string]string{"If-None-Match": etag})
+	expectStatus(t, "rss revalidation", resp.StatusCode, http.StatusNotModified)
+
+	// Atom, per author
+	resp, body = app.send("GET", "/authors/"+alice.User.ID+"/atom.xml", "", nil, nil)
+	expectStatus(t, "atom", resp.StatusCode, http.StatusOK)
+	var atom struct {
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Entries []struct {
+			ID        string `xml:"id"`
+			Published string `xml:"published"`
+			Author    string `xml:"author>name"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &atom); err != nil {
+		t.Fatalf("decode atom: %v", err)
+	}
+	if atom.Title != "Test Blog: Alice" || len(atom.Entries) != 1 {
+		t.Fatalf("atom: %q with %d entries", atom.Title, len(atom.Entries))
+	}
+	if entry := atom.Entries[0]; entry.ID != "urn:uuid:"+hello.ID.String() || entry.Author != "Alice" || entry.Published == "" {
+		t.Fatalf("atom entry: %+v", entry)
+	}
+	resp, _ = app.send("GET", "/authors/missing/atom.xml", "", nil, nil)
+	expectStatus(t, "missing author", resp.StatusCode, http.StatusNotFound)
+
+	// JSON Feed, per tag
+	resp, body = app.send("GET", "/tags/go/feed.json", "", nil, nil)
+	expectStatus(t, "json feed", resp.StatusCode, http.StatusOK)
+	var feed struct {
+		Version string `json:"version"`
+		FeedURL string `json:"feed_url"`
+		Items   []struct {
+			ID          string   `json:"id"`
+			ContentHTML string   `json:"content_html"`
+			Summary     string   `json:"summary"`
+			Tags        []string `json:"tags"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("decode json feed: %v", err)
+	}
+	if feed.Version != "https://jsonfeed.org/version/1.1" || !strings.HasSuffix(feed.FeedURL, "/tags/go/feed.json") {
+		t.Fatalf("json feed: %+v", feed)
+	}
+	if len(feed.Items) != 1 || feed.Items[0].ID != hello.ID.String() || feed.Items[0].Summary != "First paragraph & more." {
+		t.Fatalf("json feed items: %+v", feed.Items)
+	}
+
+	// Unpublishing an older post leaves the newest entry as it was, the
+	// feed still changes
+	resp, _ = app.send("GET", "/feed.xml", "", nil, nil)
+	etag = resp.Header.Get("ETag")
+	draft := domain.PostStatusDraft
+	app.do("PUT", "/api/posts/"+hello.ID.String(), alice.Token, domain.PostUpdateRequest{Status: &draft}, nil)
+	resp, body = app.send("GET", "/feed.xml", "", nil, map[string]string{"If-None-Match": etag})
+	expectStatus(t, "rss after unpublishing", resp.StatusCode, http.StatusOK)
+	if strings.Contains(string(body), "Hello") {
+		t.Fatal("an unpublished post stays in the feed")
+	}
+}
+
+func TestFeedExcerpts(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.FeedContent = "excerpt"
+		cfg.SiteURL = "https://blog.example.com/"
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{
+		Title:   "Long",
+		Content: strings.Repeat("word ", 100) + "\n\nHidden paragraph.",
+	}, nil)
+
+	var feed struct {
+		HomePageURL string `json:"home_page_url"`
+		Items       []struct {
+			ContentHTML string `json:"content_html"`
+			ContentText string `json:"content_text"`
+		} `json:"items"`
+	}
+	_, body := app.send("GET", "/feed.json", "", nil, nil)
+	if err := json.Unmarshal(body, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.HomePageURL != "https://blog.example.com/" {
+		t.Fatalf("home page %q", feed.HomePageURL)
+	}
+	text := feed.Items[0].ContentText
+	if feed.Items[0].ContentHTML != "" || !strings.HasSuffix(text, "word…") || strings.Contains(text, "Hidden") {
+		t.Fatalf("excerpt item: %+v", feed.Items[0])
+	}
+}
@@ -0,0 +1,449 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/app"
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/config"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/handler"
+	"lemara_blog/internal/storage/s3test"
+)
+
+// pngData makes a valid one pixel PNG of exactly size bytes: a private
+// ancillary chunk before IEND takes the rest, decoders skip it
+func pngData(size int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	encoded := buf.Bytes()
+	iend := len(encoded) - 12
+	padding := size - len(encoded) - 12
+	if padding < 0 {
+		panic("pngData: size too small")
+	}
+
+	chunk := make([]byte, 8, 12+padding)
+	binary.BigEndian.PutUint32(chunk, uint32(padding))
+	copy(chunk[4:], "laPd")
+	chunk = append(chunk, make([]byte, padding)...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	data := append([]byte{}, encoded[:iend]...)
+	data = append(data, chunk...)
+	return append(data, encoded[iend:]...)
+}
+
+// jpegData makes a width x height gradient JPEG with an EXIF segment that
+// carries the orientation and a camera comment
+func jpegData(width, height, orientation int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	encoded := buf.Bytes()
+
+	// Little-endian TIFF with one IFD entry: Orientation, SHORT, 1 value
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "Secret Camera GPS 55.75N 37.62E"...)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	data := append([]byte{}, encoded[:2]...)
+	data = append(data, segment...)
+	return append(data, encoded[2:]...)
+}
+
+// upload sends a file with the given multipart fields and decodes the JSON
+// response into out
+func (a *testApp) upload(token, filename string, content []byte, fields map[string]string, out any) int {
+	a.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req, err := http.NewRequest("POST", a.server.URL+"/api/media", &body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := a.server.Client().Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			a.t.Fatalf("upload %s: decode response: %v", filename, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// fetch downloads an absolute URL without credentials
+func (a *testApp) fetch(url string) (*http.Response, []byte) {
+	a.t.Helper()
+
+	resp, err := a.server.Client().Get(url)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestMediaUploads(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.MediaMaxBytes = 4096
+		cfg.MediaQuotaBytes = 6000
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+
+	// The type comes from the content, not from the name or the client
+	image := pngData(3000)
+	var public domain.MediaResponse
+	status := app.upload(alice.Token, `C:\photos\cat.txt`, image, nil, &public)
+	expectStatus(t, "upload", status, http.StatusCreated)
+	if public.ContentType != "image/png" || public.Size != 3000 || public.Filename != "cat.txt" ||
+		public.Visibility != domain.MediaPublic || public.URLExpiresAt != nil {
+		t.Fatalf("uploaded %+v", public)
+	}
+
+	resp, data := app.fetch(public.URL)
+	expectStatus(t, "public file", resp.StatusCode, http.StatusOK)
+	if !bytes.Equal(data, image) || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("public file: %d bytes of %s", len(data), resp.Header.Get("Content-Type"))
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Fatalf("public file Cache-Control %q", cc)
+	}
+
+	var problem handler.Problem
+	app.upload(alice.Token, "notes.png", []byte("just some text"), nil, &problem)
+	expectProblem(t, "text upload", problem, http.StatusUnsupportedMediaType, "unsupported_media_type")
+
+	app.upload(alice.Token, "big.png", pngData(5000), nil, &problem)
+	expectProblem(t, "file over MEDIA_MAX_BYTES", problem, http.StatusRequestEntityTooLarge, "media_too_large")
+
+	app.upload(alice.Token, "huge.png", pngData(200<<10), nil, &problem)
+	expectProblem(t, "body over the route limit", problem, http.StatusRequestEntityTooLarge, "body_too_large")
+
+	app.upload(alice.Token, "second.png", pngData(3500), nil, &problem)
+	expectProblem(t, "over quota", problem, http.StatusRequestEntityTooLarge, "media_quota_exceeded")
+
+	app.upload(alice.Token, "x.png", image, map[string]string{"visibility": "secret"}, &problem)
+	expectProblem(t, "bad visibility", problem, http.StatusUnprocessableEntity, "validation_failed")
+
+	// Private files are served only with a valid signature
+	var private domain.MediaResponse
+	status = app.upload(alice.Token, "private.png", pngData(1000), map[string]string{"visibility": "private"}, &private)
+	expectStatus(t, "private upload", status, http.StatusCreated)
+	if private.URLExpiresAt == nil || !strings.Contains(private.URL, "signature=") {
+		t.Fatalf("private upload %+v", private)
+	}
+	resp, _ = app.fetch(private.URL)
+	expectStatus(t, "signed private file", resp.StatusCode, http.StatusOK)
+	unsigned, _, _ := strings.Cut(private.URL, "?")
+	resp, _ = app.fetch(unsigned)
+	expectStatus(t, "unsigned private file", resp.StatusCode, http.StatusNotFound)
+	resp, _ = app.fetch(strings.Replace(private.URL, "expires=", "expires=9", 1))
+	expectStatus(t, "tampered private file", resp.StatusCode, http.StatusNotFound)
+
+	var list domain.MediaListResponse
+	status = app.do("GET", "/api/media", alice.Token, nil, &list)
+	expectStatus(t, "list", status, http.StatusOK)
+	if len(list.Media) != 2 || list.Usage != 4000 || list.Quota != 6000 || list.Media[0].ID != private.ID {
+		t.Fatalf("list %+v", list)
+	}
+
+	app.do("GET", "/api/media/"+public.ID.String(), bob.Token, nil, &problem)
+	expectProblem(t, "someone else's media", problem, http.StatusNotFound, "media_not_found")
+	app.do("DELETE", "/api/media/"+public.ID.String(), bob.Token, nil, &problem)
+	expectProblem(t, "delete someone else's media", problem, http.StatusNotFound, "media_not_found")
+
+	status = app.do("DELETE", "/api/media/"+public.ID.String(), alice.Token, nil, nil)
+	expectStatus(t, "delete", status, http.StatusNoContent)
+	resp, _ = app.fetch(public.URL)
+	expectStatus(t, "deleted file", resp.StatusCode, http.StatusNotFound)
+
+	// The freed space can be used again
+	status = app.upload(alice.Token, "again.png", pngData(3500), nil, nil)
+	expectStatus(t, "upload after delete", status, http.StatusCreated)
+}
+
+// Signed links expire by the clock of the App, not the wall clock
+func TestSignedMediaURLExpiry(t *testing.T) {
+	clk := clock.NewManual(time.Now())
+	blogApp := newTestAppWith(t, []app.Option{app.WithClock(clk)}, func(cfg *config.Config, _ string) {
+		cfg.MediaURLTTL = 10 * time.Minute
+	})
+
+	alice := blogApp.register("alice@example.com", "correct-horse")
+	var private domain.MediaResponse
+	status := blogApp.upload(alice.Token, "private.png", pngData(1000), map[string]string{"visibility": "private"}, &private)
+	expectStatus(t, "private upload", status, http.StatusCreated)
+	if want := clk.Now().Add(10 * time.Minute).Truncate(time.Second); !private.URLExpiresAt.Equal(want) {
+		t.Fatalf("expires at %s, want %s", private.URLExpiresAt, want)
+	}
+
+	clk.Set(clk.Now().Add(4 * time.Minute))
+	resp, _ := blogApp.fetch(private.URL)
+	expectStatus(t, "signed private file", resp.StatusCode, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "private, max-age=359" && cc != "private, max-age=360" {
+		t.Fatalf("Cache-Control %q", cc)
+	}
+
+	clk.Set(clk.Now().Add(7 * time.Minute))
+	resp, _ = blogApp.fetch(private.URL)
+	expectStatus(t, "expired link", resp.StatusCode, http.StatusNotFound)
+
+	// A fresh link works again
+	status = blogApp.do("GET", "/api/media/"+private.ID.String(), alice.Token, nil, &private)
+	expectStatus(t, "get media", status, http.StatusOK)
+	resp, _ = blogApp.fetch(private.URL)
+	expectStatus(t, "renewed link", resp.StatusCode, http.StatusOK)
+}
+
+func TestMediaS3Storage(t *testing.T) {
+	s3 := s3test.NewServer("media")
+	defer s3.Close()
+
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.MediaStorage = "s3"
+		cfg.S3Endpoint = s3.URL()
+		cfg.S3Region = s3.Region
+		cfg.S3Bucket = s3.Bucket
+		cfg.S3AccessKeyID = s3.AccessKeyID
+		cfg.S3SecretAccessKey = s3.SecretAccessKey
+		cfg.S3PathStyle = true
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+
+	var public, private domain.MediaResponse
+	expectStatus(t, "upload", app.upload(alice.Token, "a.png", pngData(100), nil, &public), http.StatusCreated)
+	expectStatus(t, "private upload",
+		app.upload(alice.Token, "b.png", pngData(200), map[string]string{"visibility": "private"}, &private), http.StatusCreated)
+	if s3.Len() != 2 {
+		t.Fatalf("%d objects in the bucket, want 2", s3.Len())
+	}
+
+	// Public files go through the blog, private ones straight to the bucket
+	resp, data := app.fetch(public.URL)
+	expectStatus(t, "public file", resp.StatusCode, http.StatusOK)
+	if len(data) != 100 {
+		t.Fatalf("public file: %d bytes", len(data))
+	}
+	if !strings.HasPrefix(private.URL, s3.URL()) || !strings.Contains(private.URL, "X-Amz-Signature=") {
+		t.Fatalf("private URL %s is not presigned", private.URL)
+	}
+	resp, data = app.fetch(private.URL)
+	expectStatus(t, "presigned file", resp.StatusCode, http.StatusOK)
+	if len(data) != 200 {
+		t.Fatalf("presigned file: %d bytes", len(data))
+	}
+
+	expectStatus(t, "delete", app.do("DELETE", "/api/media/"+private.ID.String(), alice.Token, nil, nil), http.StatusNoContent)
+	if s3.Len() != 1 {
+		t.Fatalf("%d objects in the bucket after delete, want 1", s3.Len())
+	}
+}
+
+func TestMediaImageProcessing(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.MediaImageWidths = []int{320, 640, 2000}
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+
+	// Metadata is gone and the orientation applied before anything is stored
+	var media domain.MediaResponse
+	status := app.upload(alice.Token, "photo.jpg", jpegData(1400, 700, 6), nil, &media)
+	expectStatus(t, "upload", status, http.StatusCreated)
+	if media.Width != 700 || media.Height != 1400 || media.Processing != domain.MediaProcessingPending {
+		t.Fatalf("uploaded %+v", media)
+	}
+	resp, original := app.fetch(media.URL)
+	expectStatus(t, "original", resp.StatusCode, http.StatusOK)
+	if bytes.Contains(original, []byte("Exif")) || bytes.Contains(original, []byte("Secret Camera")) {
+		t.Fatal("original still carries EXIF")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for media.Processing == domain.MediaProcessingPending {
+		if time.Now().After(deadline) {
+			t.Fatal("image was not processed in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+		status = app.do("GET", "/api/media/"+media.ID.String(), alice.Token, nil, &media)
+		expectStatus(t, "get", status, http.StatusOK)
+	}
+	if media.Processing != domain.MediaProcessingReady || len(media.Blurhash) != 28 {
+		t.Fatalf("processed %+v", media)
+	}
+
+	// 2000 is wider than the original and is skipped
+	if len(media.Variants) != 4 {
+		t.Fatalf("%d variants, want 4: %+v", len(media.Variants), media.Variants)
+	}
+	for _, variant := range media.Variants {
+		resp, data := app.fetch(variant.URL)
+		expectStatus(t, "variant "+variant.URL, resp.StatusCode, http.StatusOK)
+		if resp.Header.Get("Content-Type") != variant.ContentType || int64(len(data)) != variant.Size {
+			t.Fatalf("variant %s: %d bytes of %s", variant.URL, len(data), resp.Header.Get("Content-Type"))
+		}
+		if variant.Width != 320 && variant.Width != 640 || variant.Height != variant.Width*2 {
+			t.Fatalf("variant %+v", variant)
+		}
+		if variant.ContentType == "image/jpeg" {
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			if err != nil || cfg.Width != variant.Width || cfg.Height != variant.Height {
+				t.Fatalf("variant %s decodes to %+v: %v", variant.URL, cfg, err)
+			}
+		}
+	}
+
+	webp, jpg := media.SrcSet["image/webp"], media.SrcSet["image/jpeg"]
+	if strings.Count(webp, "w, ") != 1 || !strings.HasSuffix(webp, " 640w") {
+		t.Fatalf("webp srcset %q", webp)
+	}
+	// The original is the widest JPEG candidate
+	if strings.Count(jpg, "w, ") != 2 || !strings.HasSuffix(jpg, media.URL+" 700w") {
+		t.Fatalf("jpeg srcset %q", jpg)
+	}
+
+	resp, _ = app.fetch(media.URL + "/w999.webp")
+	expectStatus(t, "unknown variant", resp.StatusCode, http.StatusNotFound)
+
+	status = app.do("DELETE", "/api/media/"+media.ID.String(), alice.Token, nil, nil)
+	expectStatus(t, "delete", status, http.StatusNoContent)
+	resp, _ = app.fetch(media.Variants[0].URL)
+	expectStatus(t, "deleted variant", resp.StatusCode, http.StatusNotFound)
+}
+
+func TestMediaPixelLimit(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config, _ string) {
+		cfg.MediaImageMaxPixels = 100 * 100
+	})
+	alice := app.register("alice@example.com", "correct-horse")
+
+	// A rotated JPEG is decoded on upload, so the limit applies before that
+	var problem handler.Problem
+	status := app.upload(alice.Token, "big.jpg", jpegData(200, 100, 6), nil, &problem)
+	expectStatus(t, "too many pixels", status, http.StatusRequestEntityTooLarge)
+	expectProblem(t, "too many pixels", problem, http.StatusRequestEntityTooLarge, "image_too_large")
+
+	status = app.upload(alice.Token, "small.jpg", jpegData(100, 100, 6), nil, nil)
+	expectStatus(t, "at the limit", status, http.StatusCreated)
+}
+
+func TestPostCovers(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.register("alice@example.com", "correct-horse")
+	bob := app.register("bob@example.com", "correct-horse")
+	str := func(s string) *string { return &s }
+
+	var cover, private, foreign domain.MediaResponse
+	app.upload(alice.Token, "cover.jpg", jpegData(100, 50, 1), nil, &cover)
+	app.upload(alice.Token, "private.jpg", jpegData(100, 50, 1), map[string]string{"visibility": "private"}, &private)
+	app.upload(bob.Token, "bob.jpg", jpegData(100, 50, 1), nil, &foreign)
+
+	// Covers are public images of the author
+	for what, id := range map[string]string{
+		"private image":        private.ID.String(),
+		"someone else's image": foreign.ID.String(),
+		"missing image":        uuid.NewString(),
+	} {
+		var problem handler.Problem
+		app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Post", Content: "Text", CoverImageID: id}, &problem)
+		expectProblem(t, what, problem, http.StatusUnprocessableEntity, "validation_failed")
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "cover_image_id" {
+			t.Fatalf("%s: %+v", what, problem.Errors)
+		}
+	}
+	var problem handler.Problem
+	app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Post", Content: "Text", CoverImageID: "cover.jpg"}, &problem)
+	expectProblem(t, "not an ID", problem, http.StatusUnprocessableEntity, "validation_failed")
+
+	var created domain.Post
+	status := app.do("POST", "/api/posts", alice.Token, domain.PostCreateRequest{Title: "Post", Content: "Text", CoverImageID: cover.ID.String()}, &created)
+	expectStatus(t, "create with cover", status, http.StatusOK)
+	if created.CoverImageID == nil || *created.CoverImageID != cover.ID {
+		t.Fatalf("created %+v", created)
+	}
+	path := "/api/posts/" + created.ID.String()
+
+	// Readers get the file with its URL and size, as in the media API
+	var post domain.PostSearchResponse
+	app.do("GET", "/public/posts/"+created.ID.String(), "", nil, &post)
+	if post.CoverImage == nil || post.CoverImage.URL != cover.URL || post.CoverImage.Width != 100 || post.CoverImage.Height != 50 {
+		t.Fatalf("public cover %+v", post.CoverImage)
+	}
+	app.do("PUT", "/api/users/me/bookmarks/"+created.ID.String(), bob.Token, nil, nil)
+	var bookmarks domain.BookmarkListResponse
+	app.do("GET", "/api/users/me/bookmarks", bob.Token, nil, &bookmarks)
+	if len(bookmarks.Bookmarks) != 1 || bookmarks.Bookmarks[0].Post.CoverImage == nil {
+		t.Fatalf("bookmarked post %+v", bookmarks.Bookmarks)
+	}
+
+	// An empty ID removes the cover
+	post = domain.PostSearchResponse{}
+	status = app.do("PUT", path, alice.Token, domain.PostUpdateRequest{CoverImageID: str("")}, &post)
+	expectStatus(t, "remove cover", status, http.StatusOK)
+	if post.CoverImageID != nil || post.CoverImage != nil {
+		t.Fatalf("removed cover %+v", post)
+	}
+	problem = handler.Problem{}
+	app.do("PUT", path, alice.Token, domain.PostUpdateRequest{CoverImageID: str(private.ID.String())}, &problem)
+	expectProblem(t, "private cover", problem, http.StatusUnprocessableEntity, "validation_failed")
+
+	// Deleting the file takes the cover away, the post stays editable
+	app.do("PUT", path, alice.Token, domain.PostUpdateRequest{CoverImageID: str(cover.ID.String())}, nil)
+	status = app.do("DELETE", "/api/media/"+cover.ID.String(), alice.Token, nil, nil)
+	expectStatus(t, "delete cover file", status, http.StatusNoContent)
+	post = domain.PostSearchResponse{}
+	app.do("GET", path, alice.Token, nil, &post)
+	if post.CoverImageID != nil || post.CoverImage != nil {
+		t.Fatalf("cover of a deleted file %+v", post)
+	}
+	title := "Edited"
+	expectStatus(t, "edit after the file is gone", app.do("PUT", path, alice.Token, domain.PostUpdateRequest{Title: &title}, nil), http.StatusOK)
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"log/slog"
+	"strings"
+
+	"lemara_blog/internal/cache"
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/mail"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/service"
+	"lemara_blog/internal/storage"
+)
+
+// Option customizes an App created by New
+type Option func(*App)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(a *App) { a.logger = logger }
+}
+
+func WithClock(clk clock.Clock) Option {
+	return func(a *App) { a.clock = clk }
+}
+
+func WithMailer(mailer mail.Mailer) Option {
+	return func(a *App) { a.mailer = mailer }
+}
+
+// WithDatabase shares an existing connection cluster instead of connecting
+// with the configuration. The App neither migrates nor closes it.
+func WithDatabase(db *database.Cluster) Option {
+	return func(a *App) { a.db = db }
+}
+
+func WithUserRepository(repo repository.UserRepository) Option {
+	return func(a *App) { a.users = repo }
+}
+
+func WithPostRepository(repo repository.PostRepository) Option {
+	return func(a *App) { a.posts = repo }
+}
+
+func WithTokenRepository(repo repository.TokenRepository) Option {
+	return func(a *App) { a.tokens = repo }
+}
+
+func WithIdentityRepository(repo repository.IdentityRepository) Option {
+	return func(a *App) { a.identities = repo }
+}
+
+func WithMediaRepository(repo repository.MediaRepository) Option {
+	return func(a *App) { a.media = repo }
+}
+
+func WithReactionRepository(repo repository.ReactionRepository) Option {
+	return func(a *App) { a.reactions = repo }
+}
+
+func WithBookmarkRepository(repo repository.BookmarkRepository) Option {
+	return func(a *App) { a.bookmarks = repo }
+}
+
+func WithReadingListRepository(repo repository.ReadingListRepository) Option {
+	return func(a *App) { a.lists = repo }
+}
+
+// WithTransactor replaces the transaction manager; it must match the
+// injected repositories (memory.Transactor for memory repositories)
+func WithTransactor(tx service.Transactor) Option {
+	return func(a *App) { a.tx = tx }
+}
+
+// WithCache caches post reads in c regardless of CACHE_DRIVER. The App does
+// not close it.
+func WithCache(c cache.Cache) Option {
+	return func(a *App) { a.cache = c }
+}
+
+// WithFileStorage keeps uploaded files in store regardless of MEDIA_STORAGE
+func WithFileStorage(store storage.Storage) Option {
+	return func(a *App) { a.files = store }
+}
+
+// WithPathPrefix serves the blog under prefix (e.g. "/blog") so it can be
+// mounted into another router:
+//
+//	mux.Handle("/blog/", blog)
+func WithPathPrefix(prefix string) Option {
+	return func(a *App) { a.prefix = strings.TrimSuffix(prefix, "/") }
+}
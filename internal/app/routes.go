@@ -0,0 +1,205 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"lemara_blog/internal/config"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/handler"
+	"lemara_blog/internal/oidc"
+	"lemara_blog/internal/password"
+	"lemara_blog/internal/service"
+)
+
+// routes wires services and handlers into the HTTP handler
+func (a *App) routes() (http.Handler, error) {
+	cfg := a.cfg
+
+	// Initialize services
+	passwords, err := newPasswordManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+	authService := service.NewAuthService(a.users, a.identities, a.tx, passwords, &config.Config{
+		JWTSecret:     cfg.JWTSecret,
+		JWTExpiration: cfg.JWTExpiration,
+		BcryptCost:    cfg.BcryptCost,
+	})
+	reactionService := service.NewReactionService(a.reactions, a.posts, a.tx, cfg.PostReactions)
+	bookmarkService := service.NewBookmarkService(a.bookmarks, a.lists, a.posts, reactionService, a.media, a.tx)
+	postService := service.NewPostService(a.posts, a.tx, a.clock, reactionService, bookmarkService, a.media)
+	userService := service.NewUserService(a.users, a.tx, authService)
+	tokenService := service.NewTokenService(a.tokens, a.clock)
+	a.processor = service.NewMediaProcessor(a.media, a.files, service.ImageConfig{
+		Widths:    cfg.MediaImageWidths,
+		Formats:   cfg.MediaImageFormats,
+		Quality:   cfg.MediaImageQuality,
+		MaxPixels: cfg.MediaImageMaxPixels,
+		Workers:   cfg.MediaWorkers,
+	})
+	mediaService := service.NewMediaService(a.media, a.tx, a.files, a.processor, service.MediaConfig{
+		MaxBytes:     int64(cfg.MediaMaxBytes),
+		QuotaBytes:   int64(cfg.MediaQuotaBytes),
+		AllowedTypes: cfg.MediaAllowedTypes,
+		MaxPixels:    cfg.MediaImageMaxPixels,
+	})
+
+	// Initialize handlers
+	authHandler := handler.NewAuthHandler(authService)
+	userHandler := handler.NewUserHandler(a.users, authService, userService)
+	postHandler := handler.NewPostHandler(*postService, cfg.SiteURL)
+	tokenHandler := handler.NewTokenHandler(tokenService)
+	healthHandler := handler.NewHealthHandler(a.health)
+	publicHandler := handler.NewPublicHandler(postService, userService, a.users, cfg.SiteURL)
+	reactionHandler := handler.NewReactionHandler(reactionService)
+	bookmarkHandler := handler.NewBookmarkHandler(bookmarkService, handler.BookmarkConfig{BaseURL: cfg.SiteURL})
+	mediaHandler := handler.NewMediaHandler(mediaService, handler.MediaConfig{
+		BaseURL: cfg.SiteURL,
+		URLTTL:  cfg.MediaURLTTL,
+	}, cfg.JWTSecret, a.clock)
+	feedHandler := handler.NewFeedHandler(postService, a.users, handler.FeedConfig{
+		Title:       cfg.SiteTitle,
+		Description: cfg.SiteDescription,
+		BaseURL:     cfg.SiteURL,
+		Content:     cfg.FeedContent,
+		Size:        cfg.FeedSize,
+	})
+
+	// OpenID Connect providers
+	var oidcClients []*oidc.Client
+	for _, p := range cfg.OIDCProviders {
+		oidcClients = append(oidcClients, oidc.NewClient(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, nil))
+	}
+	oidcHandler := handler.NewOIDCHandler(oidcClients, authService, cfg.JWTSecret, a.clock)
+
+	// Setup router
+	mux := handler.NewRouter()
+	authMiddleware := handler.AuthMiddleware(cfg.JWTSecret, tokenService)
+	// Small JSON documents (credentials, profile, token requests)
+	smallBody := handler.LimitBody(smallBodyBytes)
+
+	// Public routes
+	mux.HandleFunc("POST /auth/register", smallBody(authHandler.Register))
+	mux.HandleFunc("POST /auth/login", smallBody(authHandler.Login))
+	mux.HandleFunc("GET /auth/oidc/{provider}/login", oidcHandler.Login)
+	mux.HandleFunc("GET /auth/oidc/{provider}/callback", oidcHandler.Callback)
+	mux.HandleFunc("GET /livez", healthHandler.Live)
+	mux.HandleFunc("GET /readyz", healthHandler.Ready)
+	mux.HandleFunc("GET /health", healthHandler.Ready)
+	mux.Handle("GET /health/details", authMiddleware(http.HandlerFunc(healthHandler.Details)))
+	// Ленты опубликованных постов: общая, автора и тега
+	for _, scope := range []string{"", "/authors/{author}", "/tags/{tag}"} {
+		mux.HandleFunc("GET "+scope+"/feed.xml", feedHandler.Feed(handler.FeedRSS))
+		mux.HandleFunc("GET "+scope+"/atom.xml", feedHandler.Feed(handler.FeedAtom))
+		mux.HandleFunc("GET "+scope+"/feed.json", feedHandler.Feed(handler.FeedJSON))
+	}
+
+	// Загруженные файлы; приватные только по подписанной ссылке
+	mux.HandleFunc("GET /media/{id}", mediaHandler.File)
+	mux.HandleFunc("GET /media/{id}/{variant}", mediaHandler.Variant)
+
+	// Опубликованные посты и авторы для анонимных читателей
+	public := handler.NewRouter()
+	public.HandleFunc("GET /public/posts", publicHandler.ListPosts)
+	public.HandleFunc("GET /public/posts/{id}", publicHandler.GetPost)
+	public.HandleFunc("GET /public/authors/{id}", publicHandler.GetAuthor)
+	public.HandleFunc("GET /public/users/{username}", publicHandler.GetUser)
+	// Открытые списки для чтения, по ссылке
+	public.HandleFunc("GET /public/lists/{token}", bookmarkHandler.SharedList)
+	mux.Handle("/public/", handler.OptionalAuth(cfg.JWTSecret, tokenService)(public))
+
+	// Protected routes (with auth middleware)
+	protected := handler.NewRouter()
+	protected.HandleFunc("GET /api/users/me", handler.RequireScope(domain.ScopeUsersRead)(userHandler.GetProfile))
+	protected.HandleFunc("PUT /api/users/me", handler.RequireScope(domain.ScopeUsersWrite)(smallBody(userHandler.UpdateProfile)))
+	protected.HandleFunc("DELETE /api/users/me", handler.RequireSession(smallBody(userHandler.DeleteProfile)))
+	// Персональные токены доступа
+	protected.HandleFunc("POST /api/users/me/tokens", handler.RequireSession(smallBody(tokenHandler.CreateToken)))
+	protected.HandleFunc("GET /api/users/me/tokens", handler.RequireSession(tokenHandler.ListTokens))
+	protected.HandleFunc("DELETE /api/users/me/tokens/{id}", handler.RequireSession(tokenHandler.RevokeToken))
+	// Закладки и списки для чтения
+	usersRead := handler.RequireScope(domain.ScopeUsersRead)
+	usersWrite := handler.RequireScope(domain.ScopeUsersWrite)
+	protected.HandleFunc("GET /api/users/me/bookmarks", usersRead(bookmarkHandler.ListBookmarks))
+	protected.HandleFunc("PUT /api/users/me/bookmarks/{post_id}", usersWrite(bookmarkHandler.Bookmark))
+	protected.HandleFunc("DELETE /api/users/me/bookmarks/{post_id}", usersWrite(bookmarkHandler.Unbookmark))
+	protected.HandleFunc("POST /api/users/me/lists", usersWrite(smallBody(bookmarkHandler.CreateList)))
+	protected.HandleFunc("GET /api/users/me/lists", usersRead(bookmarkHandler.ListLists))
+	protected.HandleFunc("GET /api/users/me/lists/{id}", usersRead(bookmarkHandler.GetList))
+	protected.HandleFunc("PUT /api/users/me/lists/{id}", usersWrite(smallBody(bookmarkHandler.UpdateList)))
+	protected.HandleFunc("DELETE /api/users/me/lists/{id}", usersWrite(bookmarkHandler.DeleteList))
+	protected.HandleFunc("PUT /api/users/me/lists/{id}/posts/{post_id}", usersWrite(smallBody(bookmarkHandler.AddToList)))
+	protected.HandleFunc("DELETE /api/users/me/lists/{id}/posts/{post_id}", usersWrite(bookmarkHandler.RemoveFromList))
+	// Посты
+	protected.HandleFunc("POST /api/posts", handler.RequireScope(domain.ScopePostsWrite)(postHandler.CreatePost))
+	protected.HandleFunc("GET /api/posts", handler.RequireScope(domain.ScopePostsRead)(postHandler.ListPosts))
+	protected.HandleFunc("GET /api/posts/{id}", handler.RequireScope(domain.ScopePostsRead)(postHandler.GetPost))
+	protected.HandleFunc("PUT /api/posts/{id}", handler.RequireScope(domain.ScopePostsWrite)(postHandler.UpdatePost))
+	protected.HandleFunc("PUT /api/posts/{id}/reactions/{kind}", handler.RequireScope(domain.ScopePostsWrite)(reactionHandler.React))
+	protected.HandleFunc("DELETE /api/posts/{id}/reactions/{kind}", handler.RequireScope(domain.ScopePostsWrite)(reactionHandler.Unreact))
+	// Файлы для постов; тело ограничено размером файла с запасом на поля формы
+	uploadBody := handler.LimitBody(int64(cfg.MediaMaxBytes) + multipartOverhead)
+	protected.HandleFunc("POST /api/media", handler.RequireScope(domain.ScopePostsWrite)(uploadBody(mediaHandler.Upload)))
+	protected.HandleFunc("GET /api/media", handler.RequireScope(domain.ScopePostsRead)(mediaHandler.ListMedia))
+	protected.HandleFunc("GET /api/media/{id}", handler.RequireScope(domain.ScopePostsRead)(mediaHandler.GetMedia))
+	protected.HandleFunc("DELETE /api/media/{id}", handler.RequireScope(domain.ScopePostsWrite)(mediaHandler.DeleteMedia))
+
+	// Вот тут важно подключить защищенные роуты к mux
+	mux.Handle("/api/", authMiddleware(protected))
+
+	var h http.Handler = mux
+	h = handler.DatabaseSession(h)
+	h = handler.BodyLimit(int64(cfg.MaxBodyBytes))(h)
+	h = handler.CORS(handler.CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	})(h)
+	h = handler.SecurityHeaders(handler.SecurityConfig{
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+	})(h)
+	// Recover sits inside Metrics and AccessLog so panics are counted and
+	// logged as 500 responses
+	h = handler.Recover(h)
+	h = handler.Metrics(h)
+	h = handler.AccessLog(a.logger)(h)
+	h = handler.Tracing(h)
+	h = handler.RequestID(h)
+	return h, nil
+}
+
+// Limit for endpoints that accept only a few short fields
+const smallBodyBytes = 64 << 10
+
+// Multipart boundaries, part headers and the small form fields sent with an
+// uploaded file
+const multipartOverhead = 64 << 10
+
+// Новые пароли хешируются выбранным алгоритмом, старые хеши другого алгоритма
+// принимаются и пересчитываются при входе
+func newPasswordManager(cfg *config.Config) (*password.Manager, error) {
+	argon := password.DefaultArgon2id()
+	argon.Memory = uint32(cfg.Argon2Memory)
+	argon.Iterations = uint32(cfg.Argon2Iterations)
+	argon.Parallelism = uint8(cfg.Argon2Parallelism)
+	bcryptHasher := &password.Bcrypt{Cost: cfg.BcryptCost}
+
+	switch cfg.PasswordHasher {
+	case password.AlgorithmArgon2id:
+		return password.NewManager(argon, bcryptHasher), nil
+	case password.AlgorithmBcrypt:
+		return password.NewManager(bcryptHasher, argon), nil
+	}
+	return nil, fmt.Errorf("unknown PASSWORD_HASHER %q", cfg.PasswordHasher)
+}
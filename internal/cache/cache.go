@@ -0,0 +1,17 @@
+// Package cache provides the key-value stores behind the repository read
+// caches: an in-process LRU and a Redis-backed implementation.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores opaque values under string keys. Implementations must be safe
+// for concurrent use. A zero ttl means the value never expires (it may still
+// be evicted).
+type Cache interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lemara_blog/internal/clock"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewManual(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := NewLRU(2, clk)
+
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), 0)
+	// Reading a makes b the least recently used entry
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("Get(a) = %q, %v", v, ok)
+	}
+	c.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Fatal("b must be evicted")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", c.Len())
+	}
+
+	clk.Advance(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Fatal("a must expire after its ttl")
+	}
+	if _, ok, _ := c.Get(ctx, "c"); !ok {
+		t.Fatal("entries without ttl must not expire")
+	}
+
+	c.Delete(ctx, "c", "missing")
+	if c.Len() != 0 {
+		t.Fatalf("Len() after Delete = %d, want 0", c.Len())
+	}
+}
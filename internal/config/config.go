@@ -1,47 +1,203 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
 	"os"
-	"strconv"
 	"time"
 )
 
-// Конфигурация приложения
+// Конфигурация приложения.
+//
+// Значения берутся (по возрастанию приоритета) из значений по умолчанию,
+// файла конфигурации (YAML или TOML), переменных окружения и флагов
+// командной строки. Ключ в файле - имя переменной в нижнем регистре
+// (db_host), флаг - то же имя через дефис (-db-host). Для секретов можно
+// указать путь к файлу: JWT_SECRET_FILE, jwt_secret_file, -jwt-secret-file.
 type Config struct {
-    DBHost         string
-    DBPort         string
-    DBUser         string
-    DBPassword     string
-    DBName         string
-    DBSSLMode      string
-    ServerPort     string
-    JWTSecret      string
+    // Окружение: development или production
+    AppEnv         string        `env:"APP_ENV" default:"development"`
+    LogLevel       string        `env:"LOG_LEVEL" default:"info"`
+    // По умолчанию json в production и text в остальных окружениях
+    LogFormat      string        `env:"LOG_FORMAT"`
+    // DATABASE_URL заменяет отдельные параметры DB_*
+    DatabaseURL    string        `env:"DATABASE_URL" secret:"true"`
+    DBHost         string        `env:"DB_HOST" default:"localhost"`
+    DBPort         string        `env:"DB_PORT" default:"5432"`
+    DBUser         string        `env:"DB_USER" default:"postgres"`
+    DBPassword     string        `env:"DB_PASSWORD" default:"postgres" secret:"true"`
+    DBName         string        `env:"DB_NAME" default:"myapp"`
+    DBSSLMode      string        `env:"DB_SSL_MODE" default:"disable"`
+    // Параметры пула соединений, общие для primary и реплики
+    DBMaxConns          int           `env:"DB_MAX_CONNS" default:"25"`
+    DBMinConns          int           `env:"DB_MIN_CONNS" default:"5"`
+    DBMaxConnLifetime   time.Duration `env:"DB_MAX_CONN_LIFETIME" default:"1h"`
+    DBMaxConnIdleTime   time.Duration `env:"DB_MAX_CONN_IDLE_TIME" default:"30m"`
+    DBHealthCheckPeriod time.Duration `env:"DB_HEALTH_CHECK_PERIOD" default:"1m"`
+    // Ограничение времени выполнения запроса на стороне сервера, 0 - без ограничения
+    DBStatementTimeout  time.Duration `env:"DB_STATEMENT_TIMEOUT" default:"30s"`
+    // Необязательная реплика для чтения
+    DatabaseReplicaURL  string        `env:"DATABASE_REPLICA_URL" secret:"true"`
+    ServerPort     string        `env:"SERVER_PORT" default:"8080"`
+    // Порт для /metrics, отдельный от API: метрики не должны быть доступны
+    // снаружи. Пустой - метрики по HTTP не отдаются
+    MetricsPort    string        `env:"METRICS_PORT"`
+    JWTSecret      string        `env:"JWT_SECRET" default:"your-secret-key-change-in-production" secret:"true"`
+    JWTExpirationHours int       `env:"JWT_EXPIRATION_HOURS" default:"24"`
     JWTExpiration  time.Duration
-    BcryptCost     int
+    BcryptCost     int           `env:"BCRYPT_COST" default:"10"`
+    // Алгоритм хеширования новых паролей: argon2id или bcrypt
+    PasswordHasher    string     `env:"PASSWORD_HASHER" default:"argon2id"`
+    Argon2Memory      int        `env:"ARGON2_MEMORY_KIB" default:"65536"`
+    Argon2Iterations  int        `env:"ARGON2_ITERATIONS" default:"3"`
+    Argon2Parallelism int        `env:"ARGON2_PARALLELISM" default:"2"`
+    OIDCProviders  []OIDCProvider
+    // CORS: список разрешённых источников через запятую, "*" - любой
+    CORSAllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS"`
+    CORSAllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE"`
+    CORSAllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,If-Match,If-None-Match"`
+    CORSAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" default:"false"`
+    CORSMaxAge           time.Duration `env:"CORS_MAX_AGE" default:"10m"`
+    // Заголовки безопасности. HSTS отправляется только по HTTPS, 0 отключает его
+    ContentSecurityPolicy string       `env:"CONTENT_SECURITY_POLICY" default:"default-src 'none'; frame-ancestors 'none'"`
+    HSTSMaxAge           time.Duration `env:"HSTS_MAX_AGE" default:"8760h"`
+    // Ограничение размера тела запроса по умолчанию (в байтах)
+    MaxBodyBytes         int           `env:"MAX_BODY_BYTES" default:"1048576"`
+    // Сайт: название и описание для лент, SITE_URL - внешний адрес блога
+    // (вместе с префиксом монтирования). Без него ссылки строятся по Host запроса
+    SiteTitle            string        `env:"SITE_TITLE" default:"Lemara Blog"`
+    SiteDescription      string        `env:"SITE_DESCRIPTION"`
+    SiteURL              string        `env:"SITE_URL"`
+    // Ленты RSS/Atom/JSON Feed: full - весь текст поста, excerpt - только начало
+    FeedContent          string        `env:"FEED_CONTENT" default:"full"`
+    FeedSize             int           `env:"FEED_SIZE" default:"20"`
+    // Допустимые реакции на посты; клиенты сопоставляют их с эмодзи
+    PostReactions        []string      `env:"POST_REACTIONS" default:"like,heart,laugh,hooray,confused,rocket"`
+    // Кеш чтения постов: none, memory (в процессе) или redis
+    CacheDriver          string        `env:"CACHE_DRIVER" default:"none"`
+    CacheTTL             time.Duration `env:"CACHE_TTL" default:"5m"`
+    // Число записей в кеше memory
+    CacheSize            int           `env:"CACHE_SIZE" default:"10000"`
+    RedisURL             string        `env:"REDIS_URL" secret:"true"`
+    // Загруженные файлы: local (каталог MEDIA_DIR) или s3
+    MediaStorage         string        `env:"MEDIA_STORAGE" default:"local"`
+    MediaDir             string        `env:"MEDIA_DIR" default:"./data/media"`
+    // Размер одного файла и квота пользователя в байтах
+    MediaMaxBytes        int           `env:"MEDIA_MAX_BYTES" default:"10485760"`
+    MediaQuotaBytes      int           `env:"MEDIA_QUOTA_BYTES" default:"104857600"`
+    // Допустимые типы (определяются по содержимому)
+    MediaAllowedTypes    []string      `env:"MEDIA_ALLOWED_TYPES" default:"image/jpeg,image/png,image/gif,image/webp"`
+    // Срок действия ссылок на приватные файлы
+    MediaURLTTL          time.Duration `env:"MEDIA_URL_TTL" default:"15m"`
+    // Варианты изображений: ширины, форматы (webp, jpeg) и качество JPEG
+    MediaImageWidths     []int         `env:"MEDIA_IMAGE_WIDTHS" default:"320,640,1024,1600"`
+    MediaImageFormats    []string      `env:"MEDIA_IMAGE_FORMATS" default:"webp,jpeg"`
+    MediaImageQuality    int           `env:"MEDIA_IMAGE_QUALITY" default:"82"`
+    // Изображения больше стольких пикселей не декодируются: маленький файл
+    // может объявить огромный размер и занять гигабайты памяти
+    MediaImageMaxPixels  int           `env:"MEDIA_IMAGE_MAX_PIXELS" default:"40000000"`
+    // Число параллельных обработчиков изображений
+    MediaWorkers         int           `env:"MEDIA_WORKERS" default:"2"`
+    // S3-совместимое хранилище (AWS S3, MinIO и т.п.)
+    S3Endpoint           string        `env:"S3_ENDPOINT"`
+    S3Region             string        `env:"S3_REGION" default:"us-east-1"`
+    S3Bucket             string        `env:"S3_BUCKET"`
+    S3AccessKeyID        string        `env:"S3_ACCESS_KEY_ID"`
+    S3SecretAccessKey    string        `env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+    S3PathStyle          bool          `env:"S3_PATH_STYLE" default:"true"`
+    // Трассировка: none, stdout или otlp. stdout пишет спаны в stderr,
+    // чтобы они не смешивались с логами
+    TracingExporter     string   `env:"TRACING_EXPORTER" default:"none"`
+    TracingOTLPEndpoint string   `env:"TRACING_OTLP_ENDPOINT"`
+    TracingOTLPInsecure bool     `env:"TRACING_OTLP_INSECURE" default:"false"`
+    TracingSampleRatio  float64  `env:"TRACING_SAMPLE_RATIO" default:"1"`
 }
 
-func Load() *Config {
-	jwtExpiration, _ := strconv.Atoi(getEnv("JWT_EXPIRATION_HOURS", "24"))
-    bcryptCost, _ := strconv.Atoi(getEnv("BCRYPT_COST", "10"))
-
-    return &Config{
-            DBHost:        getEnv("DB_HOST", "localhost"),
-            DBPort:        getEnv("DB_PORT", "5432"),
-            DBUser:        getEnv("DB_USER", "postgres"),
-            DBPassword:    getEnv("DB_PASSWORD", "postgres"),
-            DBName:        getEnv("DB_NAME", "myapp"),
-            DBSSLMode:     getEnv("DB_SSL_MODE", "disable"),
-            ServerPort:    getEnv("SERVER_PORT", "8080"),
-            JWTSecret:     getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-            JWTExpiration: time.Duration(jwtExpiration) * time.Hour,
-            BcryptCost:    bcryptCost,
+// Внешний провайдер OpenID Connect
+type OIDCProvider struct {
+    Name         string   `yaml:"name" toml:"name"`
+    Issuer       string   `yaml:"issuer" toml:"issuer"`
+    ClientID     string   `yaml:"client_id" toml:"client_id"`
+    ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+    // Путь к файлу с client_secret
+    ClientSecretFile string `yaml:"client_secret_file,omitempty" toml:"client_secret_file"`
+    RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url"`
+    Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+// Значение JWT_SECRET по умолчанию, в production запрещено
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// Load builds the configuration from defaults, an optional config file
+// (-config flag or CONFIG_FILE), the environment and command-line args.
+// Malformed values are reported as errors instead of being ignored.
+func Load(args []string) (*Config, error) {
+    cfg := &Config{}
+    fields := configFields(cfg)
+
+    for _, f := range fields {
+        if f.def != "" {
+            if err := f.set(f.def); err != nil {
+                return nil, fmt.Errorf("default for %s: %w", f.env, err)
+            }
+        }
+    }
+
+    fs, flagValues, configPath := newFlagSet(fields)
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+    if *configPath == "" {
+        *configPath = os.Getenv("CONFIG_FILE")
+    }
+
+    if *configPath != "" {
+        if err := applyFile(cfg, fields, *configPath); err != nil {
+            return nil, err
+        }
+    }
+
+    if err := applyEnv(cfg, fields); err != nil {
+        return nil, err
+    }
+    if err := applyFlags(fs, fields, flagValues); err != nil {
+        return nil, err
+    }
+
+    if cfg.LogFormat == "" {
+        cfg.LogFormat = "text"
+        if cfg.IsProduction() {
+            cfg.LogFormat = "json"
         }
+    }
+    cfg.JWTExpiration = time.Duration(cfg.JWTExpirationHours) * time.Hour
+
+    return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
-    value := os.Getenv(key)
-    if value == "" {
-        return defaultValue
+func (c *Config) IsProduction() bool {
+    return c.AppEnv == "production"
+}
+
+// DatabaseDSN returns DATABASE_URL or a URL assembled from the DB_* values
+func (c *Config) DatabaseDSN() string {
+    if c.DatabaseURL != "" {
+        return c.DatabaseURL
+    }
+
+    dsn := url.URL{
+        Scheme:   "postgres",
+        User:     url.UserPassword(c.DBUser, c.DBPassword),
+        Host:     c.DBHost + ":" + c.DBPort,
+        Path:     "/" + c.DBName,
+        RawQuery: url.Values{"sslmode": {c.DBSSLMode}}.Encode(),
     }
-    return value
+    return dsn.String()
+}
+
+// IsHelp reports whether Load failed because -h or -help was passed
+func IsHelp(err error) bool {
+    return errors.Is(err, flag.ErrHelp)
 }
@@ -0,0 +1,420 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load(t *testing.T, args ...string) *Config {
+	t.Helper()
+	cfg, err := Load(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg := load(t)
+	if cfg.DBHost != "localhost" || cfg.DBMaxConns != 25 || cfg.CacheTTL != 5*time.Minute ||
+		cfg.TracingSampleRatio != 1 || !cfg.S3PathStyle {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.LogFormat != "text" || cfg.JWTExpiration != 24*time.Hour {
+		t.Fatalf("derived values: log format %q, expiration %s", cfg.LogFormat, cfg.JWTExpiration)
+	}
+	if !reflect.DeepEqual(cfg.MediaImageWidths, []int{320, 640, 1024, 1600}) {
+		t.Fatalf("media image widths: %v", cfg.MediaImageWidths)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults must be valid outside production: %v", err)
+	}
+}
+
+// Each source overrides the previous one: defaults < file < env < flags
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", "db_host: file-host\ndb_port: \"5433\"\ndb_name: file-db\nlog_level: warn\n")
+	t.Setenv("DB_PORT", "5434")
+	t.Setenv("DB_NAME", "env-db")
+
+	cfg := load(t, "-config", path, "-db-name", "flag-db")
+	got := []string{cfg.DBHost, cfg.DBPort, cfg.DBName, cfg.LogLevel, cfg.DBUser}
+	want := []string{"file-host", "5434", "flag-db", "warn", "postgres"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yml", "db_host: env-file\n"))
+	if cfg := load(t); cfg.DBHost != "env-file" {
+		t.Fatalf("CONFIG_FILE ignored: %q", cfg.DBHost)
+	}
+
+	// -config wins over CONFIG_FILE
+	cfg := load(t, "-config", writeFile(t, "config.yaml", "db_host: flag-file\n"))
+	if cfg.DBHost != "flag-file" {
+		t.Fatalf("-config ignored: %q", cfg.DBHost)
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", `
+db_max_conns: 7
+cache_ttl: 90s
+cors_allow_credentials: true
+tracing_sample_ratio: 0.5
+cors_allowed_origins: [https://a.example, https://b.example]
+media_image_widths: [100, 200]
+oidc_providers:
+  - name: google
+    issuer: https://accounts.google.com
+    client_id: id
+    redirect_url: https://blog.example/callback
+    scopes: [openid, email]
+`},
+		{"config.toml", `
+db_max_conns = 7
+cache_ttl = "90s"
+cors_allow_credentials = true
+tracing_sample_ratio = 0.5
+cors_allowed_origins = ["https://a.example", "https://b.example"]
+media_image_widths = [100, 200]
+
+[[oidc_providers]]
+name = "google"
+issuer = "https://accounts.google.com"
+client_id = "id"
+redirect_url = "https://blog.example/callback"
+scopes = ["openid", "email"]
+`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := load(t, "-config", writeFile(t, tc.name, tc.content))
+			if cfg.DBMaxConns != 7 || cfg.CacheTTL != 90*time.Second || !cfg.CORSAllowCredentials || cfg.TracingSampleRatio != 0.5 {
+				t.Fatalf("scalars: %d %s %v %v", cfg.DBMaxConns, cfg.CacheTTL, cfg.CORSAllowCredentials, cfg.TracingSampleRatio)
+			}
+			if !reflect.DeepEqual(cfg.CORSAllowedOrigins, []string{"https://a.example", "https://b.example"}) ||
+				!reflect.DeepEqual(cfg.MediaImageWidths, []int{100, 200}) {
+				t.Fatalf("lists: %v %v", cfg.CORSAllowedOrigins, cfg.MediaImageWidths)
+			}
+			want := []OIDCProvider{{
+				Name:        "google",
+				Issuer:      "https://accounts.google.com",
+				ClientID:    "id",
+				RedirectURL: "https://blog.example/callback",
+				Scopes:      []string{"openid", "email"},
+			}}
+			if !reflect.DeepEqual(cfg.OIDCProviders, want) {
+				t.Fatalf("providers: %+v", cfg.OIDCProviders)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"config.yaml", "db_hots: x\n", `unknown key "db_hots"`},
+		{"config.yaml", "db_max_conns: many\n", "is not an integer"},
+		{"config.toml", "cache_ttl = \"soon\"\n", "is not a duration"},
+		{"config.yaml", "db_host: [unclosed\n", "parse config file"},
+		{"config.json", "{}", "unsupported format"},
+	}
+	for _, tc := range cases {
+		_, err := Load([]string{"-config", writeFile(t, tc.name, tc.content)})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s %q: got %v, want %q", tc.name, tc.content, err, tc.err)
+		}
+	}
+
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("a missing config file must fail")
+	}
+}
+
+func TestLoadMalformedValues(t *testing.T) {
+	cases := []struct {
+		env, value string
+	}{
+		{"DB_MAX_CONNS", "ten"},
+		{"CACHE_TTL", "5"},
+		{"CORS_ALLOW_CREDENTIALS", "yes please"},
+		{"TRACING_SAMPLE_RATIO", "half"},
+		{"MEDIA_IMAGE_WIDTHS", "320,wide"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.env, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			_, err := Load(nil)
+			if err == nil || !strings.HasPrefix(err.Error(), tc.env+":") {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+
+	_, err := Load([]string{"-db-max-conns", "ten"})
+	if err == nil || !strings.HasPrefix(err.Error(), "-db-max-conns:") {
+		t.Fatalf("flag: got %v", err)
+	}
+}
+
+func TestLoadLists(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_HEADERS", " Authorization , ,X-Request-ID,")
+	t.Setenv("MEDIA_IMAGE_WIDTHS", "100, 200")
+
+	cfg := load(t, "-post-reactions", "like,rocket")
+	if !reflect.DeepEqual(cfg.CORSAllowedHeaders, []string{"Authorization", "X-Request-ID"}) {
+		t.Fatalf("headers: %q", cfg.CORSAllowedHeaders)
+	}
+	if !reflect.DeepEqual(cfg.MediaImageWidths, []int{100, 200}) {
+		t.Fatalf("widths: %v", cfg.MediaImageWidths)
+	}
+	if !reflect.DeepEqual(cfg.PostReactions, []string{"like", "rocket"}) {
+		t.Fatalf("reactions: %q", cfg.PostReactions)
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	// Docker secrets end with a newline
+	envSecret := writeFile(t, "env-secret", "from-env-file\n")
+	fileSecret := writeFile(t, "file-secret", "from-config-file\r\n")
+	flagSecret := writeFile(t, "flag-secret", "from-flag-file")
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("JWT_SECRET_FILE", envSecret)
+		if cfg := load(t); cfg.JWTSecret != "from-env-file" {
+			t.Fatalf("got %q", cfg.JWTSecret)
+		}
+	})
+
+	t.Run("config file", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", "jwt_secret_file: "+fileSecret+"\n")
+		if cfg := load(t, "-config", path); cfg.JWTSecret != "from-config-file" {
+			t.Fatalf("got %q", cfg.JWTSecret)
+		}
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		t.Setenv("JWT_SECRET_FILE", envSecret)
+		if cfg := load(t, "-jwt-secret-file", flagSecret); cfg.JWTSecret != "from-flag-file" {
+			t.Fatalf("got %q", cfg.JWTSecret)
+		}
+	})
+
+	t.Run("plain value wins over the file of the same source", func(t *testing.T) {
+		t.Setenv("JWT_SECRET_FILE", envSecret)
+		t.Setenv("JWT_SECRET", "plain")
+		if cfg := load(t); cfg.JWTSecret != "plain" {
+			t.Fatalf("got %q", cfg.JWTSecret)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+		_, err := Load(nil)
+		if err == nil || !strings.HasPrefix(err.Error(), "DB_PASSWORD_FILE:") {
+			t.Fatalf("got %v", err)
+		}
+	})
+
+	t.Run("only for secrets", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", "db_host_file: "+fileSecret+"\n")
+		if _, err := Load([]string{"-config", path}); err == nil {
+			t.Fatal("db_host_file must be an unknown key")
+		}
+		if _, err := Load([]string{"-db-host-file", fileSecret}); err == nil {
+			t.Fatal("-db-host-file must be an unknown flag")
+		}
+	})
+}
+
+func TestLoadOIDCProvidersFromEnv(t *testing.T) {
+	secret := writeFile(t, "client-secret", "s3cret\n")
+	t.Setenv("OIDC_PROVIDERS", "Google, gitlab")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "google-id")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET_FILE", secret)
+	t.Setenv("OIDC_GOOGLE_SCOPES", "openid email,profile")
+	t.Setenv("OIDC_GITLAB_CLIENT_SECRET", "plain")
+
+	// Providers from the environment replace those of the config file
+	path := writeFile(t, "config.yaml", "oidc_providers:\n  - name: other\n")
+	cfg := load(t, "-config", path)
+	if len(cfg.OIDCProviders) != 2 {
+		t.Fatalf("providers: %+v", cfg.OIDCProviders)
+	}
+	google, gitlab := cfg.OIDCProviders[0], cfg.OIDCProviders[1]
+	if google.Name != "google" || google.ClientID != "google-id" || google.ClientSecret != "s3cret" ||
+		!reflect.DeepEqual(google.Scopes, []string{"openid", "email", "profile"}) {
+		t.Fatalf("google: %+v", google)
+	}
+	if gitlab.Name != "gitlab" || gitlab.ClientSecret != "plain" {
+		t.Fatalf("gitlab: %+v", gitlab)
+	}
+}
+
+func TestLogFormatDefault(t *testing.T) {
+	if cfg := load(t, "-app-env", "production"); cfg.LogFormat != "json" {
+		t.Fatalf("production: %q", cfg.LogFormat)
+	}
+	if cfg := load(t, "-app-env", "production", "-log-format", "text"); cfg.LogFormat != "text" {
+		t.Fatalf("explicit: %q", cfg.LogFormat)
+	}
+}
+
+func TestIsHelp(t *testing.T) {
+	_, err := Load([]string{"-h"})
+	if !IsHelp(err) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(c *Config)
+		// Substrings of the expected errors; none for a valid config
+		errors []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"enumerations", func(c *Config) {
+			c.AppEnv = "prod"
+			c.LogLevel = "trace"
+			c.CacheDriver = "memcached"
+		}, []string{"APP_ENV:", "LOG_LEVEL:", "CACHE_DRIVER:"}},
+		{"ports", func(c *Config) { c.ServerPort = "70000"; c.DBPort = "db" }, []string{"SERVER_PORT:", "DB_PORT:"}},
+		{"metrics port", func(c *Config) { c.MetricsPort = "9090" }, nil},
+		{"invalid metrics port", func(c *Config) { c.MetricsPort = "metrics" }, []string{"METRICS_PORT: \"metrics\""}},
+		{"metrics on the API port", func(c *Config) { c.MetricsPort = c.ServerPort }, []string{"METRICS_PORT: must differ"}},
+		{"database url replaces DB_*", func(c *Config) {
+			c.DatabaseURL = "postgres://u:p@db/app"
+			c.DBHost = ""
+			c.DBPort = "x"
+		}, nil},
+		{"database url scheme", func(c *Config) { c.DatabaseURL = "mysql://db/app" }, []string{"DATABASE_URL:"}},
+		{"pool sizes", func(c *Config) { c.DBMinConns = 30 }, []string{"DB_MIN_CONNS:"}},
+		{"cors wildcard with credentials", func(c *Config) {
+			c.CORSAllowedOrigins = []string{"*"}
+			c.CORSAllowCredentials = true
+		}, []string{"CORS_ALLOW_CREDENTIALS:"}},
+		{"cors origin with path", func(c *Config) {
+			c.CORSAllowedOrigins = []string{"https://a.example/app"}
+		}, []string{"CORS_ALLOWED_ORIGINS:"}},
+		{"reactions", func(c *Config) { c.PostReactions = []string{"like", "Thumbs Up"} }, []string{"POST_REACTIONS:"}},
+		{"media", func(c *Config) {
+			c.MediaImageWidths = []int{320, 0}
+			c.MediaImageFormats = []string{"png"}
+			c.MediaURLTTL = 8 * 24 * time.Hour
+		}, []string{"MEDIA_IMAGE_WIDTHS:", "MEDIA_IMAGE_FORMATS:", "MEDIA_URL_TTL:"}},
+		{"s3 settings", func(c *Config) {
+			c.MediaStorage = "s3"
+			c.S3Endpoint = "minio:9000"
+		}, []string{"S3_ENDPOINT:", "S3_BUCKET:", "S3_ACCESS_KEY_ID"}},
+		{"redis url", func(c *Config) { c.CacheDriver = "redis" }, []string{"REDIS_URL:"}},
+		{"oidc provider", func(c *Config) {
+			c.OIDCProviders = []OIDCProvider{{Name: "google"}}
+		}, []string{"google: issuer", "google: client_id", "google: redirect_url"}},
+		{"development allows defaults", func(c *Config) {
+			c.JWTSecret = defaultJWTSecret
+			c.DBHost = "db.example"
+		}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := load(t)
+			tc.modify(cfg)
+			checkErrors(t, cfg.Validate(), tc.errors)
+		})
+	}
+}
+
+// Production refuses development defaults
+func TestValidateProduction(t *testing.T) {
+	secret := strings.Repeat("s", 32)
+	production := func(c *Config) {
+		c.AppEnv = "production"
+		c.JWTSecret = secret
+		c.DBPassword = "strong"
+	}
+
+	cases := []struct {
+		name   string
+		modify func(c *Config)
+		errors []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"default secret", func(c *Config) { c.JWTSecret = defaultJWTSecret }, []string{"JWT_SECRET: the default"}},
+		{"short secret", func(c *Config) { c.JWTSecret = "short" }, []string{"JWT_SECRET: must be at least 32"}},
+		{"default password", func(c *Config) { c.DBPassword = "postgres" }, []string{"DB_PASSWORD:"}},
+		{"default password in database url", func(c *Config) {
+			c.DBPassword = "postgres"
+			c.DatabaseURL = "postgres://u:p@db/app"
+		}, nil},
+		{"ssl disabled for a remote database", func(c *Config) { c.DBHost = "db.example" }, []string{"DB_SSL_MODE:"}},
+		{"ssl required for a remote database", func(c *Config) {
+			c.DBHost = "db.example"
+			c.DBSSLMode = "require"
+		}, nil},
+		{"oidc redirect over http", func(c *Config) {
+			c.OIDCProviders = []OIDCProvider{{
+				Name:        "google",
+				Issuer:      "https://accounts.google.com",
+				ClientID:    "id",
+				RedirectURL: "http://blog.example/callback",
+			}}
+		}, []string{"google: redirect_url must use https"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := load(t)
+			production(cfg)
+			tc.modify(cfg)
+			checkErrors(t, cfg.Validate(), tc.errors)
+		})
+	}
+}
+
+// checkErrors expects exactly the listed problems, each on its own line
+func checkErrors(t *testing.T, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("no error, want %q", want)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(lines), len(want), err)
+	}
+	for _, substr := range want {
+		if !strings.Contains(err.Error(), substr) {
+			t.Errorf("missing %q in:\n%v", substr, err)
+		}
+	}
+}
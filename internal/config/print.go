@@ -0,0 +1,67 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+// Print writes the effective configuration as YAML in the same format the
+// config file accepts. Secrets are replaced with [REDACTED].
+func (c *Config) Print(w io.Writer) error {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value any) error {
+		var v yaml.Node
+		if err := v.Encode(value); err != nil {
+			return err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &v)
+		return nil
+	}
+
+	for _, f := range configFields(c) {
+		value := f.value.Interface()
+		if f.secret && f.String() != "" {
+			value = redacted
+			if f.env == "DATABASE_URL" || f.env == "DATABASE_REPLICA_URL" || f.env == "REDIS_URL" {
+				value = redactURL(f.String())
+			}
+		}
+		if err := add(f.key(), value); err != nil {
+			return err
+		}
+	}
+
+	providers := make([]OIDCProvider, len(c.OIDCProviders))
+	for i, p := range c.OIDCProviders {
+		if p.ClientSecret != "" {
+			p.ClientSecret = redacted
+		}
+		providers[i] = p
+	}
+	if err := add("oidc_providers", providers); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redactURL keeps the host and database visible, only the password is hidden
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a Config field that can be set from a file, env or flag
+type field struct {
+	env    string
+	def    string
+	secret bool
+	value  reflect.Value
+}
+
+// key in config files, e.g. "db_host"
+func (f field) key() string {
+	return strings.ToLower(f.env)
+}
+
+// command-line flag name, e.g. "db-host"
+func (f field) flag() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+func (f field) set(raw string) error {
+	if f.value.Type() == durationType {
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration (e.g. 30s, 5m)", raw)
+		}
+		f.value.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		// Lists are comma-separated in env and flags
+		items := splitList(raw)
+		if f.value.Type().Elem().Kind() != reflect.Int {
+			f.value.Set(reflect.ValueOf(items))
+			break
+		}
+		numbers := make([]int, len(items))
+		for i, item := range items {
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("%q is not an integer", item)
+			}
+			numbers[i] = n
+		}
+		f.value.Set(reflect.ValueOf(numbers))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		f.value.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
+
+func (f field) String() string {
+	return fmt.Sprint(f.value.Interface())
+}
+
+func configFields(cfg *Config) []field {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		fields = append(fields, field{
+			env:    env,
+			def:    sf.Tag.Get("default"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+func newFlagSet(fields []field) (*flag.FlagSet, map[string]*string, *string) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a YAML or TOML config file")
+
+	values := make(map[string]*string)
+	for _, f := range fields {
+		values[f.flag()] = fs.String(f.flag(), "", "overrides "+f.env)
+		if f.secret {
+			values[f.flag()+"-file"] = fs.String(f.flag()+"-file", "", "read "+f.env+" from a file")
+		}
+	}
+	return fs, values, configPath
+}
+
+func applyFile(cfg *Config, fields []field, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	known := make(map[string]field, len(fields))
+	for _, f := range fields {
+		known[f.key()] = f
+	}
+
+	for key, value := range raw {
+		if key == "oidc_providers" {
+			providers, err := decodeProviders(value)
+			if err != nil {
+				return fmt.Errorf("config file %s: oidc_providers: %w", path, err)
+			}
+			cfg.OIDCProviders = providers
+			continue
+		}
+
+		if name, ok := strings.CutSuffix(key, "_file"); ok && known[name].secret {
+			if err := setFromFile(known[name], fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("config file %s: %s: %w", path, key, err)
+			}
+			continue
+		}
+
+		f, ok := known[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key %q", path, key)
+		}
+		if err := f.set(fileValue(value)); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+	}
+
+	return resolveProviderSecrets(cfg.OIDCProviders)
+}
+
+// fileValue turns a decoded file value into the string form used by env
+func fileValue(value any) string {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// decodeProviders converts the generic oidc_providers list of a config file
+// by round-tripping it through YAML
+func decodeProviders(value any) ([]OIDCProvider, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var providers []OIDCProvider
+	if err := yaml.Unmarshal(data, &providers); err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+func applyEnv(cfg *Config, fields []field) error {
+	for _, f := range fields {
+		if f.secret {
+			if path := os.Getenv(f.env + "_FILE"); path != "" {
+				if err := setFromFile(f, path); err != nil {
+					return fmt.Errorf("%s_FILE: %w", f.env, err)
+				}
+			}
+		}
+		if value := os.Getenv(f.env); value != "" {
+			if err := f.set(value); err != nil {
+				return fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	if os.Getenv("OIDC_PROVIDERS") != "" {
+		cfg.OIDCProviders = oidcProvidersFromEnv()
+		return resolveProviderSecrets(cfg.OIDCProviders)
+	}
+	return nil
+}
+
+func applyFlags(fs *flag.FlagSet, fields []field, values map[string]*string) error {
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	for _, f := range fields {
+		if f.secret && set[f.flag()+"-file"] {
+			if err := setFromFile(f, *values[f.flag()+"-file"]); err != nil {
+				return fmt.Errorf("-%s-file: %w", f.flag(), err)
+			}
+		}
+		if set[f.flag()] {
+			if err := f.set(*values[f.flag()]); err != nil {
+				return fmt.Errorf("-%s: %w", f.flag(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// Провайдеры перечисляются в OIDC_PROVIDERS через запятую, настройки каждого
+// берутся из OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID и т.д.
+func oidcProvidersFromEnv() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProvider{
+			Name:             strings.ToLower(name),
+			Issuer:           os.Getenv(prefix + "ISSUER"),
+			ClientID:         os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:     os.Getenv(prefix + "CLIENT_SECRET"),
+			ClientSecretFile: os.Getenv(prefix + "CLIENT_SECRET_FILE"),
+			RedirectURL:      os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:           splitList(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), " ", ",")),
+		})
+	}
+	return providers
+}
+
+func resolveProviderSecrets(providers []OIDCProvider) error {
+	for i := range providers {
+		if providers[i].ClientSecretFile == "" {
+			continue
+		}
+		secret, err := readSecretFile(providers[i].ClientSecretFile)
+		if err != nil {
+			return fmt.Errorf("oidc provider %s: client secret: %w", providers[i].Name, err)
+		}
+		providers[i].ClientSecret = secret
+	}
+	return nil
+}
+
+func setFromFile(f field, path string) error {
+	secret, err := readSecretFile(path)
+	if err != nil {
+		return err
+	}
+	return f.set(secret)
+}
+
+// Secret files (Docker/Kubernetes secrets) usually end with a newline
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
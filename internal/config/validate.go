@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reactionPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Validate checks the values that Load can't reject on its own (ranges,
+// enumerations) and refuses to run production with development defaults.
+// All problems are reported at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(oneOf(c.AppEnv, "development", "test", "staging", "production"),
+		"APP_ENV: must be one of development, test, staging, production, got %q", c.AppEnv)
+	check(oneOf(c.LogLevel, "debug", "info", "warn", "error"),
+		"LOG_LEVEL: must be one of debug, info, warn, error, got %q", c.LogLevel)
+	check(oneOf(c.LogFormat, "json", "text"),
+		"LOG_FORMAT: must be json or text, got %q", c.LogFormat)
+
+	check(isPort(c.ServerPort), "SERVER_PORT: %q is not a valid port", c.ServerPort)
+	if c.MetricsPort != "" {
+		check(isPort(c.MetricsPort), "METRICS_PORT: %q is not a valid port", c.MetricsPort)
+		check(c.MetricsPort != c.ServerPort, "METRICS_PORT: must differ from SERVER_PORT")
+	}
+	if c.DatabaseURL != "" {
+		u, err := url.Parse(c.DatabaseURL)
+		check(err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql"),
+			"DATABASE_URL: must be a postgres:// URL")
+	} else {
+		check(c.DBHost != "", "DB_HOST: must not be empty")
+		check(isPort(c.DBPort), "DB_PORT: %q is not a valid port", c.DBPort)
+		check(c.DBName != "", "DB_NAME: must not be empty")
+		check(oneOf(c.DBSSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+			"DB_SSL_MODE: unknown mode %q", c.DBSSLMode)
+	}
+
+	check(c.DBMaxConns > 0, "DB_MAX_CONNS: must be positive")
+	check(c.DBMinConns >= 0 && c.DBMinConns <= c.DBMaxConns, "DB_MIN_CONNS: must be between 0 and DB_MAX_CONNS")
+	check(c.DBMaxConnLifetime >= 0, "DB_MAX_CONN_LIFETIME: must not be negative")
+	check(c.DBMaxConnIdleTime >= 0, "DB_MAX_CONN_IDLE_TIME: must not be negative")
+	check(c.DBHealthCheckPeriod >= 0, "DB_HEALTH_CHECK_PERIOD: must not be negative")
+	check(c.DBStatementTimeout >= 0, "DB_STATEMENT_TIMEOUT: must not be negative")
+	if c.DatabaseReplicaURL != "" {
+		u, err := url.Parse(c.DatabaseReplicaURL)
+		check(err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql"),
+			"DATABASE_REPLICA_URL: must be a postgres:// URL")
+	}
+
+	check(c.JWTSecret != "", "JWT_SECRET: must not be empty")
+	check(c.JWTExpirationHours > 0, "JWT_EXPIRATION_HOURS: must be positive")
+
+	check(oneOf(c.PasswordHasher, "argon2id", "bcrypt"),
+		"PASSWORD_HASHER: must be argon2id or bcrypt, got %q", c.PasswordHasher)
+	check(c.BcryptCost >= 4 && c.BcryptCost <= 31, "BCRYPT_COST: must be between 4 and 31")
+	check(c.Argon2Memory >= 8*c.Argon2Parallelism && c.Argon2Memory > 0,
+		"ARGON2_MEMORY_KIB: must be at least 8 KiB per thread")
+	check(c.Argon2Iterations > 0, "ARGON2_ITERATIONS: must be positive")
+	check(c.Argon2Parallelism > 0 && c.Argon2Parallelism <= 255, "ARGON2_PARALLELISM: must be between 1 and 255")
+
+	for _, p := range c.OIDCProviders {
+		check(p.Name != "", "OIDC provider: name is required")
+		check(p.Issuer != "", "OIDC provider %s: issuer is required", p.Name)
+		check(p.ClientID != "", "OIDC provider %s: client_id is required", p.Name)
+		check(p.RedirectURL != "", "OIDC provider %s: redirect_url is required", p.Name)
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || (err == nil && u.Scheme != "" && u.Host != "" && u.Path == ""),
+			"CORS_ALLOWED_ORIGINS: %q must be \"*\" or scheme://host[:port]", origin)
+		check(!(origin == "*" && c.CORSAllowCredentials),
+			"CORS_ALLOW_CREDENTIALS: can't be combined with the \"*\" origin")
+	}
+	check(c.CORSMaxAge >= 0, "CORS_MAX_AGE: must not be negative")
+	check(c.HSTSMaxAge >= 0, "HSTS_MAX_AGE: must not be negative")
+	check(c.MaxBodyBytes > 0, "MAX_BODY_BYTES: must be positive")
+
+	if c.SiteURL != "" {
+		u, err := url.Parse(c.SiteURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"SITE_URL: must be an absolute http(s) URL")
+	}
+	check(oneOf(c.FeedContent, "full", "excerpt"),
+		"FEED_CONTENT: must be full or excerpt, got %q", c.FeedContent)
+	check(c.FeedSize > 0 && c.FeedSize <= 100, "FEED_SIZE: must be between 1 and 100")
+
+	check(len(c.PostReactions) > 0, "POST_REACTIONS: at least one reaction is required")
+	for _, kind := range c.PostReactions {
+		check(reactionPattern.MatchString(kind),
+			"POST_REACTIONS: %q must be lowercase letters, digits and underscores, at most 32", kind)
+	}
+
+	check(oneOf(c.CacheDriver, "none", "memory", "redis"),
+		"CACHE_DRIVER: must be none, memory or redis, got %q", c.CacheDriver)
+	check(c.CacheTTL > 0, "CACHE_TTL: must be positive")
+	check(c.CacheDriver != "memory" || c.CacheSize > 0, "CACHE_SIZE: must be positive")
+	check(c.CacheDriver != "redis" || c.RedisURL != "", "REDIS_URL: required for the redis cache")
+
+	check(oneOf(c.MediaStorage, "local", "s3"),
+		"MEDIA_STORAGE: must be local or s3, got %q", c.MediaStorage)
+	check(c.MediaStorage != "local" || c.MediaDir != "", "MEDIA_DIR: required for the local media storage")
+	check(c.MediaMaxBytes > 0, "MEDIA_MAX_BYTES: must be positive")
+	check(c.MediaQuotaBytes > 0, "MEDIA_QUOTA_BYTES: must be positive")
+	check(len(c.MediaAllowedTypes) > 0, "MEDIA_ALLOWED_TYPES: at least one type is required")
+	// S3 presigned URLs live at most seven days
+	check(c.MediaURLTTL >= time.Second && c.MediaURLTTL <= 7*24*time.Hour,
+		"MEDIA_URL_TTL: must be between 1s and 168h")
+	for _, width := range c.MediaImageWidths {
+		check(width > 0, "MEDIA_IMAGE_WIDTHS: widths must be positive, got %d", width)
+	}
+	for _, format := range c.MediaImageFormats {
+		check(oneOf(format, "webp", "jpeg"), "MEDIA_IMAGE_FORMATS: must be webp or jpeg, got %q", format)
+	}
+	check(c.MediaImageQuality >= 1 && c.MediaImageQuality <= 100, "MEDIA_IMAGE_QUALITY: must be between 1 and 100")
+	check(c.MediaImageMaxPixels > 0, "MEDIA_IMAGE_MAX_PIXELS: must be positive")
+	check(c.MediaWorkers > 0, "MEDIA_WORKERS: must be positive")
+	if c.MediaStorage == "s3" {
+		u, err := url.Parse(c.S3Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"S3_ENDPOINT: must be an absolute http(s) URL")
+		check(c.S3Bucket != "", "S3_BUCKET: required for the s3 media storage")
+		check(c.S3Region != "", "S3_REGION: required for the s3 media storage")
+		check(c.S3AccessKeyID != "" && c.S3SecretAccessKey != "",
+			"S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY: required for the s3 media storage")
+	}
+
+	check(oneOf(c.TracingExporter, "none", "stdout", "otlp"),
+		"TRACING_EXPORTER: must be none, stdout or otlp, got %q", c.TracingExporter)
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1,
+		"TRACING_SAMPLE_RATIO: must be between 0 and 1")
+
+	if c.IsProduction() {
+		check(c.JWTSecret != defaultJWTSecret, "JWT_SECRET: the default secret is not allowed in production")
+		check(len(c.JWTSecret) >= 32, "JWT_SECRET: must be at least 32 characters in production")
+		check(c.DatabaseURL != "" || c.DBPassword != "postgres",
+			"DB_PASSWORD: the default password is not allowed in production")
+		check(c.DBSSLMode != "disable" || c.DatabaseURL != "" || isLocalHost(c.DBHost),
+			"DB_SSL_MODE: disable is not allowed for remote databases in production")
+		for _, p := range c.OIDCProviders {
+			check(strings.HasPrefix(p.RedirectURL, "https://"),
+				"OIDC provider %s: redirect_url must use https in production", p.Name)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isPort(value string) bool {
+	n, err := strconv.Atoi(value)
+	return err == nil && n > 0 && n < 65536
+}
+
+func isLocalHost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"lemara_blog/internal/tracing"
+)
+
+// PoolConfig holds the connection pool settings shared by the primary and
+// replica pools. Zero values keep the pgxpool defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// StatementTimeout is applied server-side to every statement, 0 disables it
+	StatementTimeout time.Duration
+}
+
+// NewPool connects to dsn with the given settings. Read-only pools open
+// every transaction as READ ONLY so writes routed there by mistake fail.
+func NewPool(ctx context.Context, dsn string, cfg PoolConfig, readOnly bool) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	params := poolConfig.ConnConfig.RuntimeParams
+	if cfg.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if readOnly {
+		params["default_transaction_read_only"] = "on"
+	}
+	poolConfig.ConnConfig.Tracer = tracing.NewPgxTracer()
+
+	return pgxpool.NewWithConfig(ctx, poolConfig)
+}
+
+// Cluster routes queries between the primary and an optional read replica.
+//
+// Repositories call Writer for statements that modify data and Reader for
+// queries that tolerate replication lag. Once a request has written through
+// Writer, its later Reader calls go to the primary too, so it always sees
+// its own writes (see WithSession).
+type Cluster struct {
+	primary *pgxpool.Pool
+	replica *pgxpool.Pool
+}
+
+// NewCluster creates a cluster; replica may be nil, then all queries go to
+// the primary
+func NewCluster(primary, replica *pgxpool.Pool) *Cluster {
+	return &Cluster{primary: primary, replica: replica}
+}
+
+func (c *Cluster) Primary() *pgxpool.Pool {
+	return c.primary
+}
+
+// Replica returns the replica pool or nil if none is configured
+func (c *Cluster) Replica() *pgxpool.Pool {
+	return c.replica
+}
+
+// Writer returns the primary pool and pins the rest of the session to it.
+// Inside WithinTx it returns the transaction instead.
+func (c *Cluster) Writer(ctx context.Context) Querier {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	return c.primary
+}
+
+// Reader returns the replica unless there is none, the session has already
+// written to the primary or a transaction is in progress
+func (c *Cluster) Reader(ctx context.Context) Querier {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	if c.replica == nil || usesPrimary(ctx) {
+		return c.primary
+	}
+	return c.replica
+}
+
+// Conn returns the primary (or the current transaction) for reads that must
+// not see replication lag, without pinning the session
+func (c *Cluster) Conn(ctx context.Context) Querier {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx
+	}
+	return c.primary
+}
+
+func (c *Cluster) Close() {
+	c.primary.Close()
+	if c.replica != nil {
+		c.replica.Close()
+	}
+}
+
+type sessionKey struct{}
+
+type primaryKey struct{}
+
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession starts a read-your-writes session, typically one per HTTP
+// request. Without a session every Reader call may hit the replica.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// UsePrimary forces every query made with ctx to go to the primary
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether reads made with ctx must see the latest data:
+// inside a transaction, after UsePrimary or after the session has written.
+// Read caches are bypassed in that case too.
+func UsesPrimary(ctx context.Context) bool {
+	if _, ok := txFromContext(ctx); ok {
+		return true
+	}
+	return usesPrimary(ctx)
+}
+
+func usesPrimary(ctx context.Context) bool {
+	if forced, _ := ctx.Value(primaryKey{}).(bool); forced {
+		return true
+	}
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
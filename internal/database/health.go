@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"lemara_blog/internal/health"
+)
+
+// PingChecker checks that the pool can reach the database
+func PingChecker(name string, pool *pgxpool.Pool) health.Checker {
+	return health.NewChecker(name, pool.Ping)
+}
+
+// MigrationsChecker fails while any embedded migration is not applied
+func MigrationsChecker(pool *pgxpool.Pool) health.Checker {
+	return health.NewChecker("migrations", func(ctx context.Context) error {
+		pending, err := Pending(ctx, pool)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+		}
+		return nil
+	})
+}
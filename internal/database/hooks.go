@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"sync"
+)
+
+type hooksKey struct{}
+
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// AfterCommit runs fn once the unit of work in ctx commits, or right away
+// outside of one. Cache invalidation uses it: invalidating before commit
+// would let a concurrent reader cache the old row again.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(hooksKey{}).(*commitHooks)
+	if !ok {
+		fn()
+		return
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fns = append(hooks.fns, fn)
+}
+
+// CollectCommitHooks starts collecting AfterCommit callbacks for a unit of
+// work. The transaction manager calls run after a successful commit and
+// simply drops the callbacks on rollback.
+func CollectCommitHooks(ctx context.Context) (_ context.Context, run func()) {
+	hooks := &commitHooks{}
+	return context.WithValue(ctx, hooksKey{}, hooks), func() {
+		hooks.mu.Lock()
+		fns := hooks.fns
+		hooks.fns = nil
+		hooks.mu.Unlock()
+		for _, fn := range fns {
+			fn()
+		}
+	}
+}
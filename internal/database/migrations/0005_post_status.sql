@@ -0,0 +1,6 @@
+-- Existing posts were visible to everyone, so they stay published
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'published'));
+
+CREATE INDEX IF NOT EXISTS posts_published_idx ON posts (created_at DESC, id DESC) WHERE status = 'published';
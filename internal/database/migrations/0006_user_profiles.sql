@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS username   TEXT,
+    ADD COLUMN IF NOT EXISTS bio        TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS website    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+
+-- Usernames are stored lowercased. Deleted accounts keep theirs, so nobody
+-- can take over the links to a former author.
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_idx ON users (username);
+
+-- Previous usernames redirect to the current one and stay reserved for
+-- their owner
+CREATE TABLE IF NOT EXISTS username_history (
+    username   TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL REFERENCES users (id),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS username_history_user_idx ON username_history (user_id);
@@ -0,0 +1,14 @@
+-- Uploaded files. The content is kept by the file storage (local directory
+-- or S3 bucket) under storage_key.
+CREATE TABLE IF NOT EXISTS media (
+    id           UUID PRIMARY KEY,
+    owner_id     TEXT NOT NULL REFERENCES users (id),
+    storage_key  TEXT NOT NULL UNIQUE,
+    filename     TEXT NOT NULL DEFAULT '',
+    content_type TEXT NOT NULL,
+    size         BIGINT NOT NULL CHECK (size >= 0),
+    visibility   TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'private')),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS media_owner_idx ON media (owner_id, created_at DESC);
@@ -0,0 +1,13 @@
+-- Image metadata and the scaled-down variants produced in the background.
+-- Existing images are queued for processing.
+ALTER TABLE media
+    ADD COLUMN IF NOT EXISTS width      INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS height     INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS blurhash   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS variants   JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS processing TEXT NOT NULL DEFAULT ''
+        CHECK (processing IN ('', 'pending', 'ready', 'failed'));
+
+UPDATE media SET processing = 'pending' WHERE content_type LIKE 'image/%' AND processing = '';
+
+CREATE INDEX IF NOT EXISTS media_pending_idx ON media (created_at) WHERE processing = 'pending';
@@ -0,0 +1,28 @@
+-- The cover is a public image uploaded by the author; deleting the file
+-- removes the cover
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS cover_media_id UUID REFERENCES media (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS custom_excerpt TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS excerpt        TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS word_count     INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reading_time   INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS posts_cover_media_id_idx ON posts (cover_media_id) WHERE cover_media_id IS NOT NULL;
+
+-- Existing posts get approximate values: the first paragraph without Markdown
+-- stripping. The service computes the exact ones on the next edit.
+UPDATE posts
+SET excerpt = CASE
+        WHEN length(summary.paragraph) <= 280 THEN summary.paragraph
+        ELSE regexp_replace(left(summary.paragraph, 281), '\s+\S*$', '') || '…'
+    END,
+    word_count = summary.words,
+    reading_time = CEIL(summary.words / 200.0)
+FROM (
+    SELECT id,
+        regexp_replace(btrim(split_part(btrim(replace(content, E'\r\n', E'\n'), E' \t\n'), E'\n\n', 1)), '\s+', ' ', 'g') AS paragraph,
+        COALESCE(array_length(regexp_split_to_array(btrim(content, E' \t\r\n'), '\s+'), 1), 0) AS words
+    FROM posts
+    WHERE btrim(content, E' \t\r\n') <> ''
+) AS summary
+WHERE posts.id = summary.id AND posts.word_count = 0;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id    UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL REFERENCES users (id),
+    kind       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS post_reactions_user_idx ON post_reactions (user_id, post_id);
+
+-- Counters are kept in the same transaction as post_reactions, so lists of
+-- posts don't have to count rows. updated_at moves with every change of the
+-- counter: reactions don't touch posts.updated_at, but Last-Modified of a
+-- post must account for them
+CREATE TABLE IF NOT EXISTS post_reaction_counts (
+    post_id    UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL,
+    count      INTEGER NOT NULL DEFAULT 0 CHECK (count >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, kind)
+);
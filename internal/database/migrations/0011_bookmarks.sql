@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id    TEXT NOT NULL REFERENCES users (id),
+    post_id    UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_user_created_idx ON bookmarks (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS bookmarks_post_idx ON bookmarks (post_id);
+
+CREATE TABLE IF NOT EXISTS reading_lists (
+    id          UUID PRIMARY KEY,
+    owner_id    TEXT NOT NULL REFERENCES users (id),
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    -- NULL for private lists
+    share_token TEXT UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS reading_lists_owner_idx ON reading_lists (owner_id, created_at);
+
+CREATE TABLE IF NOT EXISTS reading_list_items (
+    list_id  UUID NOT NULL REFERENCES reading_lists (id) ON DELETE CASCADE,
+    post_id  UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS reading_list_items_post_idx ON reading_list_items (post_id);
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is the subset of *pgxpool.Pool and pgx.Tx that repositories use
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+func txFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// TxManager runs units of work in a primary transaction stored in the
+// context. Repositories pick the transaction up through Cluster, so they
+// don't need to know whether they run inside one.
+type TxManager struct {
+	db *Cluster
+	// begin opens a transaction on the primary; tests replace it
+	begin func(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+	// IsoLevel is the isolation level of new transactions. The default
+	// ReadCommitted never fails with serialization errors, so only deadlocks
+	// are retried there; RepeatableRead or Serializable turn concurrent
+	// updates of the same rows into serialization failures that are retried
+	// instead of silently applying both.
+	IsoLevel pgx.TxIsoLevel
+	// MaxAttempts bounds retries of transactions aborted by serialization
+	// failures or deadlocks
+	MaxAttempts int
+}
+
+// NewTxManager uses ReadCommitted: the repositories guard their invariants
+// with row locks and constraints rather than relying on retries
+func NewTxManager(db *Cluster) *TxManager {
+	return &TxManager{db: db, begin: db.primary.BeginTx, IsoLevel: pgx.ReadCommitted, MaxAttempts: 3}
+}
+
+// WithinTx calls fn with a context carrying a transaction and commits it if
+// fn returns nil. A call nested in another WithinTx joins the outer
+// transaction. If postgres aborts the transaction with a serialization
+// failure or deadlock the whole fn is retried, so fn must not have side
+// effects outside the database.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = m.run(ctx, fn)
+		if err == nil || !IsRetryable(err) || attempt >= m.MaxAttempts {
+			return err
+		}
+
+		// Short randomized backoff so competing transactions don't collide again
+		delay := time.Duration(attempt) * (10*time.Millisecond + rand.N(10*time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	// Writer pins the session to the primary so reads after the
+	// transaction see its writes
+	m.db.Writer(ctx)
+	tx, err := m.begin(ctx, pgx.TxOptions{IsoLevel: m.IsoLevel})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(context.WithoutCancel(ctx))
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback(context.WithoutCancel(ctx))
+		}
+	}()
+
+	txCtx, runHooks := CollectCommitHooks(context.WithValue(ctx, txKey{}, tx))
+	if err := fn(txCtx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	runHooks()
+	return nil
+}
+
+// IsRetryable reports whether err aborted a transaction that can safely be
+// run again: serialization_failure (40001) or deadlock_detected (40P01)
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeTx records how a transaction ended; the embedded interface panics on
+// anything else
+type fakeTx struct {
+	pgx.Tx
+	commitErr  error
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	if tx.commitErr != nil {
+		return tx.commitErr
+	}
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	tx.rolledBack = true
+	return nil
+}
+
+type fakePrimary struct {
+	txs  []*fakeTx
+	opts []pgx.TxOptions
+	// Commit errors of the next transactions, in order
+	commitErrs []error
+	beginErr   error
+}
+
+func (p *fakePrimary) begin(_ context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if p.beginErr != nil {
+		return nil, p.beginErr
+	}
+	tx := &fakeTx{}
+	if len(p.commitErrs) > 0 {
+		tx.commitErr, p.commitErrs = p.commitErrs[0], p.commitErrs[1:]
+	}
+	p.txs = append(p.txs, tx)
+	p.opts = append(p.opts, opts)
+	return tx, nil
+}
+
+func newTestTxManager() (*TxManager, *fakePrimary) {
+	primary := &fakePrimary{}
+	return &TxManager{db: &Cluster{}, begin: primary.begin, IsoLevel: pgx.ReadCommitted, MaxAttempts: 3}, primary
+}
+
+var (
+	errSerialization = &pgconn.PgError{Code: "40001"}
+	errDeadlock      = &pgconn.PgError{Code: "40P01"}
+	errUnique        = &pgconn.PgError{Code: "23505"}
+)
+
+func TestWithinTxCommit(t *testing.T) {
+	m, primary := newTestTxManager()
+	m.IsoLevel = pgx.RepeatableRead
+
+	var inside pgx.Tx
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		var ok bool
+		inside, ok = txFromContext(ctx)
+		if !ok {
+			t.Fatal("no transaction in the context")
+		}
+		// Repositories reach the transaction through the cluster
+		if m.db.Writer(ctx) != inside || m.db.Reader(ctx) != inside || m.db.Conn(ctx) != inside {
+			t.Fatal("cluster doesn't route to the transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.txs) != 1 || inside != primary.txs[0] || !primary.txs[0].committed || primary.txs[0].rolledBack {
+		t.Fatalf("transactions %+v", primary.txs)
+	}
+	if primary.opts[0].IsoLevel != pgx.RepeatableRead {
+		t.Fatalf("isolation level %q", primary.opts[0].IsoLevel)
+	}
+}
+
+func TestWithinTxRollback(t *testing.T) {
+	m, primary := newTestTxManager()
+	failure := errors.New("failure")
+
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("got %v", err)
+	}
+	if tx := primary.txs[0]; tx.committed || !tx.rolledBack {
+		t.Fatalf("transaction %+v", tx)
+	}
+
+	// A failed commit is rolled back too
+	primary.commitErrs = []error{errUnique}
+	err = m.WithinTx(context.Background(), func(ctx context.Context) error { return nil })
+	if !errors.Is(err, errUnique) || !primary.txs[1].rolledBack {
+		t.Fatalf("commit failure: %v, %+v", err, primary.txs[1])
+	}
+
+	primary.beginErr = errors.New("no connection")
+	called := false
+	err = m.WithinTx(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Fatalf("begin failure: %v, fn called: %v", err, called)
+	}
+}
+
+func TestWithinTxPanic(t *testing.T) {
+	m, primary := newTestTxManager()
+
+	defer func() {
+		if recover() != "boom" {
+			t.Fatal("the panic must propagate")
+		}
+		if tx := primary.txs[0]; tx.committed || !tx.rolledBack {
+			t.Fatalf("transaction %+v", tx)
+		}
+	}()
+	m.WithinTx(context.Background(), func(ctx context.Context) error {
+		panic("boom")
+	})
+}
+
+func TestWithinTxNested(t *testing.T) {
+	m, primary := newTestTxManager()
+	failure := errors.New("failure")
+
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		outer, _ := txFromContext(ctx)
+		return m.WithinTx(ctx, func(ctx context.Context) error {
+			if inner, _ := txFromContext(ctx); inner != outer {
+				t.Fatal("the nested call must join the outer transaction")
+			}
+			return failure
+		})
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("got %v", err)
+	}
+	// The inner failure rolls the whole unit of work back
+	if len(primary.txs) != 1 || !primary.txs[0].rolledBack || primary.txs[0].committed {
+		t.Fatalf("transactions %+v", primary.txs)
+	}
+
+	// A nested call is never retried on its own: only the outermost
+	// WithinTx can restart the transaction
+	attempts := 0
+	err = m.WithinTx(context.Background(), func(ctx context.Context) error {
+		return m.WithinTx(ctx, func(ctx context.Context) error {
+			attempts++
+			return errDeadlock
+		})
+	})
+	if !errors.Is(err, errDeadlock) || attempts != m.MaxAttempts || len(primary.txs) != 1+m.MaxAttempts {
+		t.Fatalf("got %v after %d attempts, %d transactions", err, attempts, len(primary.txs))
+	}
+}
+
+func TestWithinTxAfterCommit(t *testing.T) {
+	m, _ := newTestTxManager()
+
+	var calls []string
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, func() { calls = append(calls, "first") })
+		err := m.WithinTx(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, func() { calls = append(calls, "nested") })
+			return nil
+		})
+		if len(calls) != 0 {
+			t.Fatal("hooks must wait for the commit")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "nested" {
+		t.Fatalf("calls %v", calls)
+	}
+
+	// Hooks of a rolled back transaction are dropped
+	calls = nil
+	m.WithinTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, func() { calls = append(calls, "rolled back") })
+		return errors.New("failure")
+	})
+	if len(calls) != 0 {
+		t.Fatalf("calls %v", calls)
+	}
+
+	// Hooks of an attempt that was retried are dropped with it
+	m, primary := newTestTxManager()
+	primary.commitErrs = []error{errSerialization}
+	attempt := 0
+	err = m.WithinTx(context.Background(), func(ctx context.Context) error {
+		attempt++
+		n := attempt
+		AfterCommit(ctx, func() { calls = append(calls, "attempt "+strconv.Itoa(n)) })
+		return nil
+	})
+	if err != nil || len(calls) != 1 || calls[0] != "attempt 2" {
+		t.Fatalf("got %v, calls %v", err, calls)
+	}
+
+	// Outside a transaction the hook runs right away
+	calls = nil
+	AfterCommit(context.Background(), func() { calls = append(calls, "now") })
+	if len(calls) != 1 {
+		t.Fatalf("calls %v", calls)
+	}
+}
+
+func TestWithinTxRetries(t *testing.T) {
+	cases := []struct {
+		name string
+		// Errors returned by fn on successive attempts, nil once it succeeds
+		errs       []error
+		commitErrs []error
+		attempts   int
+		err        error
+	}{
+		{"serialization failure", []error{errSerialization, nil}, nil, 2, nil},
+		{"deadlock", []error{errDeadlock, errDeadlock, nil}, nil, 3, nil},
+		{"wrapped", []error{errors.Join(errors.New("update post"), errSerialization), nil}, nil, 2, nil},
+		{"failure at commit", []error{nil, nil}, []error{errSerialization}, 2, nil},
+		{"gives up", []error{errSerialization, errSerialization, errSerialization, nil}, nil, 3, errSerialization},
+		{"not retryable", []error{errUnique, nil}, nil, 1, errUnique},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, primary := newTestTxManager()
+			primary.commitErrs = tc.commitErrs
+
+			attempts := 0
+			err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+				attempts++
+				return tc.errs[attempts-1]
+			})
+			if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			if attempts != tc.attempts || len(primary.txs) != tc.attempts {
+				t.Fatalf("%d attempts in %d transactions, want %d", attempts, len(primary.txs), tc.attempts)
+			}
+			// Every attempt runs in a fresh transaction; failed ones are rolled back
+			for i, tx := range primary.txs {
+				last := i == len(primary.txs)-1
+				if tx.committed != (last && tc.err == nil) || tx.rolledBack == tx.committed {
+					t.Fatalf("transaction %d: %+v", i, tx)
+				}
+			}
+		})
+	}
+}
+
+func TestWithinTxRetryCanceled(t *testing.T) {
+	m, _ := newTestTxManager()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err := m.WithinTx(ctx, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return errDeadlock
+	})
+	if attempts != 1 || !errors.Is(err, errDeadlock) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{errSerialization, true},
+		{errDeadlock, true},
+		{errors.Join(errors.New("context"), errDeadlock), true},
+		{errUnique, false},
+		{&pgconn.PgError{Code: "40P02"}, false},
+		{errors.New("40001"), false},
+		{nil, false},
+	}
+	for _, tc := range cases {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("IsRetryable(%v) = %v", tc.err, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Закладки и списки для чтения
+
+var (
+	ErrReadingListNotFound = NotFound("reading_list_not_found", "Reading list not found")
+	ErrReadingListFull     = Conflict("reading_list_full", "Reading list has too many posts")
+)
+
+// BookmarkEntry is a saved post without the post itself, as stored
+type BookmarkEntry struct {
+	PostID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Bookmark struct {
+	Post         PostSearchResponse `json:"post"`
+	BookmarkedAt time.Time          `json:"bookmarked_at"`
+}
+
+type BookmarkListResponse struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+	Limit     int        `json:"limit"`
+	Offset    int        `json:"offset"`
+}
+
+// ReadingList is a named, ordered group of posts. Shared lists can be read
+// by anyone who knows ShareToken.
+type ReadingList struct {
+	ID          uuid.UUID
+	OwnerID     string
+	Name        string
+	Description string
+	ShareToken  string // пусто у приватных списков
+	PostCount   int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (l *ReadingList) IsShared() bool {
+	return l.ShareToken != ""
+}
+
+type ReadingListRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	Shared      bool   `json:"shared"`
+}
+
+// Fields left out of the request are not changed. Turning sharing off and on
+// again makes a new link, the old one stops working.
+type ReadingListUpdateRequest struct {
+	Name        *string `json:"name" validate:"omitnil,required,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=500"`
+	Shared      *bool   `json:"shared"`
+}
+
+// ReadingListItemRequest adds a post to a list or moves it. Without a
+// position the post goes to the end (or stays where it is).
+type ReadingListItemRequest struct {
+	Position *int `json:"position" validate:"omitempty,min=0"`
+}
+
+// ReadingListEntry is a post of a list in its order, as stored
+type ReadingListEntry struct {
+	PostID  uuid.UUID
+	AddedAt time.Time
+}
+
+type ReadingListResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Shared      bool      `json:"shared"`
+	ShareURL    string    `json:"share_url,omitempty"`
+	PostCount   int       `json:"post_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Только в ответе для одного списка
+	Posts []ReadingListItem `json:"posts,omitempty"`
+}
+
+type ReadingListItem struct {
+	Post    PostSearchResponse `json:"post"`
+	AddedAt time.Time          `json:"added_at"`
+}
+
+type ReadingListsResponse struct {
+	Lists []ReadingListResponse `json:"lists"`
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"errors"
+)
+
+// Категории ошибок, которые обработчики превращают в HTTP-статусы
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	// Условие запроса (If-Match) не выполнено
+	ErrPrecondition = errors.New("precondition failed")
+	ErrTooLarge     = errors.New("too large")
+	// Тип содержимого не поддерживается
+	ErrUnsupportedType = errors.New("unsupported type")
+)
+
+// Error is returned by services and repositories for failures the client can
+// act on. Code is stable and meant for machines, Message for humans.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+}
+
+// FieldError describes a problem with a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// errors.Is(err, domain.ErrNotFound) matches every not-found error
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: ErrForbidden, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: ErrUnauthorized, Code: code, Message: message}
+}
+
+func PreconditionFailed(code, message string) *Error {
+	return &Error{Kind: ErrPrecondition, Code: code, Message: message}
+}
+
+func TooLarge(code, message string) *Error {
+	return &Error{Kind: ErrTooLarge, Code: code, Message: message}
+}
+
+func UnsupportedType(code, message string) *Error {
+	return &Error{Kind: ErrUnsupportedType, Code: code, Message: message}
+}
+
+func Validation(fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: "Request validation failed", Fields: fields}
+}
+
+// Общие ошибки предметной области
+var (
+	ErrUserNotFound       = NotFound("user_not_found", "User not found")
+	ErrPostNotFound       = NotFound("post_not_found", "Post not found")
+	ErrNotPostAuthor      = Forbidden("not_post_author", "Only the author can change this post")
+	ErrPostModified       = PreconditionFailed("post_modified", "Post was modified by another request")
+	ErrInvalidCover       = Validation(FieldError{Field: "cover_image_id", Code: "cover_image", Message: "cover_image_id must be a public image uploaded by the author"})
+	ErrEmailTaken         = Conflict("email_taken", "Email already in use")
+	ErrUsernameTaken      = Conflict("username_taken", "Username already in use")
+	ErrInvalidCredentials = Unauthorized("invalid_credentials", "Invalid credentials")
+)
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+)
+
+var ErrIdentityNotFound = NotFound("identity_not_found", "External identity not found")
+
+// Identity of a user at an external OpenID Connect provider
+type UserIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Verified data received from a provider after a successful login
+type ExternalLogin struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Видимость загруженных файлов: public отдаётся всем по постоянной ссылке,
+// private - только по подписанной ссылке с ограниченным сроком
+const (
+	MediaPublic  = "public"
+	MediaPrivate = "private"
+)
+
+// Обработка изображений: варианты и blurhash готовятся в фоне
+const (
+	MediaProcessingPending = "pending"
+	MediaProcessingReady   = "ready"
+	MediaProcessingFailed  = "failed"
+)
+
+var (
+	ErrMediaNotFound      = NotFound("media_not_found", "Media not found")
+	ErrMediaTooLarge      = TooLarge("media_too_large", "File is too large")
+	ErrMediaQuotaExceeded = TooLarge("media_quota_exceeded", "Storage quota exceeded")
+	ErrMediaType          = UnsupportedType("unsupported_media_type", "File type is not allowed")
+	ErrInvalidImage       = UnsupportedType("invalid_image", "File is not a valid image")
+	ErrImageTooLarge      = TooLarge("image_too_large", "Image has too many pixels")
+)
+
+// Media is an uploaded file. The content lives in the file storage under
+// StorageKey, the row only describes it.
+type Media struct {
+	ID          uuid.UUID
+	OwnerID     string
+	StorageKey  string
+	Filename    string
+	ContentType string
+	Size        int64
+	Visibility  string
+	Width       int // только для изображений
+	Height      int
+	Blurhash    string
+	Variants    []MediaVariant
+	Processing  string // пусто, если файл не требует обработки
+	CreatedAt   time.Time
+}
+
+// MediaVariant is a scaled-down copy of an image
+type MediaVariant struct {
+	// Name identifies the variant among those of the media, e.g. "w640.webp"
+	Name        string `json:"name"`
+	StorageKey  string `json:"storage_key"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+func (m *Media) IsPrivate() bool {
+	return m.Visibility == MediaPrivate
+}
+
+// Variant finds a variant by its name
+func (m *Media) Variant(name string) (*MediaVariant, bool) {
+	for i := range m.Variants {
+		if m.Variants[i].Name == name {
+			return &m.Variants[i], true
+		}
+	}
+	return nil, false
+}
+
+// MediaUploadRequest holds the form fields sent along with the file
+type MediaUploadRequest struct {
+	Filename   string `json:"filename" validate:"max=255"`
+	Visibility string `json:"visibility" validate:"omitempty,oneof=public private"`
+}
+
+type MediaResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	URL          string     `json:"url"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"` // только для private
+	Filename     string     `json:"filename"`
+	ContentType  string     `json:"content_type"`
+	Size         int64      `json:"size"`
+	Visibility   string     `json:"visibility"`
+	Width        int        `json:"width,omitempty"`
+	Height       int        `json:"height,omitempty"`
+	Blurhash     string     `json:"blurhash,omitempty"`
+	Processing   string     `json:"processing,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// Варианты от меньшего к большему и готовые значения srcset по типам:
+	// {"image/webp": "https://.../w320.webp 320w, ..."}
+	Variants []MediaVariantResponse `json:"variants,omitempty"`
+	SrcSet   map[string]string      `json:"srcset,omitempty"`
+}
+
+type MediaVariantResponse struct {
+	URL         string `json:"url"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type MediaListResponse struct {
+	Media  []MediaResponse `json:"media"`
+	Usage  int64           `json:"usage"` // занято байт
+	Quota  int64           `json:"quota"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
@@ -8,31 +8,102 @@ import (
 
 // Посты
 
+// Статусы поста. Черновики видит только автор
+const (
+	PostStatusDraft     = "draft"
+	PostStatusPublished = "published"
+)
+
 type Post struct {
 	ID        	uuid.UUID 		`json:"id"`
 	Title     	string 			`json:"title"`
 	Content   	string 			`json:"content"`
 	Author    	string 			`json:"author"`
+	Status    	string 			`json:"status"`
+	// Обложка - публичное изображение автора из его загрузок
+	CoverImageID	*uuid.UUID 	`json:"cover_image_id"`
+	// Анонс, заданный автором; пустой - анонс строится из текста
+	CustomExcerpt	string 		`json:"custom_excerpt"`
+	// Вычисляются в PostService при сохранении
+	Excerpt   	string 			`json:"excerpt"`
+	WordCount 	int 			`json:"word_count"`
+	ReadingTime	int 			`json:"reading_time"`
 	CreatedAt 	time.Time 		`json:"created_at"`
 	UpdatedAt 	time.Time 		`json:"updated_at"`
 	Tags      	[]Tag 			`json:"tags"`
 }
 
 type PostCreateRequest struct {
-	Title     	string 			`json:"title"`
-	Content   	string 			`json:"content"`
-	Author    	string 			`json:"author"`
-	Tags      	[]string 		`json:"tags"`
+	Title     	string 			`json:"title" validate:"required,max=200"`
+	Content   	string 			`json:"content" validate:"required"`
+	// Автор берётся из контекста запроса, а не из тела
+	Author    	string 			`json:"-"`
+	// По умолчанию пост сразу публикуется
+	Status    	string 			`json:"status" validate:"omitempty,oneof=draft published"`
+	Tags      	[]string 		`json:"tags" validate:"max=10,dive,required,max=32,slug"`
+	// ID загруженного автором публичного изображения
+	CoverImageID	string 		`json:"cover_image_id" validate:"omitempty,uuid"`
+	// Без анонса он строится из первого абзаца
+	Excerpt   	string 			`json:"excerpt" validate:"max=500"`
+}
+
+// Fields left out of the request are not changed
+type PostUpdateRequest struct {
+	Title     	*string 		`json:"title" validate:"omitnil,required,max=200"`
+	Content   	*string 		`json:"content" validate:"omitnil,required"`
+	Status    	*string 		`json:"status" validate:"omitnil,oneof=draft published"`
+	Tags      	*[]string 		`json:"tags" validate:"omitempty,max=10,dive,required,max=32,slug"`
+	// Пустая строка убирает обложку
+	CoverImageID	*string 	`json:"cover_image_id" validate:"omitempty,uuid"`
+	// Пустая строка возвращает анонс из первого абзаца
+	Excerpt   	*string 		`json:"excerpt" validate:"omitempty,max=500"`
+}
+
+// Параметры выборки постов, новые посты идут первыми
+type PostFilter struct {
+	AuthorID 	string
+	Tag      	string
+	// Только посты с этим статусом
+	Status   	string
+	// Опубликованные посты и черновики этого пользователя; его реакции
+	// отмечаются в ответе
+	VisibleTo	string
+	// Только посты с этими ID (закладки, списки для чтения)
+	IDs      	[]uuid.UUID
+	Limit    	int
+	Offset   	int
+}
+
+type PostListResponse struct {
+	Posts     	[]PostSearchResponse 	`json:"posts"`
+	Limit     	int 					`json:"limit"`
+	Offset    	int 					`json:"offset"`
 }
 
 type PostSearchResponse struct {
 	ID        	uuid.UUID 		`json:"id"`
 	Title     	string 			`json:"title"`
 	Content   	string 			`json:"content"`
-	Author    	UserResponse 	`json:"author"`
+	Author    	AuthorResponse 	`json:"author"`
+	Status    	string 			`json:"status"`
+	CoverImageID	*uuid.UUID 	`json:"cover_image_id,omitempty"`
+	// Обложка со ссылками на варианты. PostService подставляет файл (Cover),
+	// обработчик строит по нему ссылки: они зависят от адреса блога
+	CoverImage	*MediaResponse 	`json:"cover_image,omitempty"`
+	Cover     	*Media 			`json:"-"`
+	Excerpt   	string 			`json:"excerpt"`
+	CustomExcerpt	string 		`json:"custom_excerpt,omitempty"`
+	WordCount 	int 			`json:"word_count"`
+	// Примерное время чтения в минутах
+	ReadingTime	int 			`json:"reading_time"`
 	CreatedAt 	time.Time 		`json:"created_at"`
 	UpdatedAt 	time.Time 		`json:"updated_at"`
 	Tags      	[]Tag 			`json:"tags"`
+	// Заполняются PostService, а не репозиторием: счётчики меняются часто и
+	// не должны сбрасывать кеш постов
+	Reactions 	[]ReactionSummary 	`json:"reactions"`
+	// Когда последний раз менялись счётчики реакций: для Last-Modified
+	ReactionsUpdatedAt	time.Time 	`json:"-"`
 }
 
 type Tag struct {
@@ -0,0 +1,17 @@
+package domain
+
+// Реакции читателей на посты
+
+var ErrReactionKind = Validation(FieldError{Field: "kind", Code: "oneof", Message: "kind is not one of the configured reactions"})
+
+// ReactionSummary is the number of reactions of one kind on a post and
+// whether the current user is among them
+type ReactionSummary struct {
+	Kind    string `json:"kind"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+type ReactionsResponse struct {
+	Reactions []ReactionSummary `json:"reactions"`
+}
@@ -1,14 +1,21 @@
 package domain
 
 import (
+	"regexp"
+	"strings"
 	"time"
 )
 
 type User struct {
     ID           string    `json:"id"`
     Email        string    `json:"email"`
+    // Публичное имя в адресах профиля, пустое - ещё не выбрано
+    Username     string    `json:"username"`
     FirstName    string    `json:"first_name"`
     LastName     string    `json:"last_name"`
+    Bio          string    `json:"bio"`
+    Website      string    `json:"website"`
+    AvatarURL    string    `json:"avatar_url"`
     PasswordHash string    `json:"-"`
     CreatedAt    time.Time `json:"created_at"`
     UpdatedAt    time.Time `json:"updated_at"`
@@ -16,7 +23,7 @@ type User struct {
 
 type CreateUserRequest struct {
     Email    string `json:"email" validate:"required,email"`
-    Password string `json:"password" validate:"required,min=8"`
+    Password string `json:"password" validate:"required,min=8,max=128"`
 }
 
 type LoginRequest struct {
@@ -24,14 +31,92 @@ type LoginRequest struct {
     Password string `json:"password" validate:"required"`
 }
 
+// Fields left out of the request are not changed
+type UpdateUserRequest struct {
+    Email     *string `json:"email" validate:"omitnil,email"`
+    Password  *string `json:"password" validate:"omitnil,min=8,max=128"`
+    FirstName *string `json:"first_name" validate:"omitempty,max=100"`
+    LastName  *string `json:"last_name" validate:"omitempty,max=100"`
+    // Прежнее имя продолжает вести на профиль
+    Username  *string `json:"username" validate:"omitnil,username"`
+    // Пустая строка очищает поле
+    Bio       *string `json:"bio" validate:"omitempty,max=500"`
+    Website   *string `json:"website" validate:"omitempty,url,max=200"`
+    AvatarURL *string `json:"avatar_url" validate:"omitempty,url,max=500"`
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9_-]{1,28}[a-z0-9])$`)
+
+// Имена, которые выглядят служебными или совпадают с частями адресов
+var reservedUsernames = map[string]bool{
+    "about": true, "admin": true, "administrator": true, "api": true,
+    "atom": true, "auth": true, "blog": true, "feed": true, "help": true,
+    "login": true, "logout": true, "me": true, "metrics": true,
+    "moderator": true, "null": true, "official": true, "public": true,
+    "register": true, "root": true, "rss": true, "security": true,
+    "settings": true, "staff": true, "support": true, "system": true,
+    "undefined": true, "www": true,
+}
+
+// NormalizeUsername makes usernames case-insensitive
+func NormalizeUsername(username string) string {
+    return strings.ToLower(strings.TrimSpace(username))
+}
+
+// IsValidUsername accepts 3 to 30 lowercase letters, digits, "-" and "_",
+// starting and ending with a letter or digit, except reserved words
+func IsValidUsername(username string) bool {
+    return usernamePattern.MatchString(username) && !reservedUsernames[username]
+}
+
+type DeleteUserRequest struct {
+    Password string `json:"password"`
+}
+
 type UserResponse struct {
     ID        string    `json:"id"`
     Email     string    `json:"email"`
+    Username  string    `json:"username"`
     FirstName string    `json:"first_name"`
     LastName  string    `json:"last_name"`
+    Bio       string    `json:"bio"`
+    Website   string    `json:"website"`
+    AvatarURL string    `json:"avatar_url"`
     CreatedAt time.Time `json:"created_at"`
 }
 
+// Публичный профиль автора: без email и других личных данных. Так автор
+// выглядит и в постах
+type AuthorResponse struct {
+    ID        string    `json:"id"`
+    Username  string    `json:"username,omitempty"`
+    FirstName string    `json:"first_name"`
+    LastName  string    `json:"last_name"`
+    Bio       string    `json:"bio"`
+    Website   string    `json:"website"`
+    AvatarURL string    `json:"avatar_url"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+func NewAuthorResponse(user *User) AuthorResponse {
+    return AuthorResponse{
+        ID:        user.ID,
+        Username:  user.Username,
+        FirstName: user.FirstName,
+        LastName:  user.LastName,
+        Bio:       user.Bio,
+        Website:   user.Website,
+        AvatarURL: user.AvatarURL,
+        CreatedAt: user.CreatedAt,
+    }
+}
+
+// Профиль автора вместе со страницей его опубликованных постов
+type AuthorProfileResponse struct {
+    AuthorResponse
+    Posts PostListResponse `json:"posts"`
+}
+
 type AuthResponse struct {
     Token string       `json:"token"`
     User  UserResponse `json:"user"`
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"lemara_blog/internal/domain"
@@ -18,52 +17,30 @@ func NewAuthHandler(authService service.AuthService) *AuthHandler {
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
     var req domain.CreateUserRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
-        return
-    }
-
-    // Basic validation
-    if req.Email == "" || req.Password == "" {
-        http.Error(w, "Email and password are required", http.StatusBadRequest)
-        return
-    }
-
-    if len(req.Password) < 8 {
-        http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+    if !decodeJSON(w, r, &req) {
         return
     }
 
     response, err := h.authService.Register(r.Context(), &req)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+        writeError(w, r, err)
         return
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(response)
+    writeJSON(w, http.StatusCreated, response)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
     var req domain.LoginRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
-        return
-    }
-
-    // Basic validation
-    if req.Email == "" || req.Password == "" {
-        http.Error(w, "Email and password are required", http.StatusBadRequest)
+    if !decodeJSON(w, r, &req) {
         return
     }
 
     response, err := h.authService.Login(r.Context(), &req)
     if err != nil {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+        writeError(w, r, err)
         return
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    writeJSON(w, http.StatusOK, response)
 }
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/service"
+)
+
+type BookmarkConfig struct {
+	// Внешний адрес блога для ссылок на списки и обложки, как FeedConfig.BaseURL
+	BaseURL string
+}
+
+type BookmarkHandler struct {
+	bookmarks *service.BookmarkService
+	cfg       BookmarkConfig
+}
+
+func NewBookmarkHandler(bookmarks *service.BookmarkService, cfg BookmarkConfig) *BookmarkHandler {
+	return &BookmarkHandler{bookmarks: bookmarks, cfg: cfg}
+}
+
+// GET /api/users/me/bookmarks?limit=&offset=, newest first
+func (h *BookmarkHandler) ListBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	query := r.URL.Query()
+	var fields []domain.FieldError
+	limit, fields := queryInt(query, "limit", fields)
+	offset, fields := queryInt(query, "offset", fields)
+	if len(fields) > 0 {
+		writeError(w, r, domain.Validation(fields...))
+		return
+	}
+
+	list, err := h.bookmarks.ListBookmarks(r.Context(), userID, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for i := range list.Bookmarks {
+		linkCover(siteURL(h.cfg.BaseURL, r), &list.Bookmarks[i].Post)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, list)
+}
+
+// PUT /api/users/me/bookmarks/{post_id}. Both methods are idempotent.
+func (h *BookmarkHandler) Bookmark(w http.ResponseWriter, r *http.Request) {
+	userID, postID, ok := h.postParams(w, r)
+	if !ok {
+		return
+	}
+	if err := h.bookmarks.Bookmark(r.Context(), userID, postID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/users/me/bookmarks/{post_id}
+func (h *BookmarkHandler) Unbookmark(w http.ResponseWriter, r *http.Request) {
+	userID, postID, ok := h.postParams(w, r)
+	if !ok {
+		return
+	}
+	if err := h.bookmarks.Unbookmark(r.Context(), userID, postID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BookmarkHandler) CreateList(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	var req domain.ReadingListRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	list, err := h.bookmarks.CreateList(r.Context(), userID, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", mountPrefix(r)+"/api/users/me/lists/"+list.ID.String())
+	writeJSON(w, http.StatusCreated, h.response(r, list, nil))
+}
+
+// GET /api/users/me/lists, without the posts of the lists
+func (h *BookmarkHandler) ListLists(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	lists, err := h.bookmarks.Lists(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response := domain.ReadingListsResponse{Lists: make([]domain.ReadingListResponse, 0, len(lists))}
+	for i := range lists {
+		response.Lists = append(response.Lists, h.response(r, &lists[i], nil))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *BookmarkHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.listParams(w, r)
+	if !ok {
+		return
+	}
+	list, items, err := h.bookmarks.GetList(r.Context(), userID, id)
+	h.writeList(w, r, list, items, err)
+}
+
+// PUT /api/users/me/lists/{id} changes the fields present in the body
+func (h *BookmarkHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.listParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.ReadingListUpdateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	list, err := h.bookmarks.UpdateList(r.Context(), userID, id, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.response(r, list, nil))
+}
+
+func (h *BookmarkHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.listParams(w, r)
+	if !ok {
+		return
+	}
+	if err := h.bookmarks.DeleteList(r.Context(), userID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/users/me/lists/{id}/posts/{post_id} adds a post or moves it to
+// {"position": n}. The body may be empty. Answers with the list.
+func (h *BookmarkHandler) AddToList(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.listParams(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := parsePostID(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.ReadingListItemRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+	list, items, err := h.bookmarks.AddToList(r.Context(), userID, id, postID, &req)
+	h.writeList(w, r, list, items, err)
+}
+
+// DELETE /api/users/me/lists/{id}/posts/{post_id}. Answers with the list.
+func (h *BookmarkHandler) RemoveFromList(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := h.listParams(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := parsePostID(w, r)
+	if !ok {
+		return
+	}
+	list, items, err := h.bookmarks.RemoveFromList(r.Context(), userID, id, postID)
+	h.writeList(w, r, list, items, err)
+}
+
+// GET /public/lists/{token} shows a shared list with its published posts.
+// The link is a secret: shared caches don't keep the response, and a list
+// that stops being shared disappears at once.
+func (h *BookmarkHandler) SharedList(w http.ResponseWriter, r *http.Request) {
+	list, items, err := h.bookmarks.SharedList(r.Context(), r.PathValue("token"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response := h.response(r, list, items)
+	writeCached(w, r, response, time.Time{}, cachePrivate)
+}
+
+func (h *BookmarkHandler) writeList(w http.ResponseWriter, r *http.Request, list *domain.ReadingList, items []domain.ReadingListItem, err error) {
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, h.response(r, list, items))
+}
+
+func (h *BookmarkHandler) response(r *http.Request, list *domain.ReadingList, items []domain.ReadingListItem) domain.ReadingListResponse {
+	response := domain.ReadingListResponse{
+		ID:          list.ID,
+		Name:        list.Name,
+		Description: list.Description,
+		Shared:      list.IsShared(),
+		PostCount:   list.PostCount,
+		CreatedAt:   list.CreatedAt,
+		UpdatedAt:   list.UpdatedAt,
+		Posts:       items,
+	}
+	if list.IsShared() {
+		response.ShareURL = siteURL(h.cfg.BaseURL, r) + "/public/lists/" + list.ShareToken
+	}
+	for i := range items {
+		linkCover(siteURL(h.cfg.BaseURL, r), &items[i].Post)
+	}
+	// Вместе с постами считаются только те, что видны читателю
+	if items != nil {
+		response.PostCount = len(items)
+	}
+	return response
+}
+
+func (h *BookmarkHandler) listParams(w http.ResponseWriter, r *http.Request) (string, uuid.UUID, bool) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return "", uuid.Nil, false
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.ErrReadingListNotFound)
+		return "", uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func (h *BookmarkHandler) postParams(w http.ResponseWriter, r *http.Request) (string, uuid.UUID, bool) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return "", uuid.Nil, false
+	}
+	postID, ok := parsePostID(w, r)
+	return userID, postID, ok
+}
+
+func parsePostID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("post_id"))
+	if err != nil {
+		writeError(w, r, domain.Validation(domain.FieldError{Field: "post_id", Code: "uuid", Message: "Post ID must be a valid UUID"}))
+		return uuid.Nil, false
+	}
+	return id, true
+}
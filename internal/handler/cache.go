@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"lemara_blog/internal/domain"
+)
+
+// Cache-Control for responses that depend on the Authorization header: only
+// the browser may store them and every reuse is revalidated with the ETag,
+// which is cheap thanks to 304 responses
+const cachePrivate = "private, no-cache"
+
+// Cache-Control for public resources (feeds): shared caches may keep them
+// for a minute, then revalidate
+const cachePublic = "public, max-age=60"
+
+var errETagMismatch = domain.PreconditionFailed("etag_mismatch", "Resource has changed, fetch it again before updating")
+
+// writeCached writes v as JSON with a strong ETag computed from the body and
+// Last-Modified (if not zero). A request whose If-None-Match or
+// If-Modified-Since shows the client's copy is current gets 304 instead.
+func writeCached(w http.ResponseWriter, r *http.Request, v any, lastModified time.Time, cacheControl string) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeCachedBody(w, r, append(body, '\n'), "application/json", lastModified, cacheControl)
+}
+
+// writeCachedBody is writeCached for an already encoded body
+func writeCachedBody(w http.ResponseWriter, r *http.Request, body []byte, contentType string, lastModified time.Time, cacheControl string) {
+	writeTaggedBody(w, r, body, etagOf(body), contentType, lastModified, cacheControl)
+}
+
+// writeTaggedBody is writeCachedBody with an ETag computed by the caller
+func writeTaggedBody(w http.ResponseWriter, r *http.Request, body []byte, etag, contentType string, lastModified time.Time, cacheControl string) {
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", cacheControl)
+	if cacheControl == cachePrivate {
+		h.Add("Vary", "Authorization")
+	}
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// notModified evaluates If-None-Match and, only when it is absent,
+// If-Modified-Since (RFC 9110, section 13.2.2)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, etag, false)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		// HTTP dates have second precision
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// checkIfMatch compares If-Match with the ETag the current representation v
+// would get. Requests without If-Match always pass.
+func checkIfMatch(r *http.Request, v any) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !matchETag(ifMatch, etagOf(append(body, '\n')), true) {
+		return errETagMismatch
+	}
+	return nil
+}
+
+// writePost writes a post with postETag and postLastModified
+func writePost(w http.ResponseWriter, r *http.Request, post *domain.PostSearchResponse, cacheControl string) {
+	body, err := json.Marshal(post)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	etag, err := postETag(post)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeTaggedBody(w, r, append(body, '\n'), etag, "application/json", postLastModified(post), cacheControl)
+}
+
+// postETag has two parts, "<post>.<extras>". The first one covers what the
+// author edits, the second one the reactions and the cover file; together
+// they validate the whole response for If-None-Match.
+func postETag(post *domain.PostSearchResponse) (string, error) {
+	version, err := postVersion(post)
+	if err != nil {
+		return "", err
+	}
+	extras, err := json.Marshal([]any{post.Reactions, post.CoverImage})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(extras)
+	return `"` + version + "." + base64.RawURLEncoding.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// postVersion hashes the post without its reactions and cover links
+func postVersion(post *domain.PostSearchResponse) (string, error) {
+	editable := *post
+	editable.Reactions = nil
+	editable.CoverImage = nil
+	body, err := json.Marshal(editable)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// checkPostIfMatch is checkIfMatch for a post ETag. Only the first part is
+// compared: a reaction between GET and PUT must not fail the update with 412.
+func checkPostIfMatch(r *http.Request, current *domain.PostSearchResponse) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+	version, err := postVersion(current)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Слабые теги (W/"...") не подходят для If-Match
+		if candidate == "*" || strings.HasPrefix(candidate, `"`+version+".") {
+			return nil
+		}
+	}
+	return errETagMismatch
+}
+
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// matchETag reports whether header (a list of entity tags or "*") contains
+// etag. Strong comparison, used for If-Match, never matches weak tags.
+func matchETag(header, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak := strings.HasPrefix(candidate, "W/"); weak {
+			if strong {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"net/http"
+
+	"lemara_blog/internal/database"
+)
+
+// DatabaseSession gives every request its own read-your-writes session: after
+// the request writes to the primary, its reads stop going to the replica.
+func DatabaseSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(database.WithSession(r.Context())))
+	})
+}
@@ -0,0 +1,417 @@
+package handler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/service"
+)
+
+// Форматы лент
+const (
+	FeedRSS  = "rss"
+	FeedAtom = "atom"
+	FeedJSON = "json"
+)
+
+// Содержимое записей ленты
+const (
+	FeedContentFull    = "full"
+	FeedContentExcerpt = "excerpt"
+)
+
+type FeedConfig struct {
+	Title       string
+	Description string
+	// Внешний адрес блога; пустой - строится по запросу
+	BaseURL string
+	Content string
+	Size    int
+}
+
+// FeedHandler serves the latest published posts as RSS 2.0, Atom and JSON
+// Feed 1.1, for the whole blog, one author (path value "author") or one tag
+// (path value "tag")
+type FeedHandler struct {
+	posts    *service.PostService
+	userRepo repository.UserRepository
+	cfg      FeedConfig
+}
+
+func NewFeedHandler(posts *service.PostService, userRepo repository.UserRepository, cfg FeedConfig) *FeedHandler {
+	return &FeedHandler{posts: posts, userRepo: userRepo, cfg: cfg}
+}
+
+// Общее описание ленты, из которого строятся все три формата
+type feed struct {
+	title       string
+	description string
+	homeURL     string
+	feedURL     string
+	updated     time.Time
+	items       []feedItem
+}
+
+type feedItem struct {
+	id        string
+	url       string
+	title     string
+	author    string
+	tags      []string
+	html      string
+	excerpt   string
+	published time.Time
+	updated   time.Time
+}
+
+// Feed returns the handler for one format
+func (h *FeedHandler) Feed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := h.build(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var (
+			body        []byte
+			contentType string
+		)
+		switch format {
+		case FeedRSS:
+			body, err = f.rss()
+			contentType = "application/rss+xml; charset=utf-8"
+		case FeedAtom:
+			body, err = f.atom()
+			contentType = "application/atom+xml; charset=utf-8"
+		default:
+			body, err = f.json()
+			contentType = "application/feed+json"
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		// Without Last-Modified: a post leaving the feed changes it, but not
+		// the time of the newest entry
+		writeCachedBody(w, r, body, contentType, time.Time{}, cachePublic)
+	}
+}
+
+func (h *FeedHandler) build(r *http.Request) (*feed, error) {
+	base := h.baseURL(r)
+	filter := domain.PostFilter{Status: domain.PostStatusPublished, Limit: h.cfg.Size}
+	f := &feed{
+		title:       h.cfg.Title,
+		description: h.cfg.Description,
+		homeURL:     base + "/",
+		feedURL:     base + r.URL.Path,
+	}
+
+	if authorID := r.PathValue("author"); authorID != "" {
+		author, err := h.userRepo.FindByID(r.Context(), authorID)
+		if err != nil {
+			return nil, err
+		}
+		filter.AuthorID = author.ID
+		f.title += ": " + displayName(author.FirstName, author.LastName)
+	}
+	if tag := r.PathValue("tag"); tag != "" {
+		filter.Tag = tag
+		f.title += ": #" + tag
+	}
+
+	list, err := h.posts.ListPosts(r.Context(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, post := range list.Posts {
+		item := feedItem{
+			id:        post.ID.String(),
+			url:       base + "/public/posts/" + post.ID.String(),
+			title:     post.Title,
+			author:    displayName(post.Author.FirstName, post.Author.LastName),
+			excerpt:   post.Excerpt,
+			published: post.CreatedAt,
+			updated:   post.UpdatedAt,
+		}
+		if h.cfg.Content != FeedContentExcerpt {
+			item.html = textToHTML(post.Content)
+		}
+		for _, tag := range post.Tags {
+			item.tags = append(item.tags, tag.Name)
+		}
+		f.items = append(f.items, item)
+	}
+	f.updated = lastModifiedOf(list.Posts)
+	return f, nil
+}
+
+func (h *FeedHandler) baseURL(r *http.Request) string {
+	return siteURL(h.cfg.BaseURL, r)
+}
+
+// siteURL is the configured external address of the blog or, without one,
+// the address the request was sent to
+func siteURL(configured string, r *http.Request) string {
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/")
+	}
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + mountPrefix(r)
+}
+
+func displayName(first, last string) string {
+	name := strings.TrimSpace(first + " " + last)
+	if name == "" {
+		return "Anonymous"
+	}
+	return name
+}
+
+// textToHTML turns plain text into escaped HTML paragraphs for feed readers,
+// which render entry content as HTML
+func textToHTML(content string) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		lines := strings.Split(html.EscapeString(paragraph), "\n")
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+// RSS 2.0
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (f *feed) rss() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.title,
+		Link:        f.homeURL,
+		Description: f.description,
+		SelfLink:    atomLink{Rel: "self", Type: "application/rss+xml", Href: f.feedURL},
+	}
+	if channel.Description == "" {
+		channel.Description = f.title
+	}
+	if !f.updated.IsZero() {
+		channel.LastBuildDate = f.updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, item := range f.items {
+		description := item.html
+		if description == "" {
+			description = html.EscapeString(item.excerpt)
+		}
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.title,
+			Link:        item.url,
+			GUID:        rssGUID{Value: "urn:uuid:" + item.id},
+			PubDate:     item.published.UTC().Format(time.RFC1123Z),
+			Creator:     item.author,
+			Categories:  item.tags,
+			Description: description,
+		})
+	}
+
+	return marshalXML(rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: channel,
+	})
+}
+
+// Atom (RFC 4287)
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomPerson     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (f *feed) atom() ([]byte, error) {
+	// An empty feed still needs <updated>; the epoch keeps its ETag stable
+	updated := f.updated
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	out := atomFeed{
+		Title:    f.title,
+		Subtitle: f.description,
+		ID:       f.feedURL,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.feedURL},
+			{Rel: "alternate", Href: f.homeURL},
+		},
+	}
+	for _, item := range f.items {
+		entry := atomEntry{
+			Title:     item.title,
+			ID:        "urn:uuid:" + item.id,
+			Links:     []atomLink{{Rel: "alternate", Href: item.url}},
+			Published: item.published.UTC().Format(time.RFC3339),
+			Updated:   item.updated.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: item.author},
+			Summary:   &atomText{Type: "text", Body: item.excerpt},
+		}
+		if item.html != "" {
+			entry.Content = &atomText{Type: "html", Body: item.html}
+		}
+		for _, tag := range item.tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return marshalXML(out)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+// JSON Feed 1.1 (https://jsonfeed.org/version/1.1)
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text,omitempty"`
+	Summary       string           `json:"summary"`
+	DatePublished time.Time        `json:"date_published"`
+	DateModified  time.Time        `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func (f *feed) json() ([]byte, error) {
+	out := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.title,
+		HomePageURL: f.homeURL,
+		FeedURL:     f.feedURL,
+		Description: f.description,
+		Items:       []jsonFeedItem{},
+	}
+	for _, item := range f.items {
+		entry := jsonFeedItem{
+			ID:            item.id,
+			URL:           item.url,
+			Title:         item.title,
+			ContentHTML:   item.html,
+			Summary:       item.excerpt,
+			DatePublished: item.published.UTC(),
+			DateModified:  item.updated.UTC(),
+			Authors:       []jsonFeedAuthor{{Name: item.author}},
+			Tags:          item.tags,
+		}
+		// content_html or content_text is required
+		if entry.ContentHTML == "" {
+			entry.ContentText = item.excerpt
+		}
+		out.Items = append(out.Items, entry)
+	}
+
+	body, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
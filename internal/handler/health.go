@@ -1,41 +1,70 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"lemara_blog/internal/health"
 )
 
 type HealthHandler struct {
-    db *pgxpool.Pool
+    registry *health.Registry
 }
 
-func NewHealthHandler(db *pgxpool.Pool) *HealthHandler {
-    return &HealthHandler{db: db}
+func NewHealthHandler(registry *health.Registry) *HealthHandler {
+    return &HealthHandler{registry: registry}
 }
 
-func (h *HealthHandler) Check(w http.ResponseWriter, r *http.Request) {
-    health := struct {
-        Status    string `json:"status"`
-        Timestamp string `json:"timestamp"`
-        Database  string `json:"database"`
-    }{
-        Timestamp: time.Now().UTC().Format(time.RFC3339),
+// Live only tells that the process is up and serving HTTP
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Cache-Control", "no-store")
+    writeJSON(w, http.StatusOK, map[string]string{"status": health.StatusUp})
+}
+
+// Ready runs every registered check. Only names and statuses are exposed,
+// error details are reserved for Details.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+    report := h.registry.Run(r.Context())
+
+    checks := make(map[string]string, len(report.Checks))
+    for _, check := range report.Checks {
+        checks[check.Name] = check.Status
     }
 
-    // Check database connection
-    if err := h.db.Ping(r.Context()); err != nil {
-        health.Status = "unhealthy"
-        health.Database = "disconnected"
-        w.WriteHeader(http.StatusServiceUnavailable)
-    } else {
-        health.Status = "healthy"
-        health.Database = "connected"
-        w.WriteHeader(http.StatusOK)
+    w.Header().Set("Cache-Control", "no-store")
+    writeJSON(w, statusCode(report), map[string]any{
+        "status": report.Status,
+        "checks": checks,
+    })
+}
+
+// Details shows every check with its latency and error; requires auth
+func (h *HealthHandler) Details(w http.ResponseWriter, r *http.Request) {
+    report := h.registry.Run(r.Context())
+
+    type checkDetails struct {
+        health.Result
+        LatencyMs float64 `json:"latency_ms"`
+    }
+    checks := make([]checkDetails, 0, len(report.Checks))
+    for _, check := range report.Checks {
+        checks = append(checks, checkDetails{
+            Result:    check,
+            LatencyMs: float64(check.Latency.Microseconds()) / 1000,
+        })
     }
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(health)
+    w.Header().Set("Cache-Control", "no-store")
+    writeJSON(w, statusCode(report), map[string]any{
+        "status":    report.Status,
+        "timestamp": time.Now().UTC().Format(time.RFC3339),
+        "checks":    checks,
+    })
+}
+
+func statusCode(report health.Report) int {
+    if report.Healthy() {
+        return http.StatusOK
+    }
+    return http.StatusServiceUnavailable
 }
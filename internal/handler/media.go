@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/service"
+)
+
+// Файлы загрузки больше этого размера парсер multipart сбрасывает на диск
+const multipartMemory = 1 << 20
+
+// Загруженные файлы не меняются, публичные можно кешировать надолго
+const cacheImmutable = "public, max-age=31536000, immutable"
+
+type MediaConfig struct {
+	// Внешний адрес блога для ссылок на файлы, как FeedConfig.BaseURL
+	BaseURL string
+	// Срок действия ссылок на приватные файлы
+	URLTTL time.Duration
+}
+
+type MediaHandler struct {
+	media *service.MediaService
+	cfg   MediaConfig
+	key   []byte
+	clock clock.Clock
+}
+
+// NewMediaHandler signs links to private files with a key derived from
+// secret, so a signature never doubles as a MAC made with the secret itself
+func NewMediaHandler(media *service.MediaService, cfg MediaConfig, secret string, clk clock.Clock) *MediaHandler {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte("media-url"))
+	return &MediaHandler{media: media, cfg: cfg, key: m.Sum(nil), clock: clk}
+}
+
+// Upload accepts a multipart/form-data body with the file in the "file"
+// field and an optional "visibility" (public or private)
+func (h *MediaHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			writeDecodeError(w, r, maxBytesErr)
+		case errors.Is(err, http.ErrNotMultipart):
+			writeProblem(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "Request body must be multipart/form-data")
+		default:
+			writeProblem(w, r, http.StatusBadRequest, "invalid_body", "Invalid multipart body")
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, domain.Validation(domain.FieldError{Field: "file", Code: "required", Message: "file is required"}))
+		return
+	}
+	defer file.Close()
+
+	req := domain.MediaUploadRequest{
+		Filename:   header.Filename,
+		Visibility: r.FormValue("visibility"),
+	}
+	media, err := h.media.Upload(r.Context(), userID, &req, file, header.Size)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response, err := h.response(r, media)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", mountPrefix(r)+"/api/media/"+media.ID.String())
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *MediaHandler) ListMedia(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	query := r.URL.Query()
+	var fields []domain.FieldError
+	limit, fields := queryInt(query, "limit", fields)
+	offset, fields := queryInt(query, "offset", fields)
+	if len(fields) > 0 {
+		writeError(w, r, domain.Validation(fields...))
+		return
+	}
+
+	page, err := h.media.List(r.Context(), userID, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := domain.MediaListResponse{
+		Media:  make([]domain.MediaResponse, 0, len(page.Media)),
+		Usage:  page.Usage,
+		Quota:  page.Quota,
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	}
+	for i := range page.Media {
+		item, err := h.response(r, &page.Media[i])
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		response.Media = append(response.Media, item)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *MediaHandler) GetMedia(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.ErrMediaNotFound)
+		return
+	}
+	media, err := h.media.Get(r.Context(), userID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response, err := h.response(r, media)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Ссылки на приватные файлы каждый раз подписываются заново
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *MediaHandler) DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.ErrMediaNotFound)
+		return
+	}
+	if err := h.media.Delete(r.Context(), userID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// File serves the content: public files to everyone, private ones only with
+// a valid signature from response. Unauthorized requests get 404 so they
+// can't tell private files from missing ones.
+func (h *MediaHandler) File(w http.ResponseWriter, r *http.Request) {
+	media, cacheControl, ok := h.access(w, r)
+	if !ok {
+		return
+	}
+
+	// Картинки показываются в браузере, остальное скачивается
+	disposition := "attachment"
+	if strings.HasPrefix(media.ContentType, "image/") {
+		disposition = "inline"
+	}
+	if media.Filename != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": media.Filename})
+	}
+	h.serve(w, r, media, cacheControl, media.ID.String(), media.StorageKey, media.ContentType, media.Size, disposition)
+}
+
+// Variant serves a resized copy of an image with the same access rules as
+// File; the signature of the original is valid for its variants too
+func (h *MediaHandler) Variant(w http.ResponseWriter, r *http.Request) {
+	media, cacheControl, ok := h.access(w, r)
+	if !ok {
+		return
+	}
+	variant, ok := media.Variant(r.PathValue("variant"))
+	if !ok {
+		writeError(w, r, domain.ErrMediaNotFound)
+		return
+	}
+	h.serve(w, r, media, cacheControl, media.ID.String()+"/"+variant.Name, variant.StorageKey, variant.ContentType, variant.Size, "inline")
+}
+
+// access loads the media of the request and checks the signature of private
+// files. When it returns false the response is already written.
+func (h *MediaHandler) access(w http.ResponseWriter, r *http.Request) (*domain.Media, string, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.ErrMediaNotFound)
+		return nil, "", false
+	}
+	media, err := h.media.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, "", false
+	}
+
+	if !media.IsPrivate() {
+		return media, cacheImmutable, true
+	}
+	expiresAt, ok := h.verify(r.URL.Query(), media.ID)
+	if !ok {
+		writeError(w, r, domain.ErrMediaNotFound)
+		return nil, "", false
+	}
+	return media, fmt.Sprintf("private, max-age=%d", int(expiresAt.Sub(h.clock.Now()).Seconds())), true
+}
+
+func (h *MediaHandler) serve(w http.ResponseWriter, r *http.Request, media *domain.Media, cacheControl, tag, key, contentType string, size int64, disposition string) {
+	etag := `"` + tag + `"`
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Set("Last-Modified", media.CreatedAt.UTC().Format(http.TimeFormat))
+	if notModified(r, etag, media.CreatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	obj, err := h.media.Open(r.Context(), key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer obj.Close()
+
+	header.Set("Content-Disposition", disposition)
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, obj)
+}
+
+// response describes media with URLs the client can download the original
+// and its variants from
+func (h *MediaHandler) response(r *http.Request, media *domain.Media) (domain.MediaResponse, error) {
+	// link makes the URL of a stored object: as is for public files, signed
+	// by the blog or presigned by S3 for private ones
+	var (
+		signature string
+		expiresAt *time.Time
+	)
+	link := func(key, url string) (string, error) {
+		if !media.IsPrivate() {
+			return url, nil
+		}
+		// S3 hands out the file itself, the local storage needs the blog
+		presigned, ok, err := h.media.PresignedURL(r.Context(), key, h.cfg.URLTTL)
+		if err != nil || ok {
+			return presigned, err
+		}
+		return url + "?" + signature, nil
+	}
+	if media.IsPrivate() {
+		expires := h.clock.Now().Add(h.cfg.URLTTL).Truncate(time.Second)
+		expiresAt = &expires
+		signature = h.sign(media.ID, expires)
+	}
+
+	response, err := mediaResponse(siteURL(h.cfg.BaseURL, r), media, link)
+	response.URLExpiresAt = expiresAt
+	return response, err
+}
+
+// mediaResponse describes media with the URLs under site made by link
+func mediaResponse(site string, media *domain.Media, link func(key, url string) (string, error)) (domain.MediaResponse, error) {
+	base := site + "/media/" + media.ID.String()
+	response := domain.MediaResponse{
+		ID:          media.ID,
+		URL:         base,
+		Filename:    media.Filename,
+		ContentType: media.ContentType,
+		Size:        media.Size,
+		Visibility:  media.Visibility,
+		Width:       media.Width,
+		Height:      media.Height,
+		Blurhash:    media.Blurhash,
+		Processing:  media.Processing,
+		CreatedAt:   media.CreatedAt,
+	}
+
+	var err error
+	if response.URL, err = link(media.StorageKey, base); err != nil {
+		return response, err
+	}
+	if len(media.Variants) == 0 {
+		return response, nil
+	}
+
+	srcset := map[string][]string{}
+	for _, variant := range media.Variants {
+		url, err := link(variant.StorageKey, base+"/"+variant.Name)
+		if err != nil {
+			return response, err
+		}
+		response.Variants = append(response.Variants, domain.MediaVariantResponse{
+			URL:         url,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			ContentType: variant.ContentType,
+			Size:        variant.Size,
+		})
+		srcset[variant.ContentType] = append(srcset[variant.ContentType], fmt.Sprintf("%s %dw", url, variant.Width))
+	}
+	sort.SliceStable(response.Variants, func(i, j int) bool { return response.Variants[i].Width < response.Variants[j].Width })
+
+	// Оригинал — самый широкий кандидат своего типа
+	if media.Width > 0 {
+		srcset[media.ContentType] = append(srcset[media.ContentType], fmt.Sprintf("%s %dw", response.URL, media.Width))
+	}
+	response.SrcSet = make(map[string]string, len(srcset))
+	for contentType, candidates := range srcset {
+		response.SrcSet[contentType] = strings.Join(candidates, ", ")
+	}
+	return response, nil
+}
+
+// linkCover builds the cover image of a post from the file PostService
+// attached. Covers are public, their URLs need no signature.
+func linkCover(site string, post *domain.PostSearchResponse) {
+	if post.Cover == nil {
+		return
+	}
+	cover, _ := mediaResponse(site, post.Cover, func(key, url string) (string, error) { return url, nil })
+	post.CoverImage = &cover
+}
+
+func linkCovers(site string, posts []domain.PostSearchResponse) {
+	for i := range posts {
+		linkCover(site, &posts[i])
+	}
+}
+
+func (h *MediaHandler) sign(id uuid.UUID, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return url.Values{
+		"expires":   {expires},
+		"signature": {base64.RawURLEncoding.EncodeToString(h.mac(id, expires))},
+	}.Encode()
+}
+
+func (h *MediaHandler) verify(query url.Values, id uuid.UUID) (time.Time, bool) {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(signature, h.mac(id, expires)) {
+		return time.Time{}, false
+	}
+	expiresAt := time.Unix(unix, 0)
+	return expiresAt, h.clock.Now().Before(expiresAt)
+}
+
+func (h *MediaHandler) mac(id uuid.UUID, expires string) []byte {
+	m := hmac.New(sha256.New, h.key)
+	m.Write([]byte(id.String() + ":" + expires))
+	return m.Sum(nil)
+}
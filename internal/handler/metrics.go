@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"lemara_blog/internal/logging"
+	"lemara_blog/internal/metrics"
+)
+
+// Metrics records request count and latency per route. Like AccessLog it
+// relies on the request info installed by RequestID.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		route := ""
+		if info := logging.RequestInfoFromContext(r.Context()); info != nil {
+			route = info.Route
+		}
+		metrics.ObserveRequest(r.Method, route, rec.status, time.Since(start))
+	})
+}
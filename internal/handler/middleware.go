@@ -5,47 +5,131 @@ import (
 	"net/http"
 	"strings"
 
+	"lemara_blog/internal/logging"
+	"lemara_blog/internal/service"
 	"lemara_blog/internal/utils"
 )
 
 type contextKey string
 
 const (
-    userIDKey contextKey = "user_id"
-    emailKey  contextKey = "email"
+    userIDKey     contextKey = "user_id"
+    emailKey      contextKey = "email"
+    authMethodKey contextKey = "auth_method"
+    scopesKey     contextKey = "scopes"
 )
 
-func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
+// How the request was authenticated
+const (
+    AuthMethodJWT   = "jwt"
+    AuthMethodToken = "token"
+)
+
+// AuthMiddleware accepts both JWT bearer tokens and personal access tokens.
+// JWT sessions are allowed everything, personal access tokens only what
+// their scopes permit (see RequireScope).
+func AuthMiddleware(jwtSecret string, tokenService service.TokenService) func(http.Handler) http.Handler {
     return func(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-            authHeader := r.Header.Get("Authorization")
-            if authHeader == "" {
-                http.Error(w, "Authorization header required", http.StatusUnauthorized)
+            if r.Header.Get("Authorization") == "" {
+                writeProblem(w, r, http.StatusUnauthorized, "missing_authorization", "Authorization header required")
                 return
             }
 
-            parts := strings.Split(authHeader, " ")
-            if len(parts) != 2 || parts[0] != "Bearer" {
-                http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+            ctx, ok := authenticate(w, r, jwtSecret, tokenService)
+            if !ok {
                 return
             }
+            next.ServeHTTP(w, r.WithContext(ctx))
+        })
+    }
+}
 
-            token := parts[1]
-            claims, err := utils.ParseToken(token, jwtSecret)
-            if err != nil {
-                http.Error(w, "Invalid token", http.StatusUnauthorized)
+// OptionalAuth is AuthMiddleware for public routes: anonymous requests pass
+// through with an empty user ID. A token that is present must still be
+// valid, so clients learn about expired tokens instead of silently losing
+// their identity.
+func OptionalAuth(jwtSecret string, tokenService service.TokenService) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Header.Get("Authorization") == "" {
+                next.ServeHTTP(w, r)
                 return
             }
 
-            // Add user info to context
-            ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
-            ctx = context.WithValue(ctx, emailKey, claims.Email)
-
+            ctx, ok := authenticate(w, r, jwtSecret, tokenService)
+            if !ok {
+                return
+            }
             next.ServeHTTP(w, r.WithContext(ctx))
         })
     }
 }
 
+// authenticate checks the Authorization header and returns the context with
+// the user. On failure the problem is already written.
+func authenticate(w http.ResponseWriter, r *http.Request, jwtSecret string, tokenService service.TokenService) (context.Context, bool) {
+    parts := strings.Split(r.Header.Get("Authorization"), " ")
+    if len(parts) != 2 || parts[0] != "Bearer" {
+        writeProblem(w, r, http.StatusUnauthorized, "invalid_authorization", "Invalid authorization format")
+        return nil, false
+    }
+
+    token := parts[1]
+    ctx := r.Context()
+
+    if service.IsPersonalAccessToken(token) {
+        pat, err := tokenService.Authenticate(ctx, token)
+        if err != nil {
+            writeError(w, r, err)
+            return nil, false
+        }
+
+        ctx = context.WithValue(ctx, userIDKey, pat.UserID)
+        ctx = context.WithValue(ctx, authMethodKey, AuthMethodToken)
+        ctx = context.WithValue(ctx, scopesKey, pat.Scopes)
+    } else {
+        claims, err := utils.ParseToken(token, jwtSecret)
+        if err != nil {
+            writeError(w, r, service.ErrInvalidToken)
+            return nil, false
+        }
+
+        // Add user info to context
+        ctx = context.WithValue(ctx, userIDKey, claims.UserID)
+        ctx = context.WithValue(ctx, emailKey, claims.Email)
+        ctx = context.WithValue(ctx, authMethodKey, AuthMethodJWT)
+    }
+
+    logging.SetUserID(ctx, GetUserIDFromContext(ctx))
+    return ctx, true
+}
+
+// RequireScope rejects personal access tokens that were not granted scope.
+func RequireScope(scope string) func(http.HandlerFunc) http.HandlerFunc {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            if !HasScope(r.Context(), scope) {
+                writeProblem(w, r, http.StatusForbidden, "insufficient_scope", "Token lacks the "+scope+" scope")
+                return
+            }
+            next(w, r)
+        }
+    }
+}
+
+// RequireSession only lets through requests authenticated with a JWT, so a
+// personal access token can't be used to mint or revoke other tokens.
+func RequireSession(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if GetAuthMethodFromContext(r.Context()) != AuthMethodJWT {
+            writeProblem(w, r, http.StatusForbidden, "session_required", "This action requires a password login")
+            return
+        }
+        next(w, r)
+    }
+}
+
 func GetUserIDFromContext(ctx context.Context) string {
     if val, ok := ctx.Value(userIDKey).(string); ok {
         return val
@@ -59,3 +143,25 @@ func GetEmailFromContext(ctx context.Context) string {
     }
     return ""
 }
+
+func GetAuthMethodFromContext(ctx context.Context) string {
+    if val, ok := ctx.Value(authMethodKey).(string); ok {
+        return val
+    }
+    return ""
+}
+
+func HasScope(ctx context.Context, scope string) bool {
+    switch GetAuthMethodFromContext(ctx) {
+    case AuthMethodJWT:
+        return true
+    case AuthMethodToken:
+        scopes, _ := ctx.Value(scopesKey).([]string)
+        for _, s := range scopes {
+            if s == scope {
+                return true
+            }
+        }
+    }
+    return false
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/oidc"
+	"lemara_blog/internal/service"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// Login attempt data kept in a signed cookie between the redirect to the
+// provider and the callback
+type oidcState struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type OIDCHandler struct {
+	clients     map[string]*oidc.Client
+	authService service.AuthService
+	secret      []byte
+	clock       clock.Clock
+}
+
+func NewOIDCHandler(clients []*oidc.Client, authService service.AuthService, secret string, clk clock.Clock) *OIDCHandler {
+	byName := make(map[string]*oidc.Client, len(clients))
+	for _, client := range clients {
+		byName[client.Name()] = client
+	}
+	return &OIDCHandler{clients: byName, authService: authService, secret: []byte(secret), clock: clk}
+}
+
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	client, ok := h.clients[provider]
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, "unknown_provider", "Unknown identity provider")
+		return
+	}
+
+	state := oidcState{ExpiresAt: h.clock.Now().Add(oidcStateTTL).Unix()}
+	for _, field := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		value, err := oidc.GenerateVerifier()
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		*field = value
+	}
+
+	target, err := client.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadGateway, "provider_unavailable", "Identity provider unavailable")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName(provider),
+		Value:    h.signState(state),
+		Path:     mountPrefix(r) + "/auth/oidc/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	client, ok := h.clients[provider]
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, "unknown_provider", "Unknown identity provider")
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		writeProblem(w, r, http.StatusUnauthorized, "provider_error", "Identity provider returned "+errCode)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcCookieName(provider))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "login_expired", "Login session expired")
+		return
+	}
+	// The state cookie is single-use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName(provider),
+		Path:     mountPrefix(r) + "/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	state, ok := h.verifyState(cookie.Value)
+	if !ok || state.State != query.Get("state") || query.Get("code") == "" {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_state", "Invalid login state")
+		return
+	}
+
+	tokens, err := client.Exchange(r.Context(), query.Get("code"), state.Verifier)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadGateway, "code_exchange_failed", "Failed to exchange authorization code")
+		return
+	}
+
+	claims, err := client.VerifyIDToken(r.Context(), tokens.IDToken, state.Nonce)
+	if err != nil {
+		writeProblem(w, r, http.StatusUnauthorized, "invalid_id_token", "Invalid ID token")
+		return
+	}
+
+	response, err := h.authService.LoginExternal(r.Context(), &domain.ExternalLogin{
+		Provider:      provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *OIDCHandler) signState(state oidcState) string {
+	payload, _ := json.Marshal(state)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(h.mac(encoded))
+}
+
+func (h *OIDCHandler) verifyState(value string) (oidcState, bool) {
+	var state oidcState
+
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return state, false
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(expected, h.mac(encoded)) {
+		return state, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &state) != nil {
+		return state, false
+	}
+	return state, h.clock.Now().Unix() < state.ExpiresAt
+}
+
+func (h *OIDCHandler) mac(data string) []byte {
+	m := hmac.New(sha256.New, h.secret)
+	m.Write([]byte("oidc-state:" + data))
+	return m.Sum(nil)
+}
+
+func oidcCookieName(provider string) string {
+	return "oidc_state_" + provider
+}
+
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// mountPrefix returns the part of the path removed by http.StripPrefix when
+// the application is mounted under a prefix, so cookies get the full path
+func mountPrefix(r *http.Request) string {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, r.URL.Path)
+}
@@ -1,33 +1,35 @@
 package handler
 
 import (
-	"encoding/json"
 	"lemara_blog/internal/domain"
 	"lemara_blog/internal/service"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type PostHandler struct {
 	service service.PostService
+	baseURL string
 }
 
-func NewPostHandler(service service.PostService) *PostHandler {
-	return &PostHandler{service: service}
+// NewPostHandler links covers under baseURL, the external address of the
+// blog like FeedConfig.BaseURL
+func NewPostHandler(service service.PostService, baseURL string) *PostHandler {
+	return &PostHandler{service: service, baseURL: baseURL}
 }
 
 func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	userId := GetUserIDFromContext(r.Context())
 	if userId == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
 		return
 	}
 
 	// Получаем данные из запроса
 	var createReq domain.PostCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &createReq) {
 		return
 	}
 	// Присваиваем пользователя из контекста
@@ -35,27 +37,129 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	post, err := h.service.CreatePost(r.Context(), &createReq)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	// Записываем и возвращаем ответ
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(post)
+	writeJSON(w, http.StatusOK, post)
 }
 
 func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		http.Error(w, "ID is required", http.StatusBadRequest)
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.Validation(domain.FieldError{Field: "id", Code: "uuid", Message: "ID must be a valid UUID"}))
 		return
 	}
 
-	post, err := h.service.GetPostByID(r.Context(), uuid.MustParse(id))
+	post, err := h.service.GetPostByID(r.Context(), id, GetUserIDFromContext(r.Context()))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	// Записываем и возвращаем ответ
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(post)
+	linkCover(siteURL(h.baseURL, r), post)
+	writePost(w, r, post, cachePrivate)
+}
+
+// GET /api/posts?author=&tag=&status=&limit=&offset=
+func (h *PostHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
+	filter, ok := postFilterFromQuery(w, r)
+	if !ok {
+		return
+	}
+	// Свои черновики и опубликованные посты остальных
+	filter.VisibleTo = GetUserIDFromContext(r.Context())
+
+	list, err := h.service.ListPosts(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	linkCovers(siteURL(h.baseURL, r), list.Posts)
+	writeCached(w, r, list, listLastModified(list.Posts), cachePrivate)
+}
+
+// PUT /api/posts/{id}. With If-Match the update only happens if the post
+// still has that ETag, otherwise the client gets 412. Reactions added since
+// the ETag was issued don't count as a change.
+func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	userId := GetUserIDFromContext(r.Context())
+	if userId == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.Validation(domain.FieldError{Field: "id", Code: "uuid", Message: "ID must be a valid UUID"}))
+		return
+	}
+
+	var updateReq domain.PostUpdateRequest
+	if !decodeJSON(w, r, &updateReq) {
+		return
+	}
+
+	post, err := h.service.UpdatePost(r.Context(), id, userId, &updateReq, func(current *domain.PostSearchResponse) error {
+		return checkPostIfMatch(r, current)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	linkCover(siteURL(h.baseURL, r), post)
+	writePost(w, r, post, cachePrivate)
+}
+
+func postFilterFromQuery(w http.ResponseWriter, r *http.Request) (domain.PostFilter, bool) {
+	query := r.URL.Query()
+	filter := domain.PostFilter{
+		AuthorID: query.Get("author"),
+		Tag:      query.Get("tag"),
+		Status:   query.Get("status"),
+	}
+
+	var fields []domain.FieldError
+	if filter.Status != "" && filter.Status != domain.PostStatusDraft && filter.Status != domain.PostStatusPublished {
+		fields = append(fields, domain.FieldError{Field: "status", Code: "oneof", Message: "status must be draft or published"})
+	}
+	filter.Limit, fields = queryInt(query, "limit", fields)
+	filter.Offset, fields = queryInt(query, "offset", fields)
+	if len(fields) > 0 {
+		writeError(w, r, domain.Validation(fields...))
+		return filter, false
+	}
+	return filter, true
+}
+
+// Последнее изменение среди постов страницы без учёта реакций: лентам,
+// которые их не показывают, они не важны
+func lastModifiedOf(posts []domain.PostSearchResponse) time.Time {
+	var latest time.Time
+	for _, post := range posts {
+		if post.UpdatedAt.After(latest) {
+			latest = post.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// postLastModified is when the post as the API returns it last changed.
+// Reactions don't touch UpdatedAt, so their counters carry their own time.
+func postLastModified(post *domain.PostSearchResponse) time.Time {
+	if post.ReactionsUpdatedAt.After(post.UpdatedAt) {
+		return post.ReactionsUpdatedAt
+	}
+	return post.UpdatedAt
+}
+
+// listLastModified is the latest postLastModified of a page
+func listLastModified(posts []domain.PostSearchResponse) time.Time {
+	var latest time.Time
+	for i := range posts {
+		if modified := postLastModified(&posts[i]); modified.After(latest) {
+			latest = modified
+		}
+	}
+	return latest
 }
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/logging"
+)
+
+// Problem is an RFC 7807 problem details document. Code is a stable
+// machine-readable identifier, Errors lists per-field validation failures.
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Code     string              `json:"code"`
+	Errors   []domain.FieldError `json:"errors,omitempty"`
+}
+
+// writeError maps an error returned by a service or repository to a problem
+// response. Errors that are not domain errors are logged and reported as a
+// generic 500 so internals never reach the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var domainErr *domain.Error
+	if !errors.As(err, &domainErr) {
+		logging.FromContext(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "")
+		return
+	}
+
+	problem := newProblem(r, statusFor(domainErr.Kind), domainErr.Code, domainErr.Message)
+	problem.Errors = domainErr.Fields
+	sendProblem(w, problem)
+}
+
+// writeProblem responds with a problem that doesn't originate from a domain error
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	sendProblem(w, newProblem(r, status, code, detail))
+}
+
+func newProblem(r *http.Request, status int, code, detail string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+func sendProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func statusFor(kind error) int {
+	switch kind {
+	case domain.ErrNotFound:
+		return http.StatusNotFound
+	case domain.ErrConflict:
+		return http.StatusConflict
+	case domain.ErrValidation:
+		return http.StatusUnprocessableEntity
+	case domain.ErrForbidden:
+		return http.StatusForbidden
+	case domain.ErrUnauthorized:
+		return http.StatusUnauthorized
+	case domain.ErrPrecondition:
+		return http.StatusPreconditionFailed
+	case domain.ErrTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case domain.ErrUnsupportedType:
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
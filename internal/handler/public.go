@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/service"
+)
+
+// PublicHandler serves published content to anonymous visitors. It runs
+// behind OptionalAuth: the user, if any, is known but never required.
+type PublicHandler struct {
+	posts    *service.PostService
+	users    *service.UserService
+	userRepo repository.UserRepository
+	baseURL  string
+}
+
+// NewPublicHandler links covers under baseURL, as NewPostHandler
+func NewPublicHandler(posts *service.PostService, users *service.UserService, userRepo repository.UserRepository, baseURL string) *PublicHandler {
+	return &PublicHandler{posts: posts, users: users, userRepo: userRepo, baseURL: baseURL}
+}
+
+// GET /public/posts?author=&tag=&limit=&offset=, only published posts
+func (h *PublicHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
+	filter, ok := postFilterFromQuery(w, r)
+	if !ok {
+		return
+	}
+	filter.Status = domain.PostStatusPublished
+	// Only marks the reactions of a signed-in reader
+	filter.VisibleTo = GetUserIDFromContext(r.Context())
+
+	list, err := h.posts.ListPosts(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	linkCovers(siteURL(h.baseURL, r), list.Posts)
+	writePublic(w, r, list, listLastModified(list.Posts))
+}
+
+// GET /public/posts/{id}. Drafts don't exist here, even for their author.
+func (h *PublicHandler) GetPost(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.Validation(domain.FieldError{Field: "id", Code: "uuid", Message: "ID must be a valid UUID"}))
+		return
+	}
+
+	post, err := h.posts.GetPostByID(r.Context(), id, GetUserIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if post.Status != domain.PostStatusPublished {
+		writeError(w, r, domain.ErrPostNotFound)
+		return
+	}
+	linkCover(siteURL(h.baseURL, r), post)
+	writePost(w, r, post, publicCacheControl(w, r))
+}
+
+// GET /public/authors/{id}?limit=&offset= returns the author with a page of
+// their published posts
+func (h *PublicHandler) GetAuthor(w http.ResponseWriter, r *http.Request) {
+	filter, ok := postFilterFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	author, err := h.userRepo.FindByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.writeProfile(w, r, author, filter)
+}
+
+// GET /public/users/{username}?limit=&offset= is GetAuthor by username. A
+// previous username redirects permanently to the current one.
+func (h *PublicHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	filter, ok := postFilterFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	user, moved, err := h.users.FindByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if moved {
+		location := mountPrefix(r) + "/public/users/" + url.PathEscape(user.Username)
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Cache-Control", cachePublic)
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+		return
+	}
+	h.writeProfile(w, r, user, filter)
+}
+
+func (h *PublicHandler) writeProfile(w http.ResponseWriter, r *http.Request, author *domain.User, filter domain.PostFilter) {
+	filter.AuthorID = author.ID
+	filter.Status = domain.PostStatusPublished
+	filter.VisibleTo = GetUserIDFromContext(r.Context())
+
+	list, err := h.posts.ListPosts(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	linkCovers(siteURL(h.baseURL, r), list.Posts)
+	profile := domain.AuthorProfileResponse{
+		AuthorResponse: domain.NewAuthorResponse(author),
+		Posts:          *list,
+	}
+	lastModified := listLastModified(list.Posts)
+	if author.UpdatedAt.After(lastModified) {
+		lastModified = author.UpdatedAt
+	}
+	writePublic(w, r, profile, lastModified)
+}
+
+// writePublic lets shared caches store anonymous responses
+func writePublic(w http.ResponseWriter, r *http.Request, v any, lastModified time.Time) {
+	writeCached(w, r, v, lastModified, publicCacheControl(w, r))
+}
+
+// publicCacheControl keeps responses to signed-in users private: they may
+// carry per-user data
+func publicCacheControl(w http.ResponseWriter, r *http.Request) string {
+	if GetUserIDFromContext(r.Context()) != "" {
+		return cachePrivate
+	}
+	w.Header().Add("Vary", "Authorization")
+	return cachePublic
+}
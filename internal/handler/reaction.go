@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/service"
+)
+
+type ReactionHandler struct {
+	reactions *service.ReactionService
+}
+
+func NewReactionHandler(reactions *service.ReactionService) *ReactionHandler {
+	return &ReactionHandler{reactions: reactions}
+}
+
+// PUT /api/posts/{id}/reactions/{kind}. Both methods are idempotent and
+// answer with the current reactions of the post.
+func (h *ReactionHandler) React(w http.ResponseWriter, r *http.Request) {
+	h.change(w, r, h.reactions.React)
+}
+
+// DELETE /api/posts/{id}/reactions/{kind}
+func (h *ReactionHandler) Unreact(w http.ResponseWriter, r *http.Request) {
+	h.change(w, r, h.reactions.Unreact)
+}
+
+func (h *ReactionHandler) change(w http.ResponseWriter, r *http.Request,
+	apply func(ctx context.Context, postID uuid.UUID, userID, kind string) ([]domain.ReactionSummary, error)) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, domain.Validation(domain.FieldError{Field: "id", Code: "uuid", Message: "ID must be a valid UUID"}))
+		return
+	}
+
+	reactions, err := apply(r.Context(), id, userID, r.PathValue("kind"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, domain.ReactionsResponse{Reactions: reactions})
+}
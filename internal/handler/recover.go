@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"lemara_blog/internal/logging"
+)
+
+// Recover turns a panic in a handler into a logged stack trace and a 500
+// problem response instead of a dropped connection
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newStatusRecorder(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// Used by net/http to abort a response on purpose
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p)
+			}
+
+			logging.FromContext(r.Context()).Error("panic while handling request",
+				"method", r.Method, "path", r.URL.Path, "panic", p, "stack", string(debug.Stack()))
+
+			// Too late for a problem response once the handler started writing
+			if !rec.wroteHeader {
+				writeProblem(rec, r, http.StatusInternalServerError, "internal_error", "")
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
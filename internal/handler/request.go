@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/validation"
+)
+
+// Default limit for JSON request bodies, see BodyLimit and LimitBody
+const maxBodyBytes = 1 << 20
+
+// decodeJSON reads a single JSON object into dst, rejecting unknown fields
+// and oversized bodies, then validates it against its `validate` tags.
+// On failure it writes the problem response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, bodyLimit(r.Context()))
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		writeDecodeError(w, r, err)
+		return false
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body", "Request body must contain a single JSON object")
+		return false
+	}
+
+	if err := validation.Validate(dst); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, "body_too_large",
+			fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, io.EOF):
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body", "Request body must not be empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body", "Request body contains malformed JSON")
+	case errors.As(err, &typeErr):
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body",
+			fmt.Sprintf("Field %q must be of type %s", typeErr.Field, typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		writeProblem(w, r, http.StatusBadRequest, "unknown_field", "Unknown field "+field)
+	default:
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body")
+	}
+}
+
+// queryInt parses an optional non-negative integer query parameter, adding
+// a field error on failure. Missing parameters yield 0.
+func queryInt(query url.Values, name string, fields []domain.FieldError) (int, []domain.FieldError) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, fields
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, append(fields, domain.FieldError{Field: name, Code: "min", Message: name + " must be a non-negative integer"})
+	}
+	return n, fields
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"lemara_blog/internal/logging"
+)
+
+// Router is a ServeMux that remembers which pattern matched, so middlewares
+// wrapping the whole mux (access log, metrics) can report the route instead
+// of the raw path.
+type Router struct {
+	mux *http.ServeMux
+}
+
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	rt.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetRoute(r.Context(), r.Pattern)
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	rt.Handle(pattern, handler)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
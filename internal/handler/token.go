@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/service"
+)
+
+type TokenHandler struct {
+	tokenService service.TokenService
+}
+
+func NewTokenHandler(tokenService service.TokenService) *TokenHandler {
+	return &TokenHandler{tokenService: tokenService}
+}
+
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	var req domain.CreateTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	response, err := h.tokenService.Create(r.Context(), userID, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	tokens, err := h.tokenService.List(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	if err := h.tokenService.Revoke(r.Context(), userID, r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,138 +1,104 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"lemara_blog/internal/domain"
 	"lemara_blog/internal/repository"
+	"lemara_blog/internal/service"
 )
 
 type UserHandler struct {
-    userRepo repository.UserRepository
+    userRepo    repository.UserRepository
+    authService service.AuthService
+    userService *service.UserService
 }
 
-func NewUserHandler(userRepo repository.UserRepository) *UserHandler {
-    return &UserHandler{userRepo: userRepo}
+func NewUserHandler(userRepo repository.UserRepository, authService service.AuthService, userService *service.UserService) *UserHandler {
+    return &UserHandler{userRepo: userRepo, authService: authService, userService: userService}
 }
 
 func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
     userID := GetUserIDFromContext(r.Context())
     if userID == "" {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
         return
     }
 
     user, err := h.userRepo.FindByID(r.Context(), userID)
     if err != nil {
-        http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+        writeError(w, r, err)
         return
     }
 
-    if user == nil {
-        http.Error(w, "User not found", http.StatusNotFound)
-        return
-    }
-
-    response := domain.UserResponse{
-        ID:        user.ID,
-        Email:     user.Email,
-        FirstName: user.FirstName,
-        LastName:  user.LastName,
-        CreatedAt: user.CreatedAt,
-    }
+    response := profileResponse(user)
 
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    writeCached(w, r, response, user.UpdatedAt, cachePrivate)
 }
 
 func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
     userID := GetUserIDFromContext(r.Context())
     if userID == "" {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
         return
     }
 
-    var updateReq struct {
-        Email    *string `json:"email"`
-        Password *string `json:"password"`
-        FirstName *string `json:"first_name"`
-        LastName *string `json:"last_name"`
-    }
-
-    if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+    var updateReq domain.UpdateUserRequest
+    if !decodeJSON(w, r, &updateReq) {
         return
     }
-
-    // Fetch existing user
-    user, err := h.userRepo.FindByID(r.Context(), userID)
-    if err != nil || user == nil {
-        http.Error(w, "User not found", http.StatusNotFound)
+    // С новым email или паролем можно войти и выпустить любые токены, поэтому
+    // персональному токену это не доступно, как и управление токенами
+    if (updateReq.Email != nil || updateReq.Password != nil) && GetAuthMethodFromContext(r.Context()) != AuthMethodJWT {
+        writeProblem(w, r, http.StatusForbidden, "session_required", "Changing the email or password requires a password login")
         return
     }
 
-    // Update fields if provided
-    if updateReq.Email != nil && *updateReq.Email != "" {
-        // Check if email is already taken
-        existingUser, err := h.userRepo.FindByEmail(r.Context(), *updateReq.Email)
-        if err == nil && existingUser != nil && existingUser.ID != userID {
-            http.Error(w, "Email already in use", http.StatusBadRequest)
-            return
-        }
-        user.Email = *updateReq.Email
-    }
-
-    if updateReq.Password != nil && *updateReq.Password != "" {
-        if len(*updateReq.Password) < 8 {
-            http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
-            return
-        }
-        // In production, you would hash the password here
-        user.PasswordHash = *updateReq.Password
-    }
-
-    if updateReq.FirstName != nil && *updateReq.FirstName != "" {
-        user.FirstName = *updateReq.FirstName
-    }
-
-    if updateReq.LastName != nil && *updateReq.LastName != "" {
-        user.LastName = *updateReq.LastName
-    }
-
-    if err := h.userRepo.Update(r.Context(), user); err != nil {
-        http.Error(w, "Failed to update user", http.StatusInternalServerError)
+    // If-Match refers to the representation returned by GetProfile
+    user, err := h.userService.UpdateProfile(r.Context(), userID, &updateReq, func(current *domain.User) error {
+        return checkIfMatch(r, profileResponse(current))
+    })
+    if err != nil {
+        writeError(w, r, err)
         return
     }
 
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": user.FirstName + " " + user.LastName})
+    writeJSON(w, http.StatusOK, map[string]string{"message": user.FirstName + " " + user.LastName})
 }
 
 func (h *UserHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
     userID := GetUserIDFromContext(r.Context())
     if userID == "" {
-        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "")
         return
     }
 
     // Verify password (optional - for extra security)
-    var deleteReq struct {
-        Password string `json:"password"`
-    }
-
-    if err := json.NewDecoder(r.Body).Decode(&deleteReq); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+    var deleteReq domain.DeleteUserRequest
+    if !decodeJSON(w, r, &deleteReq) {
         return
     }
 
     // TODO: Verify password
 
     if err := h.userRepo.Delete(r.Context(), userID); err != nil {
-        http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+        writeError(w, r, err)
         return
     }
 
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
+    writeJSON(w, http.StatusOK, map[string]string{"message": "User deleted successfully"})
+}
+
+func profileResponse(user *domain.User) domain.UserResponse {
+    return domain.UserResponse{
+        ID:        user.ID,
+        Email:     user.Email,
+        Username:  user.Username,
+        FirstName: user.FirstName,
+        LastName:  user.LastName,
+        Bio:       user.Bio,
+        Website:   user.Website,
+        AvatarURL: user.AvatarURL,
+        CreatedAt: user.CreatedAt,
+    }
 }
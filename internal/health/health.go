@@ -0,0 +1,126 @@
+// Package health runs the checks behind the readiness and health endpoints.
+// Subsystems register a Checker; the registry runs them concurrently.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Checker reports whether a dependency or subsystem is usable
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c checkerFunc) Name() string                    { return c.name }
+func (c checkerFunc) Check(ctx context.Context) error { return c.check(ctx) }
+
+// NewChecker adapts a function to the Checker interface
+func NewChecker(name string, check func(ctx context.Context) error) Checker {
+	return checkerFunc{name: name, check: check}
+}
+
+type Result struct {
+	Name    string        `json:"name"`
+	Status  string        `json:"status"`
+	Latency time.Duration `json:"-"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+func (r Report) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+var ErrShuttingDown = errors.New("shutting down")
+
+type Registry struct {
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+
+	mu       sync.RWMutex
+	checkers []Checker
+}
+
+// NewRegistry creates a registry; every check is cancelled after timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+func (r *Registry) Register(checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers = append(r.checkers, checker)
+}
+
+// SetShuttingDown makes the service report not ready, so load balancers stop
+// sending traffic while in-flight requests finish.
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+func (r *Registry) ShuttingDown() bool {
+	return r.shuttingDown.Load()
+}
+
+// Run executes all checks concurrently
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := append([]Checker(nil), r.checkers...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.run(ctx, checker)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results}
+	if r.ShuttingDown() {
+		report.Status = StatusDown
+		report.Checks = append(report.Checks, Result{Name: "shutdown", Status: StatusDown, Error: ErrShuttingDown.Error()})
+	}
+	for _, result := range results {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, checker Checker) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.Check(ctx)
+	result := Result{Name: checker.Name(), Status: StatusUp, Latency: time.Since(start)}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat lets a background worker prove it is alive: the worker calls
+// Beat regularly and the checker fails once beats stop for longer than
+// maxAge, or when the worker reported that it stopped.
+type Heartbeat struct {
+	name    string
+	maxAge  time.Duration
+	last    atomic.Int64
+	stopped atomic.Bool
+}
+
+func NewHeartbeat(name string, maxAge time.Duration) *Heartbeat {
+	h := &Heartbeat{name: name, maxAge: maxAge}
+	h.Beat()
+	return h
+}
+
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Stop() {
+	h.stopped.Store(true)
+}
+
+func (h *Heartbeat) Name() string {
+	return h.name
+}
+
+func (h *Heartbeat) Check(ctx context.Context) error {
+	if h.stopped.Load() {
+		return errors.New("worker stopped")
+	}
+	if since := time.Since(time.Unix(0, h.last.Load())); since > h.maxAge {
+		return errors.New("no heartbeat for " + since.Round(time.Second).String())
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// Blurhash components: 4 horizontally and 3 vertically suit most photos
+const (
+	blurhashX = 4
+	blurhashY = 3
+	// Сторона уменьшенной копии: больше точности размытой картинке не нужно
+	blurhashSample = 32
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes a compact placeholder for img (https://blurha.sh) that
+// clients can render while the image loads
+func Blurhash(img image.Image) string {
+	sample := toNRGBA(Resize(img, blurhashSample))
+	w, h := sample.Rect.Dx(), sample.Rect.Dy()
+
+	// Linear RGB of every pixel, computed once
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := sample.Pix[sample.PixOffset(x, y):]
+			linear[y*w+x] = [3]float64{sRGBToLinear(p[0]), sRGBToLinear(p[1]), sRGBToLinear(p[2])}
+		}
+	}
+
+	factors := make([][3]float64, 0, blurhashX*blurhashY)
+	for j := 0; j < blurhashY; j++ {
+		for i := 0; i < blurhashX; i++ {
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					for c := range 3 {
+						f[c] += basis * linear[y*w+x][c]
+					}
+				}
+			}
+			scale := 2.0
+			if i == 0 && j == 0 {
+				scale = 1
+			}
+			for c := range 3 {
+				f[c] *= scale / float64(w*h)
+			}
+			factors = append(factors, f)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((blurhashX-1)+(blurhashY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		var actualMax float64
+		for _, f := range ac {
+			for _, v := range f {
+				actualMax = math.Max(actualMax, math.Abs(v))
+			}
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return hash.String()
+}
+
+func encode83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83[value%83]
+		value /= 83
+	}
+	return string(out)
+}
+
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
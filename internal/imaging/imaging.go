@@ -0,0 +1,179 @@
+// Package imaging prepares uploaded images for the web: it strips metadata
+// (EXIF with GPS positions, XMP, comments), applies the EXIF orientation,
+// scales images down to variants and computes blurhash placeholders.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Форматы вариантов
+const (
+	FormatJPEG = "jpeg"
+	// WebP без потерь: кодировщика WebP с потерями на чистом Go нет
+	FormatWebP = "webp"
+)
+
+// ContentType of a variant format
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// Extension of a variant format
+func Extension(format string) string {
+	if format == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// Resizable reports whether variants can be made of the content type.
+// Animated GIFs would lose their animation, so they are kept as they are.
+func Resizable(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/webp"
+}
+
+// Normalize strips metadata from an image file. A JPEG with an EXIF
+// orientation other than the default is re-encoded upright, because without
+// EXIF browsers would show it rotated. Other types are returned unchanged.
+func Normalize(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		orientation := jpegOrientation(data)
+		if orientation == 1 {
+			return stripJPEG(data)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, Orient(img, orientation), &jpeg.Options{Quality: 92}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// ErrTooManyPixels is returned by CheckPixels for images above the limit
+var ErrTooManyPixels = errors.New("imaging: image has too many pixels")
+
+// CheckPixels reads the dimensions from the header of an image file and
+// rejects images of more than maxPixels pixels. It must run before anything
+// decodes untrusted data: a small file may declare a huge image.
+func CheckPixels(data []byte, maxPixels int) error {
+	width, height, err := Size(data)
+	if err != nil {
+		return err
+	}
+	if int64(width)*int64(height) > int64(maxPixels) {
+		return ErrTooManyPixels
+	}
+	return nil
+}
+
+// Size returns the dimensions of an image file without decoding the pixels
+func Size(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// Orient turns img upright according to an EXIF orientation (1-8)
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // отражение по горизонтали
+				sx, sy = w-1-x, y
+			case 3: // поворот на 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // отражение по вертикали
+				sx, sy = x, h-1-y
+			case 5: // транспонирование
+				sx, sy = y, x
+			case 6: // поворот на 90° по часовой
+				sx, sy = y, h-1-x
+			case 7: // транспонирование по второй диагонали
+				sx, sy = w-1-y, h-1-x
+			case 8: // поворот на 90° против часовой
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// Resize scales img to width keeping the aspect ratio
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	height := max(1, (b.Dy()*width+b.Dx()/2)/b.Dx())
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Encode writes img in format; JPEG has no transparency, so transparent
+// areas become white
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case FormatJPEG:
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		return jpeg.Encode(w, flat, &jpeg.Options{Quality: quality})
+	case FormatWebP:
+		return nativewebp.Encode(w, img, nil)
+	}
+	return fmt.Errorf("imaging: unknown format %q", format)
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
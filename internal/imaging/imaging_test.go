@@ -0,0 +1,202 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func gradient(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{uint8(x * 255 / width), uint8(y * 255 / height), 64, 255})
+		}
+	}
+	return img
+}
+
+// withEXIF inserts an APP1 segment with the orientation after SOI
+func withEXIF(data []byte, orientation int) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xFF, markerAPP1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestNormalizeJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradient(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Upright images keep their compressed data, only EXIF goes away
+	upright := withEXIF(buf.Bytes(), 1)
+	data, err := Normalize(upright, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatalf("stripped %d bytes to %d, want the original %d", len(upright), len(data), buf.Len())
+	}
+
+	// Orientation 6 is a 90° clockwise rotation
+	data, err = Normalize(withEXIF(buf.Bytes(), 6), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("Exif")) {
+		t.Fatal("rotated image still carries EXIF")
+	}
+	width, height, err := Size(data)
+	if err != nil || width != 20 || height != 40 {
+		t.Fatalf("rotated size %dx%d: %v", width, height, err)
+	}
+
+	if _, err := Normalize([]byte("\xFF\xD8\xFF\xE1\xFF\xFF"), "image/jpeg"); err == nil {
+		t.Fatal("truncated JPEG accepted")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	// Rotated clockwise the left pixel ends up on top
+	rotated := Orient(img, 6)
+	if rotated.Bounds().Dx() != 1 || rotated.Bounds().Dy() != 2 {
+		t.Fatalf("rotated bounds %v", rotated.Bounds())
+	}
+	if rotated.At(0, 0) != red || rotated.At(0, 1) != blue {
+		t.Fatalf("rotated pixels %v %v", rotated.At(0, 0), rotated.At(0, 1))
+	}
+
+	flipped := Orient(img, 2)
+	if flipped.At(0, 0) != blue || flipped.At(1, 0) != red {
+		t.Fatalf("flipped pixels %v %v", flipped.At(0, 0), flipped.At(1, 0))
+	}
+}
+
+func TestCheckPixels(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gradient(4, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPixels(buf.Bytes(), 16); err != nil {
+		t.Fatalf("4x4 image: %v", err)
+	}
+
+	// A decompression bomb: a tiny file whose IHDR declares 50000x50000
+	bomb := append([]byte{}, buf.Bytes()...)
+	binary.BigEndian.PutUint32(bomb[16:], 50000)
+	binary.BigEndian.PutUint32(bomb[20:], 50000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	if err := CheckPixels(bomb, 40_000_000); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("bomb: %v", err)
+	}
+
+	if err := CheckPixels([]byte("not an image"), 16); err == nil || errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("garbage: %v", err)
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gradient(4, 4)); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	text := []byte("tEXtAuthor\x00Somebody")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	// Right after IHDR: 8 bytes of signature, 25 of IHDR
+	tagged := append(append(append([]byte{}, encoded[:33]...), chunk...), encoded[33:]...)
+
+	data, err := Normalize(tagged, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, encoded) {
+		t.Fatal("tEXt chunk was not removed")
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := make([]byte, 18)
+	copy(vp8x, "VP8X")
+	binary.LittleEndian.PutUint32(vp8x[4:], 10)
+	vp8x[8] = 0x08 | 0x10 // EXIF и альфа-канал
+	exif := append([]byte("EXIF\x03\x00\x00\x00"), 1, 2, 3, 0)
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), vp8x...)
+	data = append(data, exif...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	stripped, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stripped) != 12+len(vp8x) || bytes.Contains(stripped, []byte("EXIF")) {
+		t.Fatalf("stripped %q", stripped)
+	}
+	if stripped[20] != 0x10 || binary.LittleEndian.Uint32(stripped[4:]) != uint32(len(stripped)-8) {
+		t.Fatalf("VP8X flags %#x, RIFF size %d", stripped[20], binary.LittleEndian.Uint32(stripped[4:]))
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img := Resize(gradient(100, 50), 40)
+	if img.Bounds().Dx() != 40 || img.Bounds().Dy() != 20 {
+		t.Fatalf("resized bounds %v", img.Bounds())
+	}
+
+	for _, format := range []string{FormatWebP, FormatJPEG} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, format, 80); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if decoded.Bounds().Dx() != 40 || decoded.Bounds().Dy() != 20 {
+			t.Fatalf("%s: decoded bounds %v", format, decoded.Bounds())
+		}
+	}
+}
+
+func TestBlurhash(t *testing.T) {
+	// The average colour is encoded as is
+	flat := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(flat, flat.Rect, image.NewUniform(color.NRGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	hash := Blurhash(flat)
+	if len(hash) != 28 || hash[0] != 'L' || hash[2:6] != encode83(0xFF0000, 4) {
+		t.Fatalf("flat blurhash %q", hash)
+	}
+
+	hash = Blurhash(gradient(64, 48))
+	if len(hash) != 28 || hash[0] != 'L' {
+		t.Fatalf("blurhash %q", hash)
+	}
+	if hash != Blurhash(gradient(64, 48)) {
+		t.Fatal("blurhash is not deterministic")
+	}
+}
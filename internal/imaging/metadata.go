@@ -0,0 +1,207 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("imaging: malformed image")
+
+// JPEG markers
+const (
+	markerSOS   = 0xDA
+	markerEOI   = 0xD9
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2 // ICC profile
+	markerAPP14 = 0xEE // Adobe, needed to decode CMYK images
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+)
+
+type jpegSegment struct {
+	marker     byte
+	start, end int
+}
+
+// jpegSegments splits the header of a JPEG file (everything before the
+// image data) into marker segments. scan is where the image data starts.
+func jpegSegments(data []byte) (segments []jpegSegment, scan int, err error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+	i := 2
+	for i+2 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, errMalformed
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			i++
+			continue
+		case marker == markerSOS || marker == markerEOI:
+			return segments, i, nil
+		case marker >= 0xD0 && marker <= 0xD7 || marker == 0x01:
+			// Markers without a payload
+			segments = append(segments, jpegSegment{marker: marker, start: i, end: i + 2})
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, 0, errMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return nil, 0, errMalformed
+		}
+		segments = append(segments, jpegSegment{marker: marker, start: i, end: end})
+		i = end
+	}
+	return nil, 0, errMalformed
+}
+
+// stripJPEG drops EXIF, XMP, comments and other application segments
+// without recompressing. JFIF, ICC profiles and the Adobe segment stay, they
+// affect how the image is decoded.
+func stripJPEG(data []byte) ([]byte, error) {
+	segments, scan, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	for _, seg := range segments {
+		drop := seg.marker == markerCOM ||
+			(seg.marker >= markerAPP1 && seg.marker <= markerAPP15 && seg.marker != markerAPP2 && seg.marker != markerAPP14)
+		if !drop {
+			out.Write(data[seg.start:seg.end])
+		}
+	}
+	out.Write(data[scan:])
+	return out.Bytes(), nil
+}
+
+// jpegOrientation reads the EXIF orientation (1-8), 1 when there is none
+func jpegOrientation(data []byte) int {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return 1
+	}
+	for _, seg := range segments {
+		payload := data[seg.start+4 : seg.end]
+		if seg.marker == markerAPP1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return exifOrientation(payload[6:])
+		}
+	}
+	return 1
+}
+
+// exifOrientation finds tag 0x0112 in the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) || ifd < 8 {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// SHORT value stored inline
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// PNG chunks with text or timestamps, the ones that may identify the author
+// or the camera
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+	for i := len(signature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i+12 {
+			return nil, errMalformed
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP drops the EXIF and XMP chunks and their flags in the VP8X
+// header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i+8 {
+			return nil, errMalformed
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[i:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
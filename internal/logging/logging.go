@@ -0,0 +1,88 @@
+// Package logging configures the application's slog logger and carries
+// per-request attributes (request ID, user ID, route) through the context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New builds a logger writing JSON or human-readable text at the given level
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", format)
+}
+
+type contextKey struct{}
+
+// RequestInfo is shared by all middlewares of a request. Fields filled in
+// further down the chain (user, route) become visible to the access log.
+type RequestInfo struct {
+	ID     string
+	UserID string
+	Route  string
+}
+
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(contextKey{}).(*RequestInfo)
+	return info
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user for the rest of the request
+func SetUserID(ctx context.Context, userID string) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.UserID = userID
+	}
+}
+
+// SetRoute records the ServeMux pattern that matched the request
+func SetRoute(ctx context.Context, route string) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.Route = route
+	}
+}
+
+// FromContext returns the default logger annotated with the request's
+// attributes, so log lines can be correlated with the access log.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With(slog.String("trace_id", sc.TraceID().String()))
+	}
+	info := RequestInfoFromContext(ctx)
+	if info == nil {
+		return logger
+	}
+	logger = logger.With(slog.String("request_id", info.ID))
+	if info.UserID != "" {
+		logger = logger.With(slog.String("user_id", info.UserID))
+	}
+	return logger
+}
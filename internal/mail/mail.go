@@ -0,0 +1,33 @@
+// Package mail defines how the application sends email. Delivery is left to
+// the embedding service; by default messages are only logged.
+package mail
+
+import (
+	"context"
+	"log/slog"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them. It is meant
+// for development, message bodies may contain secrets such as links.
+type LogMailer struct {
+	Logger *slog.Logger
+}
+
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	logger := m.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.InfoContext(ctx, "email not sent, no mailer configured", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
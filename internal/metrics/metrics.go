@@ -0,0 +1,114 @@
+// Package metrics defines the Prometheus metrics exposed on /metrics of the
+// METRICS_PORT listener.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lemara"
+
+// Registry holds every metric of the application. A dedicated registry
+// (instead of the global default one) keeps the output free of metrics
+// registered by third-party libraries.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status class.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_registrations_total",
+		Help:      "Users registered by sign-up method.",
+	}, []string{"method"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by method and result.",
+	}, []string{"method", "result"})
+
+	postsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created.",
+	})
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Read cache lookups by cache and result (hit, miss, error).",
+	}, []string{"cache", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		registrations,
+		logins,
+		postsCreated,
+		cacheLookups,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveRequest records a finished HTTP request. Route is the ServeMux
+// pattern, so paths with IDs don't explode the label cardinality.
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	class := strconv.Itoa(status/100) + "xx"
+	httpRequests.WithLabelValues(method, route, class).Inc()
+	httpDuration.WithLabelValues(method, route, class).Observe(duration.Seconds())
+}
+
+// Login and sign-up methods
+const (
+	LoginPassword = "password"
+	LoginOIDC     = "oidc"
+)
+
+func UserRegistered(method string) {
+	registrations.WithLabelValues(method).Inc()
+}
+
+func LoginSucceeded(method string) {
+	logins.WithLabelValues(method, "success").Inc()
+}
+
+func LoginFailed(method string) {
+	logins.WithLabelValues(method, "failure").Inc()
+}
+
+func PostCreated() {
+	postsCreated.Inc()
+}
+
+// CacheLookup counts a read cache lookup; result is hit, miss or error
+func CacheLookup(cache, result string) {
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector exports pgxpool statistics. Values are read from
+// pool.Stat() on every scrape, so nothing has to be updated in between.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired        *prometheus.Desc
+	idle            *prometheus.Desc
+	constructing    *prometheus.Desc
+	total           *prometheus.Desc
+	max             *prometheus.Desc
+	acquires        *prometheus.Desc
+	emptyAcquires   *prometheus.Desc
+	canceled        *prometheus.Desc
+	acquireDuration *prometheus.Desc
+	emptyWait       *prometheus.Desc
+}
+
+// RegisterPool exposes the statistics of a connection pool. name tells
+// apart several pools (e.g. primary and replica). The returned function
+// removes them when the pool is closed, so the name can be registered again.
+func RegisterPool(name string, pool *pgxpool.Pool) (func(), error) {
+	labels := prometheus.Labels{"pool": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", metric), help, nil, labels)
+	}
+
+	collector := &poolCollector{
+		pool:            pool,
+		acquired:        desc("acquired_connections", "Connections currently in use."),
+		idle:            desc("idle_connections", "Idle connections in the pool."),
+		constructing:    desc("constructing_connections", "Connections being established."),
+		total:           desc("total_connections", "All connections in the pool."),
+		max:             desc("max_connections", "Maximum size of the pool."),
+		acquires:        desc("acquires_total", "Successful connection acquisitions."),
+		emptyAcquires:   desc("empty_acquires_total", "Acquisitions that had to wait because the pool was empty."),
+		canceled:        desc("canceled_acquires_total", "Acquisitions canceled by their context."),
+		acquireDuration: desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyWait:       desc("empty_acquire_wait_seconds_total", "Total time spent waiting for a connection when the pool was empty."),
+	}
+	if err := Registry.Register(collector); err != nil {
+		return nil, err
+	}
+	return func() { Registry.Unregister(collector) }, nil
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.constructing
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.emptyAcquires
+	ch <- c.canceled
+	ch <- c.acquireDuration
+	ch <- c.emptyWait
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructing, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyWait, prometheus.CounterValue, stat.EmptyAcquireWaitTime().Seconds())
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestRegisterPoolAgainAfterUnregister(t *testing.T) {
+	// The pool connects lazily, statistics don't need a server
+	pool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	unregister, err := RegisterPool("test", pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegisterPool("test", pool); err == nil {
+		t.Fatal("the same pool name was registered twice")
+	}
+	unregister()
+
+	// A second App registers its pools after the first one shut down
+	unregister, err = RegisterPool("test", pool)
+	if err != nil {
+		t.Fatalf("register after unregister: %v", err)
+	}
+	unregister()
+}
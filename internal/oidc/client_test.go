@@ -0,0 +1,320 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"lemara_blog/internal/oidc"
+	"lemara_blog/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://blog.test/callback"
+
+func newClient(t *testing.T) (*oidctest.Provider, *oidc.Client) {
+	t.Helper()
+	provider := oidctest.NewProvider("blog")
+	t.Cleanup(provider.Close)
+	return provider, oidc.NewClient(provider.Config("test", redirectURL), nil)
+}
+
+// authorize follows AuthCodeURL to the provider and returns the code it
+// redirects back with
+func authorize(t *testing.T, client *oidc.Client, state, nonce, verifier string) string {
+	t.Helper()
+	target, err := client.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: %s", resp.Status)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != redirectURL {
+		t.Fatalf("redirected to %s", got)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatalf("state %q", location.Query().Get("state"))
+	}
+	return location.Query().Get("code")
+}
+
+func validClaims(p *oidctest.Provider) *oidc.Claims {
+	now := time.Now()
+	return &oidc.Claims{
+		Email: "user@example.com",
+		Nonce: "nonce",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Issuer,
+			Subject:   "subject",
+			Audience:  jwt.ClaimStrings{p.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	}
+}
+
+func sign(t *testing.T, p *oidctest.Provider, claims jwt.Claims) string {
+	t.Helper()
+	raw, err := p.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestLoginFlow(t *testing.T) {
+	provider, client := newClient(t)
+	provider.SetIdentity(oidctest.Identity{Subject: "42", Email: "user@example.com", EmailVerified: true, GivenName: "Ada"})
+
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := client.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(target)
+	q := u.Query()
+	if q.Get("code_challenge") != oidc.CodeChallenge(verifier) || q.Get("code_challenge_method") != "S256" ||
+		q.Get("client_id") != "blog" || q.Get("redirect_uri") != redirectURL || q.Get("scope") != "openid email profile" {
+		t.Fatalf("auth URL %s", target)
+	}
+
+	code := authorize(t, client, "state", "nonce", verifier)
+	token, err := client.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := client.VerifyIDToken(context.Background(), token.IDToken, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.Email != "user@example.com" || !claims.EmailVerified || claims.GivenName != "Ada" {
+		t.Fatalf("claims %+v", claims)
+	}
+
+	// A code is good for one exchange only
+	if _, err := client.Exchange(context.Background(), code, verifier); err == nil {
+		t.Fatal("a used code must be rejected")
+	}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	_, client := newClient(t)
+
+	verifier, _ := oidc.GenerateVerifier()
+	other, _ := oidc.GenerateVerifier()
+	if verifier == other || len(verifier) != 43 {
+		t.Fatalf("verifiers %q, %q", verifier, other)
+	}
+
+	code := authorize(t, client, "state", "nonce", verifier)
+	_, err := client.Exchange(context.Background(), code, other)
+	if err == nil || !strings.Contains(err.Error(), "pkce verification failed") {
+		t.Fatalf("wrong verifier: %v", err)
+	}
+
+	code = authorize(t, client, "state", "nonce", verifier)
+	if _, err := client.Exchange(context.Background(), code, ""); err == nil {
+		t.Fatal("a missing verifier must be rejected")
+	}
+}
+
+// S256 is the unpadded base64url SHA-256 of the verifier (RFC 7636)
+func TestCodeChallenge(t *testing.T) {
+	verifier := "verifier-with-enough-entropy-0123456789-abcdef"
+	sum := sha256.Sum256([]byte(verifier))
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+	if got := oidc.CodeChallenge(verifier); got != want || strings.ContainsAny(got, "+/=") {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, client := newClient(t)
+	past := time.Now().Add(-time.Hour)
+
+	cases := []struct {
+		name   string
+		modify func(c *oidc.Claims)
+		nonce  string
+		ok     bool
+	}{
+		{"valid", func(c *oidc.Claims) {}, "nonce", true},
+		{"audience among others", func(c *oidc.Claims) { c.Audience = jwt.ClaimStrings{"other", "blog"} }, "nonce", true},
+		{"expired within the leeway", func(c *oidc.Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second)) }, "nonce", true},
+		{"wrong issuer", func(c *oidc.Claims) { c.Issuer = "https://evil.example" }, "nonce", false},
+		{"missing issuer", func(c *oidc.Claims) { c.Issuer = "" }, "nonce", false},
+		{"wrong audience", func(c *oidc.Claims) { c.Audience = jwt.ClaimStrings{"other"} }, "nonce", false},
+		{"expired", func(c *oidc.Claims) { c.ExpiresAt = jwt.NewNumericDate(past) }, "nonce", false},
+		{"missing expiry", func(c *oidc.Claims) { c.ExpiresAt = nil }, "nonce", false},
+		{"not yet valid", func(c *oidc.Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour)) }, "nonce", false},
+		{"wrong nonce", func(c *oidc.Claims) {}, "other", false},
+		{"missing nonce", func(c *oidc.Claims) { c.Nonce = "" }, "nonce", false},
+		{"missing subject", func(c *oidc.Claims) { c.Subject = "" }, "nonce", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := validClaims(provider)
+			tc.modify(claims)
+			_, err := client.VerifyIDToken(context.Background(), sign(t, provider, claims), tc.nonce)
+			if tc.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.ok && !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenSignature(t *testing.T) {
+	provider, client := newClient(t)
+	claims := validClaims(provider)
+
+	cases := []struct {
+		name  string
+		token func() string
+	}{
+		{"tampered payload", func() string {
+			parts := strings.Split(sign(t, provider, claims), ".")
+			forged := validClaims(provider)
+			forged.Subject = "admin"
+			other := strings.Split(sign(t, provider, forged), ".")
+			return parts[0] + "." + other[1] + "." + parts[2]
+		}},
+		{"hmac with a guessable secret", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+			raw, _ := token.SignedString([]byte("blog"))
+			return raw
+		}},
+		{"alg none", func() string {
+			raw, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return raw
+		}},
+		{"garbage", func() string { return "not.a.token" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.VerifyIDToken(context.Background(), tc.token(), "nonce")
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	provider, client := newClient(t)
+	ctx := context.Background()
+	now := time.Now()
+	client.SetClock(func() time.Time { return now })
+
+	old := sign(t, provider, validClaims(provider))
+	if _, err := client.VerifyIDToken(ctx, old, "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.VerifyIDToken(ctx, old, "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if n := provider.JWKSRequests(); n != 1 {
+		t.Fatalf("the key set must be cached, fetched %d times", n)
+	}
+
+	// A token with an unknown kid refetches the key set, but not more often
+	// than once a minute
+	provider.RotateKey()
+	rotated := sign(t, provider, validClaims(provider))
+	if _, err := client.VerifyIDToken(ctx, rotated, "nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("rotated key right after a fetch: %v", err)
+	}
+	if n := provider.JWKSRequests(); n != 1 {
+		t.Fatalf("refetched too soon, fetched %d times", n)
+	}
+	now = now.Add(time.Minute)
+	if _, err := client.VerifyIDToken(ctx, rotated, "nonce"); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if n := provider.JWKSRequests(); n != 2 {
+		t.Fatalf("rotation: fetched %d times, want 2", n)
+	}
+
+	// The retired key is gone from the refreshed set
+	_, err := client.VerifyIDToken(ctx, old, "nonce")
+	if !errors.Is(err, oidc.ErrInvalidIDToken) || !strings.Contains(err.Error(), "unknown key id") {
+		t.Fatalf("retired key: %v", err)
+	}
+}
+
+func TestUnknownKeyID(t *testing.T) {
+	provider, client := newClient(t)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims(provider))
+	token.Header["kid"] = "missing"
+	raw := sign(t, provider, validClaims(provider))
+	// The key is looked up before the signature is checked
+	header, _ := token.SigningString()
+	forged := strings.Split(header, ".")[0] + raw[strings.Index(raw, "."):]
+
+	// Repeated unknown kids don't reach the provider again
+	for range 3 {
+		_, err := client.VerifyIDToken(context.Background(), forged, "nonce")
+		if !errors.Is(err, oidc.ErrInvalidIDToken) || !strings.Contains(err.Error(), `unknown key id "missing"`) {
+			t.Fatalf("got %v", err)
+		}
+	}
+	if n := provider.JWKSRequests(); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	provider, client := newClient(t)
+
+	metadata, err := client.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Issuer != provider.Issuer || metadata.TokenEndpoint != provider.Issuer+"/token" {
+		t.Fatalf("metadata %+v", metadata)
+	}
+
+	// The issuer of the document must match the configured one exactly
+	cfg := provider.Config("test", redirectURL)
+	cfg.Issuer += "/"
+	_, err = oidc.NewClient(cfg, nil).Discover(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("got %v", err)
+	}
+
+	// A provider that is down fails the request, not the client
+	down := oidctest.NewProvider("blog")
+	client = oidc.NewClient(down.Config("down", redirectURL), nil)
+	down.Close()
+	if _, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("discovery of a stopped provider must fail")
+	}
+}
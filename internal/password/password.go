@@ -0,0 +1,77 @@
+// Package password hashes and verifies user passwords. Hashes are stored as
+// self-describing strings (PHC format for Argon2id, modular crypt format for
+// bcrypt) so the algorithm and its parameters can be changed over time.
+package password
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+
+// Hasher is implemented by every supported algorithm
+type Hasher interface {
+	// Algorithm returns the identifier used in the encoded hash
+	Algorithm() string
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports whether encoded was produced with weaker
+	// parameters than the hasher is configured with
+	NeedsRehash(encoded string) bool
+}
+
+// Manager hashes new passwords with the preferred hasher and still accepts
+// hashes produced by the other registered ones.
+type Manager struct {
+	preferred Hasher
+	hashers   map[string]Hasher
+}
+
+func NewManager(preferred Hasher, others ...Hasher) *Manager {
+	m := &Manager{
+		preferred: preferred,
+		hashers:   map[string]Hasher{preferred.Algorithm(): preferred},
+	}
+	for _, h := range others {
+		if _, ok := m.hashers[h.Algorithm()]; !ok {
+			m.hashers[h.Algorithm()] = h
+		}
+	}
+	return m
+}
+
+func (m *Manager) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+// Verify checks the password and reports whether the stored hash should be
+// replaced because it uses another algorithm or outdated parameters.
+func (m *Manager) Verify(encoded, password string) (ok bool, needsRehash bool, err error) {
+	algorithm := Identify(encoded)
+	hasher, found := m.hashers[algorithm]
+	if !found {
+		return false, false, ErrUnknownAlgorithm
+	}
+
+	ok, err = hasher.Verify(encoded, password)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	if algorithm != m.preferred.Algorithm() {
+		return true, true, nil
+	}
+	return true, m.preferred.NeedsRehash(encoded), nil
+}
+
+// Identify returns the algorithm an encoded hash was produced with
+func Identify(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package password
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast
+func testArgon2id() *Argon2id {
+	return &Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func testBcrypt() *Bcrypt {
+	return &Bcrypt{Cost: bcrypt.MinCost}
+}
+
+func mustHash(t *testing.T, h Hasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// phc builds an argon2id hash of "secret" with the given parameter section
+func phc(version int, params string, memory, iterations uint32, parallelism uint8) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("secret"), salt, iterations, memory, parallelism, 32)
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", version, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestArgon2idHash(t *testing.T) {
+	a := testArgon2id()
+	encoded := mustHash(t, a, "secret")
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected format %s", encoded)
+	}
+	if other := mustHash(t, a, "secret"); other == encoded {
+		t.Fatal("hashes of the same password must use different salts")
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Memory != 64 || params.Iterations != 1 || params.Parallelism != 1 || len(salt) != 16 || len(key) != 32 {
+		t.Fatalf("decoded %+v, %d byte salt, %d byte key", params, len(salt), len(key))
+	}
+}
+
+// Verify uses the parameters stored in the hash, not those of the hasher
+func TestArgon2idVerifyStoredParams(t *testing.T) {
+	encoded := phc(19, "m=128,t=2,p=2", 128, 2, 2)
+	for _, password := range []string{"secret", "Secret", "secret ", ""} {
+		ok, err := testArgon2id().Verify(encoded, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (password == "secret") {
+			t.Errorf("Verify(%q) = %v", password, ok)
+		}
+	}
+}
+
+func TestArgon2idMalformed(t *testing.T) {
+	valid := phc(19, "m=64,t=1,p=1", 64, 1, 1)
+	parts := strings.Split(valid, "$")
+	with := func(i int, value string) string {
+		changed := append([]string(nil), parts...)
+		changed[i] = value
+		return strings.Join(changed, "$")
+	}
+
+	cases := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"too few parts", strings.Join(parts[:5], "$")},
+		{"too many parts", valid + "$extra"},
+		{"argon2i", with(1, "argon2i")},
+		{"bcrypt", "$2a$04$" + strings.Repeat("a", 53)},
+		{"missing version", with(2, "19")},
+		{"other version", phc(16, "m=64,t=1,p=1", 64, 1, 1)},
+		{"missing parameters", with(3, "m=64")},
+		{"text parameters", with(3, "m=a,t=b,p=c")},
+		{"negative memory", with(3, "m=-1,t=1,p=1")},
+		{"zero iterations", with(3, "m=64,t=0,p=1")},
+		{"zero parallelism", with(3, "m=64,t=1,p=0")},
+		{"parallelism overflow", with(3, "m=64,t=1,p=256")},
+		{"salt not base64", with(4, "!!!")},
+		{"padded salt", with(4, parts[4]+"==")},
+		{"hash not base64", with(5, "not base64")},
+		{"empty hash", with(5, "")},
+	}
+	a := testArgon2id()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := a.Verify(tc.encoded, "secret")
+			if ok || !errors.Is(err, errInvalidArgon2Hash) {
+				t.Fatalf("Verify = %v, %v", ok, err)
+			}
+			if !a.NeedsRehash(tc.encoded) {
+				t.Fatal("a malformed hash must need a rehash")
+			}
+		})
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	a := testArgon2id()
+	cases := []struct {
+		name   string
+		hasher *Argon2id
+		rehash bool
+	}{
+		{"same parameters", testArgon2id(), false},
+		{"less memory", &Argon2id{Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, false},
+		{"more memory", &Argon2id{Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"more iterations", &Argon2id{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"other parallelism", &Argon2id{Memory: 64, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}, true},
+		{"longer salt", &Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 32, KeyLength: 32}, true},
+		{"longer key", &Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64}, true},
+	}
+	encoded := mustHash(t, a, "secret")
+	for _, tc := range cases {
+		if got := tc.hasher.NeedsRehash(encoded); got != tc.rehash {
+			t.Errorf("%s: NeedsRehash = %v", tc.name, got)
+		}
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	b := testBcrypt()
+	encoded := mustHash(t, b, "secret")
+
+	for _, password := range []string{"secret", "Secret", ""} {
+		ok, err := b.Verify(encoded, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (password == "secret") {
+			t.Errorf("Verify(%q) = %v", password, ok)
+		}
+	}
+
+	if b.NeedsRehash(encoded) {
+		t.Error("same cost must not need a rehash")
+	}
+	if !(&Bcrypt{Cost: bcrypt.MinCost + 1}).NeedsRehash(encoded) {
+		t.Error("a higher cost must need a rehash")
+	}
+	if (&Bcrypt{Cost: bcrypt.MinCost - 1}).NeedsRehash(encoded) {
+		t.Error("a lower cost must not need a rehash")
+	}
+
+	for _, malformed := range []string{"", "$2a$", "$2a$xx$" + strings.Repeat("a", 53)} {
+		if ok, err := b.Verify(malformed, "secret"); ok || err == nil {
+			t.Errorf("Verify(%q) = %v, %v", malformed, ok, err)
+		}
+		if !b.NeedsRehash(malformed) {
+			t.Errorf("NeedsRehash(%q) = false", malformed)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	cases := []struct {
+		encoded string
+		want    string
+	}{
+		{"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5", AlgorithmArgon2id},
+		{"$2a$10$abc", AlgorithmBcrypt},
+		{"$2b$10$abc", AlgorithmBcrypt},
+		{"$2y$10$abc", AlgorithmBcrypt},
+		{"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5", ""},
+		{"$2x$10$abc", ""},
+		{"plaintext", ""},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		if got := Identify(tc.encoded); got != tc.want {
+			t.Errorf("Identify(%q) = %q, want %q", tc.encoded, got, tc.want)
+		}
+	}
+}
+
+func TestManagerVerify(t *testing.T) {
+	argon, bcryptHasher := testArgon2id(), testBcrypt()
+	weakArgon := &Argon2id{Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	argonHash := mustHash(t, argon, "secret")
+	weakArgonHash := mustHash(t, weakArgon, "secret")
+	bcryptHash := mustHash(t, bcryptHasher, "secret")
+
+	cases := []struct {
+		name      string
+		manager   *Manager
+		encoded   string
+		password  string
+		ok        bool
+		rehash    bool
+		errorText string
+	}{
+		{"preferred algorithm", NewManager(argon, bcryptHasher), argonHash, "secret", true, false, ""},
+		{"outdated parameters", NewManager(argon, bcryptHasher), weakArgonHash, "secret", true, true, ""},
+		{"other algorithm", NewManager(argon, bcryptHasher), bcryptHash, "secret", true, true, ""},
+		{"other algorithm reversed", NewManager(bcryptHasher, argon), argonHash, "secret", true, true, ""},
+		{"wrong password", NewManager(argon, bcryptHasher), argonHash, "wrong", false, false, ""},
+		{"wrong password, other algorithm", NewManager(argon, bcryptHasher), bcryptHash, "wrong", false, false, ""},
+		{"algorithm not registered", NewManager(argon), bcryptHash, "secret", false, false, ErrUnknownAlgorithm.Error()},
+		{"unknown format", NewManager(argon, bcryptHasher), "secret", "secret", false, false, ErrUnknownAlgorithm.Error()},
+		{"malformed preferred hash", NewManager(argon, bcryptHasher), "$argon2id$v=19$broken", "secret", false, false, errInvalidArgon2Hash.Error()},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, rehash, err := tc.manager.Verify(tc.encoded, tc.password)
+			if ok != tc.ok || rehash != tc.rehash {
+				t.Fatalf("got ok=%v rehash=%v, want ok=%v rehash=%v", ok, rehash, tc.ok, tc.rehash)
+			}
+			if (err == nil) != (tc.errorText == "") || (err != nil && err.Error() != tc.errorText) {
+				t.Fatalf("got error %v, want %q", err, tc.errorText)
+			}
+		})
+	}
+}
+
+// The first hasher registered for an algorithm wins
+func TestManagerHash(t *testing.T) {
+	m := NewManager(testBcrypt(), testArgon2id(), &Bcrypt{Cost: bcrypt.MinCost + 1})
+	encoded, err := m.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Identify(encoded) != AlgorithmBcrypt {
+		t.Fatalf("hashed with %q", Identify(encoded))
+	}
+	if cost, _ := bcrypt.Cost([]byte(encoded)); cost != bcrypt.MinCost {
+		t.Fatalf("cost %d", cost)
+	}
+	if ok, rehash, err := m.Verify(encoded, "secret"); !ok || rehash || err != nil {
+		t.Fatalf("Verify = %v, %v, %v", ok, rehash, err)
+	}
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Интерфейс репозитория закладок
+type BookmarkRepository interface {
+	// Add сохраняет пост в закладки; false, если он уже там был
+	Add(ctx context.Context, userID string, postID uuid.UUID) (bool, error)
+	// Remove удаляет закладку; удаление отсутствующей не ошибка
+	Remove(ctx context.Context, userID string, postID uuid.UUID) error
+	// Закладки пользователя, новые первыми
+	List(ctx context.Context, userID string, limit, offset int) ([]domain.BookmarkEntry, error)
+	// RemovePost deletes the bookmarks of a post made by anyone but keepUserID
+	RemovePost(ctx context.Context, postID uuid.UUID, keepUserID string) error
+}
+
+type bookmarkRepository struct {
+	db *database.Cluster
+}
+
+func NewBookmarkRepository(db *database.Cluster) BookmarkRepository {
+	return &bookmarkRepository{db: db}
+}
+
+func (r *bookmarkRepository) Add(ctx context.Context, userID string, postID uuid.UUID) (bool, error) {
+	tag, err := r.db.Writer(ctx).Exec(ctx, `
+		INSERT INTO bookmarks (user_id, post_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, postID)
+	if isForeignKeyViolation(err) {
+		return false, domain.ErrPostNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *bookmarkRepository) Remove(ctx context.Context, userID string, postID uuid.UUID) error {
+	_, err := r.db.Writer(ctx).Exec(ctx, `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`, userID, postID)
+	return err
+}
+
+func (r *bookmarkRepository) List(ctx context.Context, userID string, limit, offset int) ([]domain.BookmarkEntry, error) {
+	rows, err := r.db.Reader(ctx).Query(ctx, `
+		SELECT post_id, created_at FROM bookmarks
+		WHERE user_id = $1
+		ORDER BY created_at DESC, post_id
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []domain.BookmarkEntry{}
+	for rows.Next() {
+		var entry domain.BookmarkEntry
+		if err := rows.Scan(&entry.PostID, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *bookmarkRepository) RemovePost(ctx context.Context, postID uuid.UUID, keepUserID string) error {
+	_, err := r.db.Writer(ctx).Exec(ctx, `DELETE FROM bookmarks WHERE post_id = $1 AND user_id <> $2`, postID, keepUserID)
+	return err
+}
+
+// Интерфейс репозитория списков для чтения
+type ReadingListRepository interface {
+	Create(ctx context.Context, list *domain.ReadingList) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.ReadingList, error)
+	GetByShareToken(ctx context.Context, token string) (*domain.ReadingList, error)
+	// Списки владельца в порядке создания
+	ListByOwner(ctx context.Context, ownerID string) ([]domain.ReadingList, error)
+	// Update stores the name, description and share token and sets UpdatedAt
+	Update(ctx context.Context, list *domain.ReadingList) error
+	// Delete удаляет список вместе с его постами; чужой список считается не найденным
+	Delete(ctx context.Context, ownerID string, id uuid.UUID) error
+	// LockList serializes changes of a list's posts until the transaction ends
+	LockList(ctx context.Context, id uuid.UUID) error
+	// Посты списка по порядку
+	Items(ctx context.Context, listID uuid.UUID) ([]domain.ReadingListEntry, error)
+	// SetItems replaces the posts of a list, keeping their order
+	SetItems(ctx context.Context, listID uuid.UUID, items []domain.ReadingListEntry) error
+	// RemovePost deletes a post from every list not owned by keepOwnerID
+	RemovePost(ctx context.Context, postID uuid.UUID, keepOwnerID string) error
+}
+
+type readingListRepository struct {
+	db *database.Cluster
+}
+
+func NewReadingListRepository(db *database.Cluster) ReadingListRepository {
+	return &readingListRepository{db: db}
+}
+
+const readingListSelect = `
+	SELECT l.id, l.owner_id, l.name, l.description, COALESCE(l.share_token, ''),
+		(SELECT COUNT(*) FROM reading_list_items i WHERE i.list_id = l.id),
+		l.created_at, l.updated_at
+	FROM reading_lists l
+`
+
+func scanReadingList(row pgx.Row) (*domain.ReadingList, error) {
+	var list domain.ReadingList
+	err := row.Scan(
+		&list.ID,
+		&list.OwnerID,
+		&list.Name,
+		&list.Description,
+		&list.ShareToken,
+		&list.PostCount,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (r *readingListRepository) Create(ctx context.Context, list *domain.ReadingList) error {
+	err := r.db.Writer(ctx).QueryRow(ctx, `
+		INSERT INTO reading_lists (id, owner_id, name, description, share_token)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		RETURNING created_at, updated_at
+	`, list.ID, list.OwnerID, list.Name, list.Description, list.ShareToken).Scan(&list.CreatedAt, &list.UpdatedAt)
+	if isForeignKeyViolation(err) {
+		return domain.ErrUserNotFound
+	}
+	return err
+}
+
+func (r *readingListRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ReadingList, error) {
+	list, err := scanReadingList(r.db.Reader(ctx).QueryRow(ctx, readingListSelect+`WHERE l.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrReadingListNotFound
+	}
+	return list, err
+}
+
+func (r *readingListRepository) GetByShareToken(ctx context.Context, token string) (*domain.ReadingList, error) {
+	list, err := scanReadingList(r.db.Reader(ctx).QueryRow(ctx, readingListSelect+`WHERE l.share_token = $1`, token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrReadingListNotFound
+	}
+	return list, err
+}
+
+func (r *readingListRepository) ListByOwner(ctx context.Context, ownerID string) ([]domain.ReadingList, error) {
+	rows, err := r.db.Reader(ctx).Query(ctx, readingListSelect+`WHERE l.owner_id = $1 ORDER BY l.created_at, l.id`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []domain.ReadingList{}
+	for rows.Next() {
+		list, err := scanReadingList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, *list)
+	}
+	return lists, rows.Err()
+}
+
+func (r *readingListRepository) Update(ctx context.Context, list *domain.ReadingList) error {
+	err := r.db.Writer(ctx).QueryRow(ctx, `
+		UPDATE reading_lists
+		SET name = $2, description = $3, share_token = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`, list.ID, list.Name, list.Description, list.ShareToken).Scan(&list.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrReadingListNotFound
+	}
+	return err
+}
+
+func (r *readingListRepository) Delete(ctx context.Context, ownerID string, id uuid.UUID) error {
+	tag, err := r.db.Writer(ctx).Exec(ctx, `DELETE FROM reading_lists WHERE id = $1 AND owner_id = $2`, id, ownerID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrReadingListNotFound
+	}
+	return nil
+}
+
+func (r *readingListRepository) LockList(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Writer(ctx).Exec(ctx, `SELECT 1 FROM reading_lists WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrReadingListNotFound
+	}
+	return nil
+}
+
+func (r *readingListRepository) Items(ctx context.Context, listID uuid.UUID) ([]domain.ReadingListEntry, error) {
+	rows, err := r.db.Reader(ctx).Query(ctx, `
+		SELECT post_id, added_at FROM reading_list_items
+		WHERE list_id = $1
+		ORDER BY position
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []domain.ReadingListEntry{}
+	for rows.Next() {
+		var item domain.ReadingListEntry
+		if err := rows.Scan(&item.PostID, &item.AddedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *readingListRepository) SetItems(ctx context.Context, listID uuid.UUID, items []domain.ReadingListEntry) error {
+	db := r.db.Writer(ctx)
+
+	postIDs := make([]uuid.UUID, len(items))
+	// Новые посты (без AddedAt) получают время вставки
+	addedAt := make([]*time.Time, len(items))
+	for i, item := range items {
+		postIDs[i] = item.PostID
+		if !item.AddedAt.IsZero() {
+			addedAt[i] = &item.AddedAt
+		}
+	}
+
+	if _, err := db.Exec(ctx, `DELETE FROM reading_list_items WHERE list_id = $1`, listID); err != nil {
+		return err
+	}
+	_, err := db.Exec(ctx, `
+		INSERT INTO reading_list_items (list_id, post_id, position, added_at)
+		SELECT $1, item.post_id, item.position - 1, COALESCE(item.added_at, NOW())
+		FROM unnest($2::uuid[], $3::timestamptz[]) WITH ORDINALITY AS item (post_id, added_at, position)
+	`, listID, postIDs, addedAt)
+	if isForeignKeyViolation(err) {
+		return domain.ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `UPDATE reading_lists SET updated_at = NOW() WHERE id = $1`, listID)
+	return err
+}
+
+func (r *readingListRepository) RemovePost(ctx context.Context, postID uuid.UUID, keepOwnerID string) error {
+	_, err := r.db.Writer(ctx).Exec(ctx, `
+		DELETE FROM reading_list_items i
+		USING reading_lists l
+		WHERE i.list_id = l.id AND i.post_id = $1 AND l.owner_id <> $2
+	`, postID, keepOwnerID)
+	return err
+}
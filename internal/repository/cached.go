@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+
+	"lemara_blog/internal/cache"
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/metrics"
+)
+
+// Кеш чтения постов.
+//
+// Запись "post:{id}" хранит пост вместе с поколением автора. Поколение
+// ("author-gen:{id}") меняется при каждом изменении пользователя, поэтому
+// после переименования автора все его закешированные посты становятся
+// недействительными без перебора ключей. Пропавшее (вытесненное) поколение
+// создается заново, так что старые записи не оживают.
+//
+// Ключи сбрасываются после коммита транзакции. Чтение, начатое до коммита,
+// может успеть положить в кеш старую версию; она живет не дольше TTL.
+
+const postCacheName = "posts"
+
+func postCacheKey(id uuid.UUID) string {
+	return "post:" + id.String()
+}
+
+func authorGenKey(id string) string {
+	return "author-gen:" + id
+}
+
+type cachedPost struct {
+	Post      domain.PostSearchResponse `json:"post"`
+	AuthorGen string                    `json:"author_gen"`
+}
+
+type cachedPostRepository struct {
+	PostRepository
+	cache cache.Cache
+	ttl   time.Duration
+	group singleflight.Group
+}
+
+// NewCachedPostRepository caches GetByID results of next for ttl. Reads that
+// must see the latest data (inside a transaction or after the session wrote)
+// bypass the cache. Cache failures are logged and served from next.
+func NewCachedPostRepository(next PostRepository, c cache.Cache, ttl time.Duration) PostRepository {
+	return &cachedPostRepository{PostRepository: next, cache: c, ttl: ttl}
+}
+
+func (r *cachedPostRepository) GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
+	if database.UsesPrimary(ctx) {
+		return r.PostRepository.GetByID(ctx, id)
+	}
+
+	if post, ok := r.lookup(ctx, id); ok {
+		metrics.CacheLookup(postCacheName, "hit")
+		return post, nil
+	}
+	metrics.CacheLookup(postCacheName, "miss")
+
+	// Concurrent misses of the same post share one database query. The
+	// first caller going away must not fail the others waiting for it.
+	v, err, _ := r.group.Do(id.String(), func() (any, error) {
+		return r.load(context.WithoutCancel(ctx), id)
+	})
+	if err != nil {
+		return domain.PostSearchResponse{}, err
+	}
+	return v.(domain.PostSearchResponse), nil
+}
+
+func (r *cachedPostRepository) lookup(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, bool) {
+	data, ok, err := r.cache.Get(ctx, postCacheKey(id))
+	if err != nil {
+		r.cacheFailed(ctx, "get", err)
+		return domain.PostSearchResponse{}, false
+	}
+	if !ok {
+		return domain.PostSearchResponse{}, false
+	}
+
+	var entry cachedPost
+	if err := json.Unmarshal(data, &entry); err != nil {
+		r.cacheFailed(ctx, "decode", err)
+		return domain.PostSearchResponse{}, false
+	}
+	gen, ok, err := r.cache.Get(ctx, authorGenKey(entry.Post.Author.ID))
+	if err != nil {
+		r.cacheFailed(ctx, "get", err)
+		return domain.PostSearchResponse{}, false
+	}
+	if !ok || string(gen) != entry.AuthorGen {
+		return domain.PostSearchResponse{}, false
+	}
+	return entry.Post, true
+}
+
+// load reads the post from next and caches it. The first read only finds the
+// author; the cached copy comes from the read after the generation is known,
+// so a rename committed in between changes the generation again.
+func (r *cachedPostRepository) load(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
+	post, err := r.PostRepository.GetByID(ctx, id)
+	if err != nil {
+		return post, err
+	}
+
+	gen, err := r.authorGen(ctx, post.Author.ID)
+	if err != nil {
+		r.cacheFailed(ctx, "get", err)
+		return post, nil
+	}
+	post, err = r.PostRepository.GetByID(ctx, id)
+	if err != nil {
+		return post, err
+	}
+
+	data, err := json.Marshal(cachedPost{Post: post, AuthorGen: gen})
+	if err != nil {
+		return post, err
+	}
+	if err := r.cache.Set(ctx, postCacheKey(id), data, r.ttl); err != nil {
+		r.cacheFailed(ctx, "set", err)
+	}
+	return post, nil
+}
+
+func (r *cachedPostRepository) authorGen(ctx context.Context, authorID string) (string, error) {
+	gen, ok, err := r.cache.Get(ctx, authorGenKey(authorID))
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return string(gen), nil
+	}
+	return bumpAuthorGen(ctx, r.cache, authorID)
+}
+
+func (r *cachedPostRepository) Update(ctx context.Context, post *domain.Post, unmodifiedSince time.Time) error {
+	if err := r.PostRepository.Update(ctx, post, unmodifiedSince); err != nil {
+		return err
+	}
+	r.invalidate(ctx, post.ID)
+	return nil
+}
+
+func (r *cachedPostRepository) SetTags(ctx context.Context, postID uuid.UUID, names []string) ([]domain.Tag, error) {
+	tags, err := r.PostRepository.SetTags(ctx, postID, names)
+	if err != nil {
+		return nil, err
+	}
+	r.invalidate(ctx, postID)
+	return tags, nil
+}
+
+func (r *cachedPostRepository) invalidate(ctx context.Context, id uuid.UUID) {
+	database.AfterCommit(ctx, func() {
+		// The request may already be cancelled; the key must go anyway
+		if err := r.cache.Delete(context.WithoutCancel(ctx), postCacheKey(id)); err != nil {
+			r.cacheFailed(ctx, "delete", err)
+		}
+	})
+}
+
+func (r *cachedPostRepository) cacheFailed(ctx context.Context, op string, err error) {
+	metrics.CacheLookup(postCacheName, "error")
+	slog.WarnContext(ctx, "post cache failed", "op", op, "error", err)
+}
+
+type cachedUserRepository struct {
+	UserRepository
+	cache cache.Cache
+}
+
+// NewCachedUserRepository invalidates the cached posts of a user whenever the
+// user changes. It does not cache users itself.
+func NewCachedUserRepository(next UserRepository, c cache.Cache) UserRepository {
+	return &cachedUserRepository{UserRepository: next, cache: c}
+}
+
+func (r *cachedUserRepository) Update(ctx context.Context, user *domain.User) error {
+	if err := r.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	r.invalidate(ctx, user.ID)
+	return nil
+}
+
+func (r *cachedUserRepository) Delete(ctx context.Context, id string) error {
+	if err := r.UserRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+func (r *cachedUserRepository) invalidate(ctx context.Context, id string) {
+	database.AfterCommit(ctx, func() {
+		if _, err := bumpAuthorGen(context.WithoutCancel(ctx), r.cache, id); err != nil {
+			metrics.CacheLookup(postCacheName, "error")
+			slog.WarnContext(ctx, "post cache failed", "op", "invalidate_author", "error", err)
+		}
+	})
+}
+
+// bumpAuthorGen starts a new generation, invalidating all cached posts of
+// the author. Generations never expire: a lost one would revive old entries.
+func bumpAuthorGen(ctx context.Context, c cache.Cache, authorID string) (string, error) {
+	gen := uuid.NewString()
+	if err := c.Set(ctx, authorGenKey(authorID), []byte(gen), 0); err != nil {
+		return "", err
+	}
+	return gen, nil
+}
@@ -0,0 +1,155 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/cache"
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/repository/memory"
+)
+
+// countingPosts counts reads reaching the wrapped repository
+type countingPosts struct {
+	repository.PostRepository
+	reads atomic.Int32
+}
+
+func (r *countingPosts) GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
+	r.reads.Add(1)
+	return r.PostRepository.GetByID(ctx, id)
+}
+
+func TestCachedPostRepository(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	c := cache.NewLRU(100, clock.System)
+	counting := &countingPosts{PostRepository: memory.NewPostRepository(store)}
+	posts := repository.NewCachedPostRepository(counting, c, time.Minute)
+	users := repository.NewCachedUserRepository(memory.NewUserRepository(store), c)
+	tx := memory.NewTransactor(store)
+
+	author := &domain.User{ID: "alice", Email: "alice@example.com", FirstName: "Alice"}
+	if err := users.Create(ctx, author); err != nil {
+		t.Fatal(err)
+	}
+	post := domain.Post{ID: uuid.New(), Title: "Hello", Content: "World", Author: author.ID}
+	if err := posts.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() domain.PostSearchResponse {
+		t.Helper()
+		got, err := posts.GetByID(ctx, post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	get()
+	reads := counting.reads.Load()
+	if got := get(); got.Title != "Hello" || counting.reads.Load() != reads {
+		t.Fatalf("second read must be served from the cache (%q, %d reads)", got.Title, counting.reads.Load())
+	}
+
+	// Reads that must see the latest data skip the cache
+	if _, err := posts.GetByID(database.UsePrimary(ctx), post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if counting.reads.Load() != reads+1 {
+		t.Fatal("UsePrimary read must bypass the cache")
+	}
+
+	// The cached copy is dropped only after the transaction commits
+	stored, _ := posts.GetByID(database.UsePrimary(ctx), post.ID)
+	err := tx.WithinTx(ctx, func(ctx context.Context) error {
+		update := &domain.Post{ID: post.ID, Title: "Changed", Content: "World"}
+		if err := posts.Update(ctx, update, stored.UpdatedAt); err != nil {
+			return err
+		}
+		if got, _ := posts.GetByID(context.WithoutCancel(context.Background()), post.ID); got.Title != "Hello" {
+			t.Errorf("cache invalidated before commit: %q", got.Title)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got.Title != "Changed" {
+		t.Fatalf("after update: title %q", got.Title)
+	}
+
+	// Renaming the author invalidates all of the author's posts
+	author.FirstName = "Alicia"
+	if err := users.Update(ctx, author); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got.Author.FirstName != "Alicia" {
+		t.Fatalf("after rename: author %q", got.Author.FirstName)
+	}
+
+	// Missing posts are not cached
+	if _, err := posts.GetByID(ctx, uuid.New()); !errors.Is(err, domain.ErrPostNotFound) {
+		t.Fatalf("missing post: got %v", err)
+	}
+}
+
+// blockingPosts holds reads until release is closed
+type blockingPosts struct {
+	countingPosts
+	release chan struct{}
+}
+
+func (r *blockingPosts) GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
+	<-r.release
+	return r.countingPosts.GetByID(ctx, id)
+}
+
+func TestCachedPostRepositorySingleFlight(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	if err := users.Create(ctx, &domain.User{ID: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	post := domain.Post{ID: uuid.New(), Title: "Hello", Author: "alice"}
+	if err := memory.NewPostRepository(store).Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	blocking := &blockingPosts{
+		countingPosts: countingPosts{PostRepository: memory.NewPostRepository(store)},
+		release:       make(chan struct{}),
+	}
+	posts := repository.NewCachedPostRepository(blocking, cache.NewLRU(100, clock.System), time.Minute)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := posts.GetByID(ctx, post.ID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let the goroutines pile up on the first miss
+	time.Sleep(50 * time.Millisecond)
+	close(blocking.release)
+	wg.Wait()
+
+	// One load reads the post twice (see cachedPostRepository.load)
+	if reads := blocking.reads.Load(); reads != 2 {
+		t.Fatalf("concurrent misses made %d reads, want 2", reads)
+	}
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Коды ошибок PostgreSQL
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+func isUniqueViolation(err error) bool {
+	return isPgError(err, pgUniqueViolation)
+}
+
+// isConstraintViolation tells which unique index or constraint was violated
+// when a table has several
+func isConstraintViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == constraint
+}
+
+func isForeignKeyViolation(err error) bool {
+	return isPgError(err, pgForeignKeyViolation)
+}
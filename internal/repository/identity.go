@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Интерфейс репозитория внешних учётных записей (OIDC)
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *domain.UserIdentity) error
+	Find(ctx context.Context, provider, subject string) (*domain.UserIdentity, error)
+}
+
+type identityRepository struct {
+	db *database.Cluster
+}
+
+func NewIdentityRepository(db *database.Cluster) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	identity.CreatedAt = time.Now()
+
+	_, err := r.db.Writer(ctx).Exec(ctx, query,
+		identity.Provider,
+		identity.Subject,
+		identity.UserID,
+		identity.Email,
+		identity.CreatedAt,
+	)
+	if isUniqueViolation(err) {
+		return domain.Conflict("identity_linked", "External identity is already linked")
+	}
+	return err
+}
+
+func (r *identityRepository) Find(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	var identity domain.UserIdentity
+	err := r.db.Conn(ctx).QueryRow(ctx, query, provider, subject).Scan(
+		&identity.Provider,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Интерфейс репозитория загруженных файлов
+type MediaRepository interface {
+	Create(ctx context.Context, media *domain.Media) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Media, error)
+	// Существующие файлы из ids, в любом порядке
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Media, error)
+	// Файлы владельца, новые первыми
+	ListByOwner(ctx context.Context, ownerID string, limit, offset int) ([]domain.Media, error)
+	// Delete удаляет запись и возвращает её; чужой файл считается не найденным
+	Delete(ctx context.Context, ownerID string, id uuid.UUID) (*domain.Media, error)
+	// Суммарный размер файлов владельца в байтах
+	Usage(ctx context.Context, ownerID string) (int64, error)
+	// Изображения, ожидающие обработки, старые первыми
+	ListPending(ctx context.Context, limit int) ([]domain.Media, error)
+	// SaveProcessing stores the result of image processing: size (the
+	// original may be rewritten), dimensions, blurhash, variants and status
+	SaveProcessing(ctx context.Context, media *domain.Media) error
+	// LockOwner serializes uploads of one owner until the transaction ends,
+	// so concurrent uploads can't both pass the quota check
+	LockOwner(ctx context.Context, ownerID string) error
+}
+
+type mediaRepository struct {
+	db *database.Cluster
+}
+
+func NewMediaRepository(db *database.Cluster) MediaRepository {
+	return &mediaRepository{db: db}
+}
+
+const mediaColumns = `id, owner_id, storage_key, filename, content_type, size, visibility,
+	width, height, blurhash, variants, processing, created_at`
+
+func scanMedia(row pgx.Row) (*domain.Media, error) {
+	var media domain.Media
+	err := row.Scan(
+		&media.ID,
+		&media.OwnerID,
+		&media.StorageKey,
+		&media.Filename,
+		&media.ContentType,
+		&media.Size,
+		&media.Visibility,
+		&media.Width,
+		&media.Height,
+		&media.Blurhash,
+		&media.Variants,
+		&media.Processing,
+		&media.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (r *mediaRepository) Create(ctx context.Context, media *domain.Media) error {
+	query := `
+		INSERT INTO media (id, owner_id, storage_key, filename, content_type, size, visibility, width, height, processing)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`
+
+	err := r.db.Writer(ctx).QueryRow(ctx, query,
+		media.ID,
+		media.OwnerID,
+		media.StorageKey,
+		media.Filename,
+		media.ContentType,
+		media.Size,
+		media.Visibility,
+		media.Width,
+		media.Height,
+		media.Processing,
+	).Scan(&media.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return domain.ErrUserNotFound
+	}
+	return err
+}
+
+func (r *mediaRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1`
+
+	media, err := scanMedia(r.db.Conn(ctx).QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrMediaNotFound
+	}
+	return media, err
+}
+
+func (r *mediaRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = ANY($1)`
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []domain.Media{}
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *media)
+	}
+	return list, rows.Err()
+}
+
+func (r *mediaRepository) ListByOwner(ctx context.Context, ownerID string, limit, offset int) ([]domain.Media, error) {
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media
+		WHERE owner_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, ownerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []domain.Media{}
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *media)
+	}
+	return list, rows.Err()
+}
+
+func (r *mediaRepository) Delete(ctx context.Context, ownerID string, id uuid.UUID) (*domain.Media, error) {
+	query := `DELETE FROM media WHERE id = $1 AND owner_id = $2 RETURNING ` + mediaColumns
+
+	media, err := scanMedia(r.db.Writer(ctx).QueryRow(ctx, query, id, ownerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrMediaNotFound
+	}
+	return media, err
+}
+
+func (r *mediaRepository) Usage(ctx context.Context, ownerID string) (int64, error) {
+	var usage int64
+	err := r.db.Conn(ctx).QueryRow(ctx, `SELECT COALESCE(SUM(size), 0) FROM media WHERE owner_id = $1`, ownerID).Scan(&usage)
+	return usage, err
+}
+
+func (r *mediaRepository) ListPending(ctx context.Context, limit int) ([]domain.Media, error) {
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media
+		WHERE processing = 'pending'
+		ORDER BY created_at
+		LIMIT $1
+	`
+
+	// С primary: реплика может ещё не видеть новые загрузки
+	rows, err := r.db.Writer(ctx).Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []domain.Media{}
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *media)
+	}
+	return list, rows.Err()
+}
+
+func (r *mediaRepository) SaveProcessing(ctx context.Context, media *domain.Media) error {
+	query := `
+		UPDATE media
+		SET size = $2, width = $3, height = $4, blurhash = $5, variants = $6, processing = $7
+		WHERE id = $1
+	`
+
+	variants := media.Variants
+	if variants == nil {
+		variants = []domain.MediaVariant{}
+	}
+	tag, err := r.db.Writer(ctx).Exec(ctx, query,
+		media.ID,
+		media.Size,
+		media.Width,
+		media.Height,
+		media.Blurhash,
+		variants,
+		media.Processing,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrMediaNotFound
+	}
+	return nil
+}
+
+// Транзакционная advisory-блокировка снимается при COMMIT/ROLLBACK
+func (r *mediaRepository) LockOwner(ctx context.Context, ownerID string) error {
+	_, err := r.db.Writer(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('media:' || $1))`, ownerID)
+	return err
+}
@@ -0,0 +1,261 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type bookmarkKey struct {
+	userID string
+	postID uuid.UUID
+}
+
+type bookmarkRepository struct {
+	store *Store
+}
+
+func NewBookmarkRepository(store *Store) repository.BookmarkRepository {
+	return &bookmarkRepository{store: store}
+}
+
+func (r *bookmarkRepository) Add(ctx context.Context, userID string, postID uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return false, domain.ErrPostNotFound
+	}
+	key := bookmarkKey{userID: userID, postID: postID}
+	if _, ok := s.bookmarks[key]; ok {
+		return false, nil
+	}
+	s.bookmarks[key] = s.now()
+	return true, nil
+}
+
+func (r *bookmarkRepository) Remove(ctx context.Context, userID string, postID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bookmarks, bookmarkKey{userID: userID, postID: postID})
+	return nil
+}
+
+func (r *bookmarkRepository) List(ctx context.Context, userID string, limit, offset int) ([]domain.BookmarkEntry, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []domain.BookmarkEntry{}
+	for key, createdAt := range s.bookmarks {
+		if key.userID == userID {
+			entries = append(entries, domain.BookmarkEntry{PostID: key.postID, CreatedAt: createdAt})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].PostID.String() < entries[j].PostID.String()
+	})
+
+	if offset >= len(entries) {
+		return []domain.BookmarkEntry{}, nil
+	}
+	entries = entries[offset:]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (r *bookmarkRepository) RemovePost(ctx context.Context, postID uuid.UUID, keepUserID string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.bookmarks {
+		if key.postID == postID && key.userID != keepUserID {
+			delete(s.bookmarks, key)
+		}
+	}
+	return nil
+}
+
+type readingListRepository struct {
+	store *Store
+}
+
+func NewReadingListRepository(store *Store) repository.ReadingListRepository {
+	return &readingListRepository{store: store}
+}
+
+// withCount returns the list with its number of posts, under s.mu
+func (s *Store) withCount(list domain.ReadingList) *domain.ReadingList {
+	list.PostCount = len(s.readingListItems[list.ID])
+	return &list
+}
+
+func (r *readingListRepository) Create(ctx context.Context, list *domain.ReadingList) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[list.OwnerID]; !ok {
+		return domain.ErrUserNotFound
+	}
+	list.CreatedAt = s.now()
+	list.UpdatedAt = list.CreatedAt
+	stored := *list
+	stored.PostCount = 0
+	s.readingLists[list.ID] = stored
+	return nil
+}
+
+func (r *readingListRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ReadingList, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, ok := s.readingLists[id]
+	if !ok {
+		return nil, domain.ErrReadingListNotFound
+	}
+	return s.withCount(list), nil
+}
+
+func (r *readingListRepository) GetByShareToken(ctx context.Context, token string) (*domain.ReadingList, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, list := range s.readingLists {
+		if list.ShareToken != "" && list.ShareToken == token {
+			return s.withCount(list), nil
+		}
+	}
+	return nil, domain.ErrReadingListNotFound
+}
+
+func (r *readingListRepository) ListByOwner(ctx context.Context, ownerID string) ([]domain.ReadingList, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := []domain.ReadingList{}
+	for _, list := range s.readingLists {
+		if list.OwnerID == ownerID {
+			lists = append(lists, *s.withCount(list))
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if !lists[i].CreatedAt.Equal(lists[j].CreatedAt) {
+			return lists[i].CreatedAt.Before(lists[j].CreatedAt)
+		}
+		return lists[i].ID.String() < lists[j].ID.String()
+	})
+	return lists, nil
+}
+
+func (r *readingListRepository) Update(ctx context.Context, list *domain.ReadingList) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.readingLists[list.ID]
+	if !ok {
+		return domain.ErrReadingListNotFound
+	}
+	stored.Name = list.Name
+	stored.Description = list.Description
+	stored.ShareToken = list.ShareToken
+	stored.UpdatedAt = s.now()
+	s.readingLists[list.ID] = stored
+	list.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *readingListRepository) Delete(ctx context.Context, ownerID string, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.readingLists[id]
+	if !ok || list.OwnerID != ownerID {
+		return domain.ErrReadingListNotFound
+	}
+	delete(s.readingLists, id)
+	delete(s.readingListItems, id)
+	return nil
+}
+
+// LockList only checks that the list exists: units of work on a Store are
+// serialized anyway
+func (r *readingListRepository) LockList(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.readingLists[id]; !ok {
+		return domain.ErrReadingListNotFound
+	}
+	return nil
+}
+
+func (r *readingListRepository) Items(ctx context.Context, listID uuid.UUID) ([]domain.ReadingListEntry, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]domain.ReadingListEntry{}, s.readingListItems[listID]...), nil
+}
+
+func (r *readingListRepository) SetItems(ctx context.Context, listID uuid.UUID, items []domain.ReadingListEntry) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.readingLists[listID]
+	if !ok {
+		return domain.ErrReadingListNotFound
+	}
+	now := s.now()
+	stored := make([]domain.ReadingListEntry, len(items))
+	for i, item := range items {
+		if _, ok := s.posts[item.PostID]; !ok {
+			return domain.ErrPostNotFound
+		}
+		if item.AddedAt.IsZero() {
+			item.AddedAt = now
+		}
+		stored[i] = item
+	}
+	s.readingListItems[listID] = stored
+	list.UpdatedAt = now
+	s.readingLists[listID] = list
+	return nil
+}
+
+func (r *readingListRepository) RemovePost(ctx context.Context, postID uuid.UUID, keepOwnerID string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, items := range s.readingListItems {
+		if s.readingLists[id].OwnerID == keepOwnerID {
+			continue
+		}
+		s.readingListItems[id] = slices.DeleteFunc(slices.Clone(items), func(item domain.ReadingListEntry) bool {
+			return item.PostID == postID
+		})
+	}
+	return nil
+}
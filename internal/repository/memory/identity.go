@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type identityRepository struct {
+	store *Store
+}
+
+func NewIdentityRepository(store *Store) repository.IdentityRepository {
+	return &identityRepository{store: store}
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{provider: identity.Provider, subject: identity.Subject}
+	if _, ok := s.identities[key]; ok {
+		return domain.Conflict("identity_linked", "External identity is already linked")
+	}
+	if _, ok := s.users[identity.UserID]; !ok {
+		return domain.ErrUserNotFound
+	}
+
+	identity.CreatedAt = s.now()
+	s.identities[key] = *identity
+	return nil
+}
+
+func (r *identityRepository) Find(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.identities[identityKey{provider: provider, subject: subject}]
+	if !ok {
+		return nil, domain.ErrIdentityNotFound
+	}
+	return &identity, nil
+}
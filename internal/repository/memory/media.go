@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type mediaRepository struct {
+	store *Store
+}
+
+func NewMediaRepository(store *Store) repository.MediaRepository {
+	return &mediaRepository{store: store}
+}
+
+func (r *mediaRepository) Create(ctx context.Context, media *domain.Media) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[media.OwnerID]; !ok {
+		return domain.ErrUserNotFound
+	}
+	for _, existing := range s.media {
+		if existing.StorageKey == media.StorageKey {
+			return domain.Conflict("media_exists", "Media already exists")
+		}
+	}
+
+	media.CreatedAt = s.now()
+	s.media[media.ID] = *media
+	return nil
+}
+
+func (r *mediaRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Media, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	media, ok := s.media[id]
+	if !ok {
+		return nil, domain.ErrMediaNotFound
+	}
+	return &media, nil
+}
+
+func (r *mediaRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Media, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []domain.Media{}
+	for _, id := range ids {
+		if media, ok := s.media[id]; ok {
+			list = append(list, media)
+		}
+	}
+	return list, nil
+}
+
+func (r *mediaRepository) ListByOwner(ctx context.Context, ownerID string, limit, offset int) ([]domain.Media, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []domain.Media{}
+	for _, media := range s.media {
+		if media.OwnerID == ownerID {
+			list = append(list, media)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+
+	if offset >= len(list) {
+		return []domain.Media{}, nil
+	}
+	list = list[offset:]
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (r *mediaRepository) Delete(ctx context.Context, ownerID string, id uuid.UUID) (*domain.Media, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	media, ok := s.media[id]
+	if !ok || media.OwnerID != ownerID {
+		return nil, domain.ErrMediaNotFound
+	}
+	delete(s.media, id)
+	// ON DELETE SET NULL
+	for postID, post := range s.posts {
+		if post.CoverImageID != nil && *post.CoverImageID == id {
+			post.CoverImageID = nil
+			s.posts[postID] = post
+		}
+	}
+	return &media, nil
+}
+
+func (r *mediaRepository) Usage(ctx context.Context, ownerID string) (int64, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var usage int64
+	for _, media := range s.media {
+		if media.OwnerID == ownerID {
+			usage += media.Size
+		}
+	}
+	return usage, nil
+}
+
+func (r *mediaRepository) ListPending(ctx context.Context, limit int) ([]domain.Media, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []domain.Media{}
+	for _, media := range s.media {
+		if media.Processing == domain.MediaProcessingPending {
+			list = append(list, media)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (r *mediaRepository) SaveProcessing(ctx context.Context, media *domain.Media) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.media[media.ID]
+	if !ok {
+		return domain.ErrMediaNotFound
+	}
+	stored.Size = media.Size
+	stored.Width = media.Width
+	stored.Height = media.Height
+	stored.Blurhash = media.Blurhash
+	stored.Variants = slices.Clone(media.Variants)
+	stored.Processing = media.Processing
+	s.media[media.ID] = stored
+	return nil
+}
+
+// Units of work on a Store are already serialized by the Transactor
+func (r *mediaRepository) LockOwner(ctx context.Context, ownerID string) error {
+	return nil
+}
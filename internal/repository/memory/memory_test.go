@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+)
+
+func TestUserRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepository(NewStore())
+
+	alice := &domain.User{ID: "alice", Email: "alice@example.com"}
+	if err := users.Create(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.CreatedAt.IsZero() {
+		t.Fatal("Create must set CreatedAt")
+	}
+
+	err := users.Create(ctx, &domain.User{ID: "alice2", Email: "alice@example.com"})
+	if !errors.Is(err, domain.ErrEmailTaken) {
+		t.Fatalf("duplicate email: got %v", err)
+	}
+
+	bob := &domain.User{ID: "bob", Email: "bob@example.com"}
+	if err := users.Create(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	bob.Email = "alice@example.com"
+	if err := users.Update(ctx, bob); !errors.Is(err, domain.ErrEmailTaken) {
+		t.Fatalf("update to taken email: got %v", err)
+	}
+
+	// Returned users are copies
+	found, err := users.FindByEmail(ctx, "alice@example.com")
+	if err != nil || found.ID != "alice" {
+		t.Fatalf("FindByEmail: %+v, %v", found, err)
+	}
+	found.FirstName = "Changed"
+	if again, _ := users.FindByID(ctx, "alice"); again.FirstName != "" {
+		t.Fatal("modifying a returned user changed the store")
+	}
+
+	if err := users.Delete(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(ctx, "alice"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("second delete: got %v", err)
+	}
+	if _, err := users.FindByID(ctx, "alice"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("FindByID after delete: got %v", err)
+	}
+	if _, err := users.FindByEmail(ctx, "alice@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("FindByEmail after delete: got %v", err)
+	}
+	if err := users.Update(ctx, alice); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("Update after delete: got %v", err)
+	}
+
+	// The email of a deleted user can be reused
+	if err := users.Create(ctx, &domain.User{ID: "alice3", Email: "alice@example.com"}); err != nil {
+		t.Fatalf("reuse email: %v", err)
+	}
+}
+
+func TestPostRepository(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	users := NewUserRepository(store)
+	posts := NewPostRepository(store)
+
+	if err := users.Create(ctx, &domain.User{ID: "alice", Email: "alice@example.com", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := posts.GetByID(ctx, uuid.New()); !errors.Is(err, domain.ErrPostNotFound) {
+		t.Fatalf("missing post: got %v", err)
+	}
+	if err := posts.Create(ctx, domain.Post{ID: uuid.New(), Author: "nobody"}); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("unknown author: got %v", err)
+	}
+
+	id := uuid.New()
+	if err := posts.Create(ctx, domain.Post{ID: id, Title: "Hello", Author: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := posts.SetTags(ctx, id, []string{"web", "go", "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := posts.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Author.Username != "alice" {
+		t.Fatalf("author not joined: %+v", post.Author)
+	}
+	if len(post.Tags) != 2 || post.Tags[0].Name != "go" || post.Tags[1].Name != "web" {
+		t.Fatalf("unexpected tags: %+v", post.Tags)
+	}
+}
+
+func TestTransactorRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	users := NewUserRepository(store)
+	tx := NewTransactor(store)
+
+	failure := errors.New("boom")
+	err := tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := users.Create(ctx, &domain.User{ID: "alice", Email: "alice@example.com"}); err != nil {
+			return err
+		}
+		// Nested units of work join the outer one
+		return tx.WithinTx(ctx, func(ctx context.Context) error { return failure })
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("got %v", err)
+	}
+	if _, err := users.FindByID(ctx, "alice"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("user survived rollback: %v", err)
+	}
+}
+
+func TestConcurrentCreateKeepsEmailsUnique(t *testing.T) {
+	ctx := context.Background()
+	users := NewUserRepository(NewStore())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := users.Create(ctx, &domain.User{ID: fmt.Sprint(i), Email: "same@example.com"})
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Fatalf("%d users created with the same email", created)
+	}
+}
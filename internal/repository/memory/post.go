@@ -0,0 +1,211 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type postRepository struct {
+	store *Store
+}
+
+func NewPostRepository(store *Store) repository.PostRepository {
+	return &postRepository{store: store}
+}
+
+func (r *postRepository) Create(ctx context.Context, post domain.Post) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[post.ID]; ok {
+		return domain.Conflict("post_exists", "Post already exists")
+	}
+	// The author is a foreign key; deleted users still satisfy it
+	if _, ok := s.users[post.Author]; !ok {
+		return domain.ErrUserNotFound
+	}
+	if !s.coverExists(post.CoverImageID) {
+		return domain.ErrInvalidCover
+	}
+
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = s.now()
+	}
+	if post.Status == "" {
+		post.Status = domain.PostStatusPublished
+	}
+	post.UpdatedAt = post.CreatedAt
+	post.Tags = nil
+	s.posts[post.ID] = post
+	return nil
+}
+
+func (r *postRepository) GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[id]
+	if !ok || !s.authorActive(post) {
+		return domain.PostSearchResponse{}, domain.ErrPostNotFound
+	}
+	return s.postResponse(post), nil
+}
+
+func (r *postRepository) Update(ctx context.Context, post *domain.Post, unmodifiedSince time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.posts[post.ID]
+	if !ok {
+		return domain.ErrPostNotFound
+	}
+	if !stored.UpdatedAt.Equal(unmodifiedSince) {
+		return domain.ErrPostModified
+	}
+	if !s.coverExists(post.CoverImageID) {
+		return domain.ErrInvalidCover
+	}
+
+	stored.Title = post.Title
+	stored.Content = post.Content
+	stored.Status = post.Status
+	stored.CoverImageID = post.CoverImageID
+	stored.CustomExcerpt = post.CustomExcerpt
+	stored.Excerpt = post.Excerpt
+	stored.WordCount = post.WordCount
+	stored.ReadingTime = post.ReadingTime
+	stored.UpdatedAt = s.now()
+	s.posts[post.ID] = stored
+	post.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *postRepository) List(ctx context.Context, filter domain.PostFilter) ([]domain.PostSearchResponse, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []domain.Post
+	for _, post := range s.posts {
+		if !s.authorActive(post) {
+			continue
+		}
+		if filter.AuthorID != "" && post.Author != filter.AuthorID {
+			continue
+		}
+		if filter.Tag != "" && !hasTag(post, filter.Tag) {
+			continue
+		}
+		if filter.Status != "" && post.Status != filter.Status {
+			continue
+		}
+		if filter.VisibleTo != "" && post.Status != domain.PostStatusPublished && post.Author != filter.VisibleTo {
+			continue
+		}
+		if filter.IDs != nil && !slices.Contains(filter.IDs, post.ID) {
+			continue
+		}
+		matched = append(matched, post)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		}
+		return matched[i].ID.String() > matched[j].ID.String()
+	})
+
+	posts := []domain.PostSearchResponse{}
+	for i := filter.Offset; i < len(matched) && len(posts) < filter.Limit; i++ {
+		posts = append(posts, s.postResponse(matched[i]))
+	}
+	return posts, nil
+}
+
+func hasTag(post domain.Post, name string) bool {
+	for _, tag := range post.Tags {
+		if tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *postRepository) SetTags(ctx context.Context, postID uuid.UUID, names []string) ([]domain.Tag, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return nil, domain.ErrPostNotFound
+	}
+
+	tags := make([]domain.Tag, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		tag, ok := s.tags[name]
+		if !ok {
+			tag = domain.Tag{ID: uuid.New(), Name: name}
+			s.tags[name] = tag
+		}
+		tags = append(tags, tag)
+	}
+
+	post.Tags = tags
+	s.posts[postID] = post
+	return append([]domain.Tag{}, tags...), nil
+}
+
+// coverExists checks the cover like the foreign key does; s.mu must be held
+func (s *Store) coverExists(id *uuid.UUID) bool {
+	if id == nil {
+		return true
+	}
+	_, ok := s.media[*id]
+	return ok
+}
+
+// postResponse joins the author the way the SQL query does; s.mu must be held
+// Посты удаленных пользователей не видны, как и в postSelect
+func (s *Store) authorActive(post domain.Post) bool {
+	author, ok := s.users[post.Author]
+	return ok && author.deletedAt == nil
+}
+
+func (s *Store) postResponse(post domain.Post) domain.PostSearchResponse {
+	author := s.users[post.Author].user
+
+	tags := append([]domain.Tag{}, post.Tags...)
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	return domain.PostSearchResponse{
+		ID:            post.ID,
+		Title:         post.Title,
+		Content:       post.Content,
+		Author:        domain.NewAuthorResponse(&author),
+		Status:        post.Status,
+		CoverImageID:  post.CoverImageID,
+		Excerpt:       post.Excerpt,
+		CustomExcerpt: post.CustomExcerpt,
+		WordCount:     post.WordCount,
+		ReadingTime:   post.ReadingTime,
+		CreatedAt:     post.CreatedAt,
+		UpdatedAt:     post.UpdatedAt,
+		Tags:          tags,
+	}
+}
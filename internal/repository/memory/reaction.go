@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type reactionKey struct {
+	postID uuid.UUID
+	userID string
+	kind   string
+}
+
+type reactionCountKey struct {
+	postID uuid.UUID
+	kind   string
+}
+
+type reactionCount struct {
+	count     int
+	updatedAt time.Time
+}
+
+type reactionRepository struct {
+	store *Store
+}
+
+func NewReactionRepository(store *Store) repository.ReactionRepository {
+	return &reactionRepository{store: store}
+}
+
+func (r *reactionRepository) Add(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return false, domain.ErrPostNotFound
+	}
+	key := reactionKey{postID: postID, userID: userID, kind: kind}
+	if s.reactions[key] {
+		return false, nil
+	}
+	s.reactions[key] = true
+	s.changeReactionCount(postID, kind, 1)
+	return true, nil
+}
+
+func (r *reactionRepository) Remove(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{postID: postID, userID: userID, kind: kind}
+	if !s.reactions[key] {
+		return false, nil
+	}
+	delete(s.reactions, key)
+	s.changeReactionCount(postID, kind, -1)
+	return true, nil
+}
+
+// changeReactionCount moves the counter and its updated_at together, as the
+// SQL repository does in one statement
+func (s *Store) changeReactionCount(postID uuid.UUID, kind string, delta int) {
+	key := reactionCountKey{postID: postID, kind: kind}
+	counter := s.reactionCounts[key]
+	counter.count += delta
+	counter.updatedAt = s.now()
+	s.reactionCounts[key] = counter
+}
+
+func (r *reactionRepository) Counts(ctx context.Context, postIDs []uuid.UUID) (map[uuid.UUID]repository.ReactionCounts, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[uuid.UUID]bool, len(postIDs))
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+	counts := make(map[uuid.UUID]repository.ReactionCounts, len(postIDs))
+	for key, counter := range s.reactionCounts {
+		if !wanted[key.postID] {
+			continue
+		}
+		post := counts[key.postID]
+		if counter.count > 0 {
+			if post.Counts == nil {
+				post.Counts = make(map[string]int)
+			}
+			post.Counts[key.kind] = counter.count
+		}
+		if counter.updatedAt.After(post.UpdatedAt) {
+			post.UpdatedAt = counter.updatedAt
+		}
+		counts[key.postID] = post
+	}
+	return counts, nil
+}
+
+func (r *reactionRepository) ByUser(ctx context.Context, userID string, postIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[uuid.UUID]bool, len(postIDs))
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+	kinds := make(map[uuid.UUID][]string, len(postIDs))
+	for key := range s.reactions {
+		if key.userID == userID && wanted[key.postID] {
+			kinds[key.postID] = append(kinds[key.postID], key.kind)
+		}
+	}
+	return kinds, nil
+}
@@ -0,0 +1,166 @@
+// Package memory implements the repository interfaces in memory. It follows
+// the semantics of the PostgreSQL repositories (soft delete, unique emails,
+// domain not-found errors) and is meant for tests and local experiments.
+package memory
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+)
+
+// Store holds the data of all in-memory repositories created from it, the
+// same way one database backs the PostgreSQL repositories
+type Store struct {
+	mu         sync.RWMutex
+	txMu       sync.Mutex
+	users      map[string]userRecord
+	posts      map[uuid.UUID]domain.Post
+	tags       map[string]domain.Tag
+	tokens     map[string]domain.PersonalAccessToken
+	identities map[identityKey]domain.UserIdentity
+	media      map[uuid.UUID]domain.Media
+	reactions  map[reactionKey]bool
+	// Денормализованные счётчики со временем изменения, как post_reaction_counts
+	reactionCounts map[reactionCountKey]reactionCount
+	// Закладки: время добавления
+	bookmarks    map[bookmarkKey]time.Time
+	readingLists map[uuid.UUID]domain.ReadingList
+	// Посты списков по порядку
+	readingListItems map[uuid.UUID][]domain.ReadingListEntry
+	// Прежние имена пользователей: имя -> ID владельца
+	usernames map[string]string
+	now       func() time.Time
+}
+
+type userRecord struct {
+	user      domain.User
+	deletedAt *time.Time
+}
+
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:      make(map[string]userRecord),
+		posts:      make(map[uuid.UUID]domain.Post),
+		tags:       make(map[string]domain.Tag),
+		tokens:     make(map[string]domain.PersonalAccessToken),
+		identities: make(map[identityKey]domain.UserIdentity),
+		media:      make(map[uuid.UUID]domain.Media),
+		reactions:  make(map[reactionKey]bool),
+		usernames:  make(map[string]string),
+		now:        time.Now,
+
+		reactionCounts: make(map[reactionCountKey]reactionCount),
+		bookmarks:      make(map[bookmarkKey]time.Time),
+		readingLists:   make(map[uuid.UUID]domain.ReadingList),
+
+		readingListItems: make(map[uuid.UUID][]domain.ReadingListEntry),
+	}
+}
+
+// SetClock replaces the time source used for created_at/updated_at
+func (s *Store) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+type snapshot struct {
+	users      map[string]userRecord
+	posts      map[uuid.UUID]domain.Post
+	tags       map[string]domain.Tag
+	tokens     map[string]domain.PersonalAccessToken
+	identities map[identityKey]domain.UserIdentity
+	media      map[uuid.UUID]domain.Media
+	reactions  map[reactionKey]bool
+	usernames  map[string]string
+
+	reactionCounts map[reactionCountKey]reactionCount
+	bookmarks      map[bookmarkKey]time.Time
+	readingLists   map[uuid.UUID]domain.ReadingList
+
+	readingListItems map[uuid.UUID][]domain.ReadingListEntry
+}
+
+func (s *Store) snapshot() snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return snapshot{
+		users:      maps.Clone(s.users),
+		posts:      maps.Clone(s.posts),
+		tags:       maps.Clone(s.tags),
+		tokens:     maps.Clone(s.tokens),
+		identities: maps.Clone(s.identities),
+		media:      maps.Clone(s.media),
+		reactions:  maps.Clone(s.reactions),
+		usernames:  maps.Clone(s.usernames),
+
+		reactionCounts: maps.Clone(s.reactionCounts),
+		bookmarks:      maps.Clone(s.bookmarks),
+		readingLists:   maps.Clone(s.readingLists),
+
+		readingListItems: maps.Clone(s.readingListItems),
+	}
+}
+
+func (s *Store) restore(snap snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = snap.users
+	s.posts = snap.posts
+	s.tags = snap.tags
+	s.tokens = snap.tokens
+	s.identities = snap.identities
+	s.media = snap.media
+	s.reactions = snap.reactions
+	s.usernames = snap.usernames
+	s.reactionCounts = snap.reactionCounts
+	s.bookmarks = snap.bookmarks
+	s.readingLists = snap.readingLists
+	s.readingListItems = snap.readingListItems
+}
+
+// Transactor implements service.Transactor for a Store. Units of work are
+// serialized and rolled back by restoring a snapshot when fn fails.
+type Transactor struct {
+	store *Store
+}
+
+func NewTransactor(store *Store) *Transactor {
+	return &Transactor{store: store}
+}
+
+type txKey struct{}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Nested calls join the outer unit of work
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	t.store.txMu.Lock()
+	defer t.store.txMu.Unlock()
+
+	// Like a database transaction: reads bypass caches and cache
+	// invalidations wait for the commit
+	ctx, runHooks := database.CollectCommitHooks(database.UsePrimary(context.WithValue(ctx, txKey{}, true)))
+
+	snap := t.store.snapshot()
+	if err := fn(ctx); err != nil {
+		t.store.restore(snap)
+		return err
+	}
+	runHooks()
+	return nil
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type tokenRepository struct {
+	store *Store
+}
+
+func NewTokenRepository(store *Store) repository.TokenRepository {
+	return &tokenRepository{store: store}
+}
+
+func (r *tokenRepository) Create(ctx context.Context, token *domain.PersonalAccessToken) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return domain.Conflict("token_exists", "Token already exists")
+		}
+	}
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = s.now()
+	}
+	s.tokens[token.ID] = *token
+	return nil
+}
+
+func (r *tokenRepository) FindByHash(ctx context.Context, hash string) (*domain.PersonalAccessToken, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.tokens {
+		if token.TokenHash == hash && token.RevokedAt == nil {
+			return &token, nil
+		}
+	}
+	return nil, domain.ErrTokenNotFound
+}
+
+func (r *tokenRepository) ListByUser(ctx context.Context, userID string) ([]domain.PersonalAccessToken, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []domain.PersonalAccessToken{}
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (r *tokenRepository) Revoke(ctx context.Context, userID, id string, at time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || token.UserID != userID || token.RevokedAt != nil {
+		return domain.ErrTokenNotFound
+	}
+	token.RevokedAt = &at
+	s.tokens[id] = token
+	return nil
+}
+
+func (r *tokenRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.tokens[id]; ok {
+		token.LastUsedAt = &at
+		s.tokens[id] = token
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+type userRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) repository.UserRepository {
+	return &userRepository{store: store}
+}
+
+func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; ok {
+		return domain.Conflict("user_exists", "User already exists")
+	}
+	if s.emailTaken(user.Email, "") {
+		return domain.ErrEmailTaken
+	}
+	if s.usernameTaken(user.Username, "") {
+		return domain.ErrUsernameTaken
+	}
+
+	user.CreatedAt = s.now()
+	user.UpdatedAt = user.CreatedAt
+	s.users[user.ID] = userRecord{user: *user}
+	return nil
+}
+
+func (r *userRepository) FindByID(ctx context.Context, id string) (*domain.User, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.users[id]
+	if !ok || record.deletedAt != nil {
+		return nil, domain.ErrUserNotFound
+	}
+	user := record.user
+	return &user, nil
+}
+
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, record := range s.users {
+		if record.deletedAt == nil && record.user.Email == email {
+			user := record.user
+			return &user, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *userRepository) FindByUsername(ctx context.Context, username string) (*domain.User, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, record := range s.users {
+		if record.deletedAt == nil && record.user.Username != "" && record.user.Username == username {
+			user := record.user
+			return &user, nil
+		}
+	}
+	if id, ok := s.usernames[username]; ok {
+		if record, ok := s.users[id]; ok && record.deletedAt == nil {
+			user := record.user
+			return &user, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[user.ID]
+	if !ok || record.deletedAt != nil {
+		return domain.ErrUserNotFound
+	}
+	if s.emailTaken(user.Email, user.ID) {
+		return domain.ErrEmailTaken
+	}
+	if s.usernameTaken(user.Username, user.ID) {
+		return domain.ErrUsernameTaken
+	}
+
+	user.CreatedAt = record.user.CreatedAt
+	user.UpdatedAt = s.now()
+	record.user = *user
+	s.users[user.ID] = record
+	return nil
+}
+
+func (r *userRepository) RecordUsernameChange(ctx context.Context, userID, oldUsername, newUsername string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usernames[newUsername] == userID {
+		delete(s.usernames, newUsername)
+	}
+	if _, ok := s.usernames[oldUsername]; oldUsername != "" && !ok {
+		s.usernames[oldUsername] = userID
+	}
+	return nil
+}
+
+// Delete is a soft delete: the user disappears from lookups and its email
+// becomes available again, as with the partial unique index in PostgreSQL
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[id]
+	if !ok || record.deletedAt != nil {
+		return domain.ErrUserNotFound
+	}
+	now := s.now()
+	record.deletedAt = &now
+	s.users[id] = record
+	return nil
+}
+
+// emailTaken must be called with s.mu held
+func (s *Store) emailTaken(email, exceptID string) bool {
+	for id, record := range s.users {
+		if id != exceptID && record.deletedAt == nil && record.user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// usernameTaken must be called with s.mu held. Like the unique index in
+// PostgreSQL, deleted users keep their usernames.
+func (s *Store) usernameTaken(username, exceptID string) bool {
+	if username == "" {
+		return false
+	}
+	for id, record := range s.users {
+		if id != exceptID && record.user.Username == username {
+			return true
+		}
+	}
+	return false
+}
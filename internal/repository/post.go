@@ -2,89 +2,328 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"lemara_blog/internal/database"
 	"lemara_blog/internal/domain"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
 // Интерфейс для работы с постами
 type PostRepository interface {
 	Create(ctx context.Context, post domain.Post) error
 	GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error)
-	//GetByTitle(ctx context.Context, title string) (domain.Post, error)
-	//Update(ctx context.Context, post domain.Post) error
-	//Delete(ctx context.Context, id int64) error
-	//List(ctx context.Context, limit, offset int) ([]domain.Post, error)
+	// Заменяет теги поста; отсутствующие теги создаются
+	SetTags(ctx context.Context, postID uuid.UUID, names []string) ([]domain.Tag, error)
+	// Update сохраняет заголовок, содержимое, статус, обложку и анонс, если
+	// пост не менялся с unmodifiedSince; иначе возвращает domain.ErrPostModified
+	Update(ctx context.Context, post *domain.Post, unmodifiedSince time.Time) error
+	List(ctx context.Context, filter domain.PostFilter) ([]domain.PostSearchResponse, error)
 }
 
-// Тип для работы с постами
+// Тип для работы с постами. Чтения идут в реплику, если она настроена
 type postRepository struct {
-	pool *pgxpool.Pool
+	db *database.Cluster
 }
 
 // Конструктор для создания нового экземпляра PostRepository
-func NewPostRepository(pool *pgxpool.Pool) PostRepository {
-	return &postRepository{pool: pool}
+func NewPostRepository(db *database.Cluster) PostRepository {
+	return &postRepository{db: db}
 }
 
+// The cover file was deleted between the check in PostService and the write
+const coverConstraint = "posts_cover_media_id_fkey"
+
 func (r *postRepository) Create(ctx context.Context, post domain.Post) error {
-	query := `INSERT INTO posts (id, title, content, author, created_at) VALUES ($1, $2, $3, $4, $5)`
+	query := `
+		INSERT INTO posts (id, title, content, author, status, cover_media_id, custom_excerpt, excerpt, word_count, reading_time, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+	`
 
-	post.CreatedAt = time.Now()
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = time.Now()
+	}
+	if post.Status == "" {
+		post.Status = domain.PostStatusPublished
+	}
 
-	_, err := r.pool.Exec(
+	_, err := r.db.Writer(ctx).Exec(
 		ctx,
 		query,
 		post.ID,
 		post.Title,
 		post.Content,
 		post.Author,
+		post.Status,
+		post.CoverImageID,
+		post.CustomExcerpt,
+		post.Excerpt,
+		post.WordCount,
+		post.ReadingTime,
 		post.CreatedAt)
-
+	if isConstraintViolation(err, coverConstraint) {
+		return domain.ErrInvalidCover
+	}
+	if isForeignKeyViolation(err) {
+		return domain.ErrUserNotFound
+	}
 
 	return err
 }
 
-func (r *postRepository) GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
-	query := `
-				SELECT
-					posts.id,
-					posts.title,
-					posts.content,
-					users.id AS author_id,
-					users.email AS author_email,
-					users.first_name AS author_first_name,
-					users.last_name AS author_last_name,
-					posts.created_at, posts.updated_at
-				FROM posts
-				JOIN users ON posts.author = users.id
-				WHERE posts.id = $1
-			`
+// Общая часть запросов, возвращающих PostSearchResponse. Посты удаленных
+// пользователей не показываются нигде: ни в ленте, ни в закладках, ни в
+// списках для чтения
+const postSelect = `
+	SELECT
+		posts.id,
+		posts.title,
+		posts.content,
+		users.id AS author_id,
+		COALESCE(users.username, '') AS author_username,
+		users.first_name AS author_first_name,
+		users.last_name AS author_last_name,
+		users.bio AS author_bio,
+		users.website AS author_website,
+		users.avatar_url AS author_avatar_url,
+		users.created_at AS author_created_at,
+		posts.status,
+		posts.cover_media_id, posts.excerpt, posts.custom_excerpt, posts.word_count, posts.reading_time,
+		posts.created_at, posts.updated_at
+	FROM posts
+	JOIN users ON posts.author = users.id AND users.deleted_at IS NULL
+`
 
+func scanPost(row pgx.Row) (domain.PostSearchResponse, error) {
 	var post domain.PostSearchResponse
-	// Вот тут добавить выбор нужных полей в запрос. Добавить в Author.Id поля из UserResponse
-	err := r.pool.QueryRow(
-		ctx,
-		query,
-		id,
-	).Scan(
+	err := row.Scan(
 		&post.ID,
 		&post.Title,
 		&post.Content,
 		&post.Author.ID,
-		&post.Author.Email,
+		&post.Author.Username,
 		&post.Author.FirstName,
 		&post.Author.LastName,
+		&post.Author.Bio,
+		&post.Author.Website,
+		&post.Author.AvatarURL,
+		&post.Author.CreatedAt,
+		&post.Status,
+		&post.CoverImageID,
+		&post.Excerpt,
+		&post.CustomExcerpt,
+		&post.WordCount,
+		&post.ReadingTime,
 		&post.CreatedAt,
 		&post.UpdatedAt,
-
 	)
+	return post, err
+}
 
+func (r *postRepository) GetByID(ctx context.Context, id uuid.UUID) (domain.PostSearchResponse, error) {
+	post, err := scanPost(r.db.Reader(ctx).QueryRow(ctx, postSelect+` WHERE posts.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.PostSearchResponse{}, domain.ErrPostNotFound
+	}
+	if err != nil {
+		return domain.PostSearchResponse{}, err
+	}
+
+	post.Tags, err = r.tags(ctx, id)
 	if err != nil {
 		return domain.PostSearchResponse{}, err
 	}
 
 	return post, nil
 }
+
+func (r *postRepository) List(ctx context.Context, filter domain.PostFilter) ([]domain.PostSearchResponse, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.AuthorID != "" {
+		args = append(args, filter.AuthorID)
+		where = append(where, fmt.Sprintf("posts.author = $%d", len(args)))
+	}
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		where = append(where, fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+			WHERE post_tags.post_id = posts.id AND tags.name = $%d
+		)`, len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("posts.status = $%d", len(args)))
+	}
+	if filter.VisibleTo != "" {
+		args = append(args, filter.VisibleTo)
+		where = append(where, fmt.Sprintf("(posts.status = 'published' OR posts.author = $%d)", len(args)))
+	}
+	if filter.IDs != nil {
+		args = append(args, filter.IDs)
+		where = append(where, fmt.Sprintf("posts.id = ANY($%d)", len(args)))
+	}
+
+	query := postSelect
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY posts.created_at DESC, posts.id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.Reader(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []domain.PostSearchResponse{}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+		ids = append(ids, post.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Теги всех постов страницы одним запросом
+	tags, err := r.tagsByPost(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Tags = tags[posts[i].ID]
+		if posts[i].Tags == nil {
+			posts[i].Tags = []domain.Tag{}
+		}
+	}
+	return posts, nil
+}
+
+func (r *postRepository) Update(ctx context.Context, post *domain.Post, unmodifiedSince time.Time) error {
+	query := `
+		UPDATE posts
+		SET title = $1, content = $2, status = $3, cover_media_id = $4, custom_excerpt = $5,
+			excerpt = $6, word_count = $7, reading_time = $8, updated_at = $9
+		WHERE id = $10 AND updated_at = $11
+	`
+
+	// PostgreSQL keeps microseconds; truncating keeps the returned value
+	// usable as the next unmodifiedSince
+	updatedAt := time.Now().Truncate(time.Microsecond)
+	db := r.db.Writer(ctx)
+	tag, err := db.Exec(ctx, query,
+		post.Title, post.Content, post.Status, post.CoverImageID, post.CustomExcerpt,
+		post.Excerpt, post.WordCount, post.ReadingTime, updatedAt, post.ID, unmodifiedSince)
+	if isConstraintViolation(err, coverConstraint) {
+		return domain.ErrInvalidCover
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)`, post.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return domain.ErrPostNotFound
+		}
+		return domain.ErrPostModified
+	}
+
+	post.UpdatedAt = updatedAt
+	return nil
+}
+
+// SetTags should run inside a transaction together with the post itself,
+// otherwise a failure leaves the post with part of its tags
+func (r *postRepository) SetTags(ctx context.Context, postID uuid.UUID, names []string) ([]domain.Tag, error) {
+	db := r.db.Writer(ctx)
+
+	if _, err := db.Exec(ctx, `DELETE FROM post_tags WHERE post_id = $1`, postID); err != nil {
+		return nil, err
+	}
+
+	tags := make([]domain.Tag, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		// DO UPDATE instead of DO NOTHING so RETURNING yields the existing row
+		tag := domain.Tag{Name: name}
+		err := db.QueryRow(ctx, `
+			INSERT INTO tags (id, name) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id
+		`, uuid.New(), name).Scan(&tag.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = db.Exec(ctx, `INSERT INTO post_tags (post_id, tag_id) VALUES ($1, $2)`, postID, tag.ID)
+		if isForeignKeyViolation(err) {
+			return nil, domain.ErrPostNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (r *postRepository) tags(ctx context.Context, postID uuid.UUID) ([]domain.Tag, error) {
+	tags, err := r.tagsByPost(ctx, []uuid.UUID{postID})
+	if err != nil {
+		return nil, err
+	}
+	if tags[postID] == nil {
+		return []domain.Tag{}, nil
+	}
+	return tags[postID], nil
+}
+
+func (r *postRepository) tagsByPost(ctx context.Context, postIDs []uuid.UUID) (map[uuid.UUID][]domain.Tag, error) {
+	tags := make(map[uuid.UUID][]domain.Tag, len(postIDs))
+	if len(postIDs) == 0 {
+		return tags, nil
+	}
+
+	rows, err := r.db.Reader(ctx).Query(ctx, `
+		SELECT post_tags.post_id, tags.id, tags.name
+		FROM post_tags
+		JOIN tags ON tags.id = post_tags.tag_id
+		WHERE post_tags.post_id = ANY($1)
+		ORDER BY tags.name
+	`, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID uuid.UUID
+		var tag domain.Tag
+		if err := rows.Scan(&postID, &tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags[postID] = append(tags[postID], tag)
+	}
+	return tags, rows.Err()
+}
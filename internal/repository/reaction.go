@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// Интерфейс репозитория реакций на посты. Add и Remove меняют и счётчики,
+// поэтому вызываются в транзакции
+type ReactionRepository interface {
+	// Add записывает реакцию; false, если она уже была
+	Add(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error)
+	// Remove удаляет реакцию; false, если её не было
+	Remove(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error)
+	// Counts returns the counters of the posts that ever had a reaction
+	Counts(ctx context.Context, postIDs []uuid.UUID) (map[uuid.UUID]ReactionCounts, error)
+	// ByUser returns the kinds userID reacted with to each of the posts
+	ByUser(ctx context.Context, userID string, postIDs []uuid.UUID) (map[uuid.UUID][]string, error)
+}
+
+// Счётчики реакций одного поста
+type ReactionCounts struct {
+	// kind -> count, только ненулевые
+	Counts map[string]int
+	// Последнее изменение любого из счётчиков, в том числе до нуля
+	UpdatedAt time.Time
+}
+
+type reactionRepository struct {
+	db *database.Cluster
+}
+
+func NewReactionRepository(db *database.Cluster) ReactionRepository {
+	return &reactionRepository{db: db}
+}
+
+func (r *reactionRepository) Add(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error) {
+	db := r.db.Writer(ctx)
+
+	tag, err := db.Exec(ctx, `
+		INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, postID, userID, kind)
+	if isForeignKeyViolation(err) {
+		return false, domain.ErrPostNotFound
+	}
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO post_reaction_counts (post_id, kind, count) VALUES ($1, $2, 1)
+		ON CONFLICT (post_id, kind) DO UPDATE SET count = post_reaction_counts.count + 1, updated_at = NOW()
+	`, postID, kind)
+	return err == nil, err
+}
+
+func (r *reactionRepository) Remove(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error) {
+	db := r.db.Writer(ctx)
+
+	tag, err := db.Exec(ctx, `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3`, postID, userID, kind)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+
+	_, err = db.Exec(ctx, `
+		UPDATE post_reaction_counts SET count = count - 1, updated_at = NOW()
+		WHERE post_id = $1 AND kind = $2
+	`, postID, kind)
+	return err == nil, err
+}
+
+func (r *reactionRepository) Counts(ctx context.Context, postIDs []uuid.UUID) (map[uuid.UUID]ReactionCounts, error) {
+	// Zero counters are read too: removing the last reaction changes the post
+	rows, err := r.db.Reader(ctx).Query(ctx, `
+		SELECT post_id, kind, count, updated_at FROM post_reaction_counts
+		WHERE post_id = ANY($1)
+	`, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[uuid.UUID]ReactionCounts, len(postIDs))
+	for rows.Next() {
+		var (
+			postID    uuid.UUID
+			kind      string
+			count     int
+			updatedAt time.Time
+		)
+		if err := rows.Scan(&postID, &kind, &count, &updatedAt); err != nil {
+			return nil, err
+		}
+		counts[postID] = counts[postID].add(kind, count, updatedAt)
+	}
+	return counts, rows.Err()
+}
+
+// add merges the counter of one kind in
+func (c ReactionCounts) add(kind string, count int, updatedAt time.Time) ReactionCounts {
+	if count > 0 {
+		if c.Counts == nil {
+			c.Counts = make(map[string]int)
+		}
+		c.Counts[kind] = count
+	}
+	if updatedAt.After(c.UpdatedAt) {
+		c.UpdatedAt = updatedAt
+	}
+	return c
+}
+
+func (r *reactionRepository) ByUser(ctx context.Context, userID string, postIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	rows, err := r.db.Reader(ctx).Query(ctx, `
+		SELECT post_id, kind FROM post_reactions
+		WHERE user_id = $1 AND post_id = ANY($2)
+	`, userID, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kinds := make(map[uuid.UUID][]string, len(postIDs))
+	for rows.Next() {
+		var (
+			postID uuid.UUID
+			kind   string
+		)
+		if err := rows.Scan(&postID, &kind); err != nil {
+			return nil, err
+		}
+		kinds[postID] = append(kinds[postID], kind)
+	}
+	return kinds, rows.Err()
+}
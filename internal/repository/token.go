@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Интерфейс репозитория персональных токенов
+type TokenRepository interface {
+	Create(ctx context.Context, token *domain.PersonalAccessToken) error
+	FindByHash(ctx context.Context, hash string) (*domain.PersonalAccessToken, error)
+	ListByUser(ctx context.Context, userID string) ([]domain.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, id string, at time.Time) error
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+type tokenRepository struct {
+	db *database.Cluster
+}
+
+func NewTokenRepository(db *database.Cluster) TokenRepository {
+	return &tokenRepository{db: db}
+}
+
+const tokenColumns = `id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, created_at, revoked_at`
+
+func scanToken(row pgx.Row) (*domain.PersonalAccessToken, error) {
+	var token domain.PersonalAccessToken
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&token.TokenHash,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+		&token.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *tokenRepository) Create(ctx context.Context, token *domain.PersonalAccessToken) error {
+	query := `
+		INSERT INTO personal_access_tokens (id, user_id, name, token_prefix, token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.Writer(ctx).Exec(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.Prefix,
+		token.TokenHash,
+		token.Scopes,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	return err
+}
+
+// Поиск активного (не отозванного) токена по хешу
+func (r *tokenRepository) FindByHash(ctx context.Context, hash string) (*domain.PersonalAccessToken, error) {
+	query := `SELECT ` + tokenColumns + ` FROM personal_access_tokens WHERE token_hash = $1 AND revoked_at IS NULL`
+
+	token, err := scanToken(r.db.Conn(ctx).QueryRow(ctx, query, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrTokenNotFound
+	}
+	return token, err
+}
+
+func (r *tokenRepository) ListByUser(ctx context.Context, userID string) ([]domain.PersonalAccessToken, error) {
+	query := `
+		SELECT ` + tokenColumns + `
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []domain.PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// Отзыв токена. Токен другого пользователя считается не найденным
+func (r *tokenRepository) Revoke(ctx context.Context, userID, id string, at time.Time) error {
+	query := `
+		UPDATE personal_access_tokens
+		SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+
+	tag, err := r.db.Writer(ctx).Exec(ctx, query, at, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrTokenNotFound
+	}
+	return nil
+}
+
+func (r *tokenRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.Writer(ctx).Exec(ctx, `UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
@@ -5,125 +5,180 @@ import (
 	"errors"
 	"time"
 
+	"lemara_blog/internal/database"
 	"lemara_blog/internal/domain"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Интерфейс репозитория пользователей
+// Интерфейс репозитория пользователей.
+// Если пользователь не найден, методы возвращают domain.ErrUserNotFound
 type UserRepository interface {
     Create(ctx context.Context, user *domain.User) error
     FindByID(ctx context.Context, id string) (*domain.User, error)
     FindByEmail(ctx context.Context, email string) (*domain.User, error)
+    // FindByUsername находит пользователя по текущему или прежнему имени;
+    // прежнее имя можно узнать, сравнив его с user.Username
+    FindByUsername(ctx context.Context, username string) (*domain.User, error)
     Update(ctx context.Context, user *domain.User) error
+    // RecordUsernameChange сохраняет прежнее имя пользователя в истории и
+    // освобождает newUsername, если это одно из его прежних имён.
+    // Вызывается в одной транзакции с Update
+    RecordUsernameChange(ctx context.Context, userID, oldUsername, newUsername string) error
     Delete(ctx context.Context, id string) error
 }
 
+// Пользователи читаются только из primary: вход и смена пароля не должны
+// зависеть от задержки репликации
 type userRepository struct {
-    pool *pgxpool.Pool
+    db *database.Cluster
 }
 
-func NewUserRepository(pool *pgxpool.Pool) UserRepository {
-    return &userRepository{pool: pool}
+func NewUserRepository(db *database.Cluster) UserRepository {
+    return &userRepository{db: db}
+}
+
+const userColumns = `id, email, COALESCE(username, ''), first_name, last_name, bio, website, avatar_url, password_hash, created_at, updated_at`
+
+func scanUser(row pgx.Row) (*domain.User, error) {
+    var user domain.User
+    err := row.Scan(
+        &user.ID,
+        &user.Email,
+        &user.Username,
+        &user.FirstName,
+        &user.LastName,
+        &user.Bio,
+        &user.Website,
+        &user.AvatarURL,
+        &user.PasswordHash,
+        &user.CreatedAt,
+        &user.UpdatedAt,
+    )
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, domain.ErrUserNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+// Имя пользователя и email уникальны, остальные нарушения уникальности - ошибки
+func userConflict(err error) error {
+    if isConstraintViolation(err, "users_username_idx") {
+        return domain.ErrUsernameTaken
+    }
+    if isUniqueViolation(err) {
+        return domain.ErrEmailTaken
+    }
+    return err
 }
 
 // Создание нового пользователя
 func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
     query := `
-        INSERT INTO users (id, email, first_name, last_name, password_hash, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        INSERT INTO users (id, email, username, first_name, last_name, bio, website, avatar_url, password_hash, created_at, updated_at)
+        VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11)
     `
 
     user.CreatedAt = time.Now()
     user.UpdatedAt = user.CreatedAt
 
-    _, err := r.pool.Exec(ctx, query,
+    _, err := r.db.Writer(ctx).Exec(ctx, query,
         user.ID,
         user.Email,
+        user.Username,
         user.FirstName,
         user.LastName,
+        user.Bio,
+        user.Website,
+        user.AvatarURL,
         user.PasswordHash,
         user.CreatedAt,
         user.UpdatedAt,
     )
-
-    return err
+    return userConflict(err)
 }
 
 // Поиск пользователя по ID
 func (r *userRepository) FindByID(ctx context.Context, id string) (*domain.User, error) {
-    query := `
-        SELECT id, email, first_name, last_name, password_hash, created_at, updated_at
-        FROM users
-        WHERE id = $1 AND deleted_at IS NULL
-    `
-
-    var user domain.User
-    err := r.pool.QueryRow(ctx, query, id).Scan(
-        &user.ID,
-        &user.Email,
-        &user.FirstName,
-        &user.LastName,
-        &user.PasswordHash,
-        &user.CreatedAt,
-        &user.UpdatedAt,
-    )
-
-    if errors.Is(err, pgx.ErrNoRows) {
-        return nil, nil
-    }
+    query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 
-    return &user, err
+    return scanUser(r.db.Conn(ctx).QueryRow(ctx, query, id))
 }
 
 // Поиск пользователя по email
 func (r *userRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+    query := `SELECT ` + userColumns + ` FROM users WHERE email = $1 AND deleted_at IS NULL`
+
+    return scanUser(r.db.Conn(ctx).QueryRow(ctx, query, email))
+}
+
+// Поиск по текущему имени, затем по истории имён
+func (r *userRepository) FindByUsername(ctx context.Context, username string) (*domain.User, error) {
     query := `
-        SELECT id, email, first_name, last_name, password_hash, created_at, updated_at
+        SELECT ` + userColumns + `
         FROM users
-        WHERE email = $1 AND deleted_at IS NULL
+        WHERE deleted_at IS NULL AND (
+            username = $1
+            OR id = (SELECT user_id FROM username_history WHERE username = $1)
+        )
+        ORDER BY username IS NOT DISTINCT FROM $1 DESC
+        LIMIT 1
     `
 
-    var user domain.User
-    err := r.pool.QueryRow(ctx, query, email).Scan(
-        &user.ID,
-        &user.Email,
-        &user.FirstName,
-        &user.LastName,
-        &user.PasswordHash,
-        &user.CreatedAt,
-        &user.UpdatedAt,
-    )
-
-    if errors.Is(err, pgx.ErrNoRows) {
-        return nil, nil
-    }
-
-    return &user, err
+    return scanUser(r.db.Conn(ctx).QueryRow(ctx, query, username))
 }
 
 // Обновление пользователя
 func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
     query := `
         UPDATE users
-        SET email = $1, first_name = $2, last_name = $3, password_hash = $4, updated_at = $5
-        WHERE id = $6 AND deleted_at IS NULL
+        SET email = $1, username = NULLIF($2, ''), first_name = $3, last_name = $4,
+            bio = $5, website = $6, avatar_url = $7, password_hash = $8, updated_at = $9
+        WHERE id = $10 AND deleted_at IS NULL
     `
 
     user.UpdatedAt = time.Now()
-    _, err := r.pool.Exec(ctx, query,
+    tag, err := r.db.Writer(ctx).Exec(ctx, query,
         user.Email,
+        user.Username,
         user.FirstName,
         user.LastName,
+        user.Bio,
+        user.Website,
+        user.AvatarURL,
         user.PasswordHash,
         user.UpdatedAt,
         user.ID,
     )
+    if err != nil {
+        return userConflict(err)
+    }
+    if tag.RowsAffected() == 0 {
+        return domain.ErrUserNotFound
+    }
 
-    return err
+    return nil
 }
 
+func (r *userRepository) RecordUsernameChange(ctx context.Context, userID, oldUsername, newUsername string) error {
+    db := r.db.Writer(ctx)
+
+    if _, err := db.Exec(ctx, `DELETE FROM username_history WHERE username = $1 AND user_id = $2`, newUsername, userID); err != nil {
+        return err
+    }
+    if oldUsername == "" {
+        return nil
+    }
+
+    _, err := db.Exec(ctx, `
+        INSERT INTO username_history (username, user_id, changed_at) VALUES ($1, $2, $3)
+        ON CONFLICT (username) DO NOTHING
+    `, oldUsername, userID, time.Now())
+    return err
+}
 
 // Удаление пользователя
 func (r *userRepository) Delete(ctx context.Context, id string) error {
@@ -133,6 +188,12 @@ func (r *userRepository) Delete(ctx context.Context, id string) error {
         WHERE id = $2 AND deleted_at IS NULL
     `
 
-    _, err := r.pool.Exec(ctx, query, time.Now(), id)
-    return err
+    tag, err := r.db.Writer(ctx).Exec(ctx, query, time.Now(), id)
+    if err != nil {
+        return err
+    }
+    if tag.RowsAffected() == 0 {
+        return domain.ErrUserNotFound
+    }
+    return nil
 }
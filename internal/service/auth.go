@@ -2,48 +2,63 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"time"
 
 	"lemara_blog/internal/config"
 	"lemara_blog/internal/domain"
+	"lemara_blog/internal/logging"
+	"lemara_blog/internal/metrics"
+	"lemara_blog/internal/password"
 	"lemara_blog/internal/repository"
+	"lemara_blog/internal/tracing"
 	"lemara_blog/internal/utils"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService interface {
     Register(ctx context.Context, req *domain.CreateUserRequest) (*domain.AuthResponse, error)
     Login(ctx context.Context, req *domain.LoginRequest) (*domain.AuthResponse, error)
+    LoginExternal(ctx context.Context, login *domain.ExternalLogin) (*domain.AuthResponse, error)
     HashPassword(password string) (string, error)
     ComparePassword(hashedPassword, password string) error
 }
 
+var ErrEmailNotVerified = domain.Forbidden("email_not_verified", "Email is not verified by the identity provider")
+
 type authService struct {
-    userRepo repository.UserRepository
-    config   *config.Config
+    userRepo     repository.UserRepository
+    identityRepo repository.IdentityRepository
+    tx           Transactor
+    passwords    *password.Manager
+    config       *config.Config
 }
 
-func NewAuthService(userRepo repository.UserRepository, config *config.Config) AuthService {
+func NewAuthService(userRepo repository.UserRepository, identityRepo repository.IdentityRepository, tx Transactor, passwords *password.Manager, config *config.Config) AuthService {
     return &authService{
-        userRepo: userRepo,
-        config:   config,
+        userRepo:     userRepo,
+        identityRepo: identityRepo,
+        tx:           tx,
+        passwords:    passwords,
+        config:       config,
     }
 }
 
-func (s *authService) Register(ctx context.Context, req *domain.CreateUserRequest) (*domain.AuthResponse, error) {
+func (s *authService) Register(ctx context.Context, req *domain.CreateUserRequest) (_ *domain.AuthResponse, err error) {
+    ctx, span := tracing.Start(ctx, "AuthService.Register")
+    defer func() { tracing.RecordError(span, err); span.End() }()
+
     // Check if user already exists
-    existingUser, err := s.userRepo.FindByEmail(ctx, req.Email)
-    if err != nil {
-        return nil, err
+    _, err = s.userRepo.FindByEmail(ctx, req.Email)
+    if err == nil {
+        return nil, domain.ErrEmailTaken
     }
-    if existingUser != nil {
-        return nil, errors.New("user already exists")
+    if !errors.Is(err, domain.ErrNotFound) {
+        return nil, err
     }
 
     // Hash password
-    hashedPassword, err := s.HashPassword(req.Password)
+    hashedPassword, err := s.hashPassword(ctx, req.Password)
     if err != nil {
         return nil, err
     }
@@ -58,6 +73,7 @@ func (s *authService) Register(ctx context.Context, req *domain.CreateUserReques
     if err := s.userRepo.Create(ctx, user); err != nil {
         return nil, err
     }
+    metrics.UserRegistered(metrics.LoginPassword)
 
     // Generate token
     token, err := utils.GenerateToken(user.ID, user.Email, s.config.JWTSecret, s.config.JWTExpiration)
@@ -75,19 +91,37 @@ func (s *authService) Register(ctx context.Context, req *domain.CreateUserReques
     }, nil
 }
 
-func (s *authService) Login(ctx context.Context, req *domain.LoginRequest) (*domain.AuthResponse, error) {
+func (s *authService) Login(ctx context.Context, req *domain.LoginRequest) (_ *domain.AuthResponse, err error) {
+    ctx, span := tracing.Start(ctx, "AuthService.Login")
+    defer func() { tracing.RecordError(span, err); span.End() }()
+
     // Find user by email
     user, err := s.userRepo.FindByEmail(ctx, req.Email)
+    if errors.Is(err, domain.ErrNotFound) {
+        metrics.LoginFailed(metrics.LoginPassword)
+        return nil, domain.ErrInvalidCredentials
+    }
     if err != nil {
         return nil, err
     }
-    if user == nil {
-        return nil, errors.New("invalid credentials")
-    }
 
     // Compare password
-    if err := s.ComparePassword(user.PasswordHash, req.Password); err != nil {
-        return nil, errors.New("invalid credentials")
+    ok, needsRehash, err := s.verifyPassword(ctx, user.PasswordHash, req.Password)
+    if err != nil || !ok {
+        metrics.LoginFailed(metrics.LoginPassword)
+        return nil, domain.ErrInvalidCredentials
+    }
+    metrics.LoginSucceeded(metrics.LoginPassword)
+
+    // Upgrade hashes made with an old algorithm or weaker parameters while
+    // we have the plain password at hand. A failure here must not block login.
+    if needsRehash {
+        if hashed, err := s.hashPassword(ctx, req.Password); err == nil {
+            user.PasswordHash = hashed
+            if err := s.userRepo.Update(ctx, user); err != nil {
+                logging.FromContext(ctx).Warn("failed to rehash password", "user_id", user.ID, "error", err)
+            }
+        }
     }
 
     // Generate token
@@ -108,13 +142,119 @@ func (s *authService) Login(ctx context.Context, req *domain.LoginRequest) (*dom
     }, nil
 }
 
-func (s *authService) HashPassword(password string) (string, error) {
-    bytes, err := bcrypt.GenerateFromPassword([]byte(password), s.config.BcryptCost)
-    return string(bytes), err
+// LoginExternal signs in a user authenticated by an OIDC provider. A known
+// identity logs straight in; otherwise it is linked to the user with the same
+// verified email, or a new user without a password is created.
+func (s *authService) LoginExternal(ctx context.Context, login *domain.ExternalLogin) (_ *domain.AuthResponse, err error) {
+    ctx, span := tracing.Start(ctx, "AuthService.LoginExternal")
+    defer func() { tracing.RecordError(span, err); span.End() }()
+
+    identity, err := s.identityRepo.Find(ctx, login.Provider, login.Subject)
+    if err != nil && !errors.Is(err, domain.ErrNotFound) {
+        return nil, err
+    }
+
+    var user *domain.User
+    if identity != nil {
+        user, err = s.userRepo.FindByID(ctx, identity.UserID)
+        if errors.Is(err, domain.ErrNotFound) {
+            metrics.LoginFailed(metrics.LoginOIDC)
+            return nil, domain.ErrInvalidCredentials
+        }
+        if err != nil {
+            return nil, err
+        }
+    } else {
+        // Linking by email is only safe when the provider vouches for it
+        if login.Email == "" || !login.EmailVerified {
+            metrics.LoginFailed(metrics.LoginOIDC)
+            return nil, ErrEmailNotVerified
+        }
+
+        // The new user and its identity are created together, so a failed
+        // link doesn't leave a password-less account behind
+        created := false
+        err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+            var err error
+            created = false
+            user, err = s.userRepo.FindByEmail(ctx, login.Email)
+            if errors.Is(err, domain.ErrNotFound) {
+                user = nil
+            } else if err != nil {
+                return err
+            }
+            if user == nil {
+                user = &domain.User{
+                    ID:        generateID(),
+                    Email:     login.Email,
+                    FirstName: login.FirstName,
+                    LastName:  login.LastName,
+                }
+                if err := s.userRepo.Create(ctx, user); err != nil {
+                    return err
+                }
+                created = true
+            }
+
+            return s.identityRepo.Create(ctx, &domain.UserIdentity{
+                Provider: login.Provider,
+                Subject:  login.Subject,
+                UserID:   user.ID,
+                Email:    login.Email,
+            })
+        })
+        if err != nil {
+            return nil, err
+        }
+        if created {
+            metrics.UserRegistered(metrics.LoginOIDC)
+        }
+    }
+    metrics.LoginSucceeded(metrics.LoginOIDC)
+
+    token, err := utils.GenerateToken(user.ID, user.Email, s.config.JWTSecret, s.config.JWTExpiration)
+    if err != nil {
+        return nil, err
+    }
+
+    return &domain.AuthResponse{
+        Token: token,
+        User: domain.UserResponse{
+            ID:        user.ID,
+            Email:     user.Email,
+            FirstName: user.FirstName,
+            LastName:  user.LastName,
+            CreatedAt: user.CreatedAt,
+        },
+    }, nil
+}
+
+func (s *authService) HashPassword(plain string) (string, error) {
+    return s.passwords.Hash(plain)
+}
+
+// Hashing is deliberately slow, so it gets its own span
+func (s *authService) hashPassword(ctx context.Context, plain string) (string, error) {
+    _, span := tracing.Start(ctx, "password.hash")
+    defer span.End()
+    return s.passwords.Hash(plain)
 }
 
-func (s *authService) ComparePassword(hashedPassword, password string) error {
-    return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+func (s *authService) verifyPassword(ctx context.Context, hashed, plain string) (bool, bool, error) {
+    _, span := tracing.Start(ctx, "password.verify")
+    defer span.End()
+    return s.passwords.Verify(hashed, plain)
+}
+
+func (s *authService) ComparePassword(hashedPassword, plain string) error {
+    ok, _, err := s.passwords.Verify(hashedPassword, plain)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return domain.ErrInvalidCredentials
+    }
+    return nil
 }
 
 func generateID() string {
@@ -123,9 +263,11 @@ func generateID() string {
 
 func randomString(n int) string {
     const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+    // crypto/rand: characters derived from the clock repeat within a second
     result := make([]byte, n)
+    rand.Read(result)
     for i := range result {
-        result[i] = letters[time.Now().UnixNano()%int64(len(letters))]
+        result[i] = letters[int(result[i])%len(letters)]
     }
     return string(result)
 }
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/tracing"
+	"lemara_blog/internal/validation"
+)
+
+// Больше постов в одном списке не добавить
+const maxReadingListPosts = 500
+
+// BookmarkService keeps the saved posts of readers: bookmarks and named
+// reading lists. Readers only see posts they may read, and posts that stop
+// being published leave the bookmarks and lists of everyone but the author.
+type BookmarkService struct {
+	bookmarks repository.BookmarkRepository
+	lists     repository.ReadingListRepository
+	posts     repository.PostRepository
+	reactions *ReactionService
+	covers    covers
+	tx        Transactor
+}
+
+// NewBookmarkService adds reactions to the returned posts unless reactions is
+// nil. Covers of the posts are loaded from media.
+func NewBookmarkService(bookmarks repository.BookmarkRepository, lists repository.ReadingListRepository,
+	posts repository.PostRepository, reactions *ReactionService, media repository.MediaRepository, tx Transactor) *BookmarkService {
+	return &BookmarkService{bookmarks: bookmarks, lists: lists, posts: posts, reactions: reactions, covers: covers{media: media}, tx: tx}
+}
+
+// Bookmark saves a post userID can see. Repeating it keeps the original
+// time.
+func (s *BookmarkService) Bookmark(ctx context.Context, userID string, postID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.Bookmark")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.checkVisible(ctx, postID, userID); err != nil {
+			return err
+		}
+		_, err := s.bookmarks.Add(ctx, userID, postID)
+		return err
+	})
+}
+
+// Unbookmark removes a bookmark; removing an absent one is not an error
+func (s *BookmarkService) Unbookmark(ctx context.Context, userID string, postID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.Unbookmark")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.bookmarks.Remove(ctx, userID, postID)
+}
+
+// ListBookmarks returns a page of the bookmarks of userID, newest first
+func (s *BookmarkService) ListBookmarks(ctx context.Context, userID string, limit, offset int) (_ *domain.BookmarkListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.ListBookmarks")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := s.bookmarks.List(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.PostID
+	}
+	posts, err := s.loadPosts(ctx, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := []domain.Bookmark{}
+	for _, entry := range entries {
+		if post, ok := posts[entry.PostID]; ok {
+			bookmarks = append(bookmarks, domain.Bookmark{Post: post, BookmarkedAt: entry.CreatedAt})
+		}
+	}
+	return &domain.BookmarkListResponse{Bookmarks: bookmarks, Limit: limit, Offset: offset}, nil
+}
+
+// Метод для создания списка для чтения
+func (s *BookmarkService) CreateList(ctx context.Context, ownerID string, req *domain.ReadingListRequest) (_ *domain.ReadingList, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.CreateList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+
+	list := &domain.ReadingList{
+		ID:          uuid.New(),
+		OwnerID:     ownerID,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if req.Shared {
+		if list.ShareToken, err = generateShareToken(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.lists.Create(ctx, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Lists returns the reading lists of ownerID without their posts
+func (s *BookmarkService) Lists(ctx context.Context, ownerID string) (_ []domain.ReadingList, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.Lists")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.lists.ListByOwner(ctx, ownerID)
+}
+
+// GetList returns a list of ownerID with its posts in order. Lists of other
+// users are not found.
+func (s *BookmarkService) GetList(ctx context.Context, ownerID string, id uuid.UUID) (_ *domain.ReadingList, _ []domain.ReadingListItem, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.GetList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	list, err := s.ownList(ctx, ownerID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := s.listItems(ctx, list, ownerID)
+	return list, items, err
+}
+
+// SharedList returns a shared list by its token. Anyone with the link sees
+// the published posts of the list.
+func (s *BookmarkService) SharedList(ctx context.Context, token string) (_ *domain.ReadingList, _ []domain.ReadingListItem, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.SharedList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	list, err := s.lists.GetByShareToken(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := s.listItems(ctx, list, "")
+	return list, items, err
+}
+
+// UpdateList applies the fields present in req
+func (s *BookmarkService) UpdateList(ctx context.Context, ownerID string, id uuid.UUID, req *domain.ReadingListUpdateRequest) (_ *domain.ReadingList, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.UpdateList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+
+	var list *domain.ReadingList
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.lists.LockList(ctx, id); err != nil {
+			return err
+		}
+		if list, err = s.ownList(ctx, ownerID, id); err != nil {
+			return err
+		}
+		if req.Name != nil {
+			list.Name = *req.Name
+		}
+		if req.Description != nil {
+			list.Description = *req.Description
+		}
+		// Уже открытый список сохраняет свою ссылку
+		if req.Shared != nil && *req.Shared != list.IsShared() {
+			list.ShareToken = ""
+			if *req.Shared {
+				if list.ShareToken, err = generateShareToken(); err != nil {
+					return err
+				}
+			}
+		}
+		return s.lists.Update(ctx, list)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// DeleteList removes a list of ownerID; the posts themselves stay
+func (s *BookmarkService) DeleteList(ctx context.Context, ownerID string, id uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.DeleteList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.lists.Delete(ctx, ownerID, id)
+}
+
+// AddToList puts a post ownerID can see into a list at req.Position (the
+// end when it is missing or past the end). A post already in the list is
+// moved, or stays in place without a position.
+func (s *BookmarkService) AddToList(ctx context.Context, ownerID string, id, postID uuid.UUID, req *domain.ReadingListItemRequest) (_ *domain.ReadingList, _ []domain.ReadingListItem, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.AddToList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if err := validation.Validate(req); err != nil {
+		return nil, nil, err
+	}
+
+	return s.changeItems(ctx, ownerID, id, func(ctx context.Context, items []domain.ReadingListEntry) ([]domain.ReadingListEntry, error) {
+		if err := s.checkVisible(ctx, postID, ownerID); err != nil {
+			return nil, err
+		}
+
+		entry := domain.ReadingListEntry{PostID: postID}
+		if i := slices.IndexFunc(items, func(item domain.ReadingListEntry) bool { return item.PostID == postID }); i >= 0 {
+			if req.Position == nil {
+				return items, nil
+			}
+			entry = items[i]
+			items = slices.Delete(items, i, i+1)
+		} else if len(items) >= maxReadingListPosts {
+			return nil, domain.ErrReadingListFull
+		}
+
+		position := len(items)
+		if req.Position != nil && *req.Position < position {
+			position = *req.Position
+		}
+		return slices.Insert(items, position, entry), nil
+	})
+}
+
+// RemoveFromList takes a post out of a list; removing an absent one is not
+// an error
+func (s *BookmarkService) RemoveFromList(ctx context.Context, ownerID string, id, postID uuid.UUID) (_ *domain.ReadingList, _ []domain.ReadingListItem, err error) {
+	ctx, span := tracing.Start(ctx, "BookmarkService.RemoveFromList")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.changeItems(ctx, ownerID, id, func(ctx context.Context, items []domain.ReadingListEntry) ([]domain.ReadingListEntry, error) {
+		return slices.DeleteFunc(items, func(item domain.ReadingListEntry) bool { return item.PostID == postID }), nil
+	})
+}
+
+// changeItems rewrites the posts of a list of ownerID with change and
+// returns the list as it is afterwards
+func (s *BookmarkService) changeItems(ctx context.Context, ownerID string, id uuid.UUID,
+	change func(ctx context.Context, items []domain.ReadingListEntry) ([]domain.ReadingListEntry, error)) (*domain.ReadingList, []domain.ReadingListItem, error) {
+	// Список блокируется, чтобы параллельные изменения не потеряли друг друга
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.lists.LockList(ctx, id); err != nil {
+			return err
+		}
+		if _, err := s.ownList(ctx, ownerID, id); err != nil {
+			return err
+		}
+		items, err := s.lists.Items(ctx, id)
+		if err != nil {
+			return err
+		}
+		if items, err = change(ctx, items); err != nil {
+			return err
+		}
+		return s.lists.SetItems(ctx, id, items)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.GetList(ctx, ownerID, id)
+}
+
+// postHidden removes a post that is no longer published from the bookmarks
+// and reading lists of readers. The author keeps theirs: they still see the
+// post. Runs in the transaction of the post update.
+func (s *BookmarkService) postHidden(ctx context.Context, postID uuid.UUID, authorID string) error {
+	if err := s.bookmarks.RemovePost(ctx, postID, authorID); err != nil {
+		return err
+	}
+	return s.lists.RemovePost(ctx, postID, authorID)
+}
+
+func (s *BookmarkService) ownList(ctx context.Context, ownerID string, id uuid.UUID) (*domain.ReadingList, error) {
+	list, err := s.lists.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if list.OwnerID != ownerID {
+		return nil, domain.ErrReadingListNotFound
+	}
+	return list, nil
+}
+
+// checkVisible hides drafts of other users the same way GetPostByID does
+func (s *BookmarkService) checkVisible(ctx context.Context, postID uuid.UUID, userID string) error {
+	post, err := s.posts.GetByID(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if post.Status != domain.PostStatusPublished && post.Author.ID != userID {
+		return domain.ErrPostNotFound
+	}
+	return nil
+}
+
+// listItems returns the posts of a list viewerID can see (the published
+// ones for an empty viewerID) in the order of the list
+func (s *BookmarkService) listItems(ctx context.Context, list *domain.ReadingList, viewerID string) ([]domain.ReadingListItem, error) {
+	entries, err := s.lists.Items(ctx, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.PostID
+	}
+	posts, err := s.loadPosts(ctx, ids, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []domain.ReadingListItem{}
+	for _, entry := range entries {
+		if post, ok := posts[entry.PostID]; ok {
+			items = append(items, domain.ReadingListItem{Post: post, AddedAt: entry.AddedAt})
+		}
+	}
+	return items, nil
+}
+
+// loadPosts returns the posts with ids that viewerID can see, with reactions
+// and covers
+func (s *BookmarkService) loadPosts(ctx context.Context, ids []uuid.UUID, viewerID string) (map[uuid.UUID]domain.PostSearchResponse, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	filter := domain.PostFilter{IDs: ids, VisibleTo: viewerID, Limit: len(ids)}
+	if viewerID == "" {
+		filter.Status = domain.PostStatusPublished
+	}
+	posts, err := s.posts.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if s.reactions != nil {
+		if err := s.reactions.Attach(ctx, posts, viewerID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.covers.attach(ctx, posts); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]domain.PostSearchResponse, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	return byID, nil
+}
+
+// Share links are unguessable, like access tokens
+func generateShareToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+)
+
+// covers checks and loads the cover images of posts. Posts keep only the
+// media ID: the file is loaded past the post cache, so a deleted cover
+// disappears at once.
+type covers struct {
+	media repository.MediaRepository
+}
+
+// parseCover turns the cover_image_id of a request into an ID; nil for an
+// empty one
+func parseCover(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, domain.ErrInvalidCover
+	}
+	return &id, nil
+}
+
+// check allows only public images of the author: the cover is shown to every
+// reader of a post
+func (c covers) check(ctx context.Context, authorID string, id *uuid.UUID) error {
+	if id == nil {
+		return nil
+	}
+	media, err := c.media.GetByID(ctx, *id)
+	if errors.Is(err, domain.ErrMediaNotFound) {
+		return domain.ErrInvalidCover
+	}
+	if err != nil {
+		return err
+	}
+	if media.OwnerID != authorID || !isCover(media) {
+		return domain.ErrInvalidCover
+	}
+	return nil
+}
+
+// attach sets Cover of the posts whose cover still exists and clears the ID
+// of the others
+func (c covers) attach(ctx context.Context, posts []domain.PostSearchResponse) error {
+	var ids []uuid.UUID
+	for _, post := range posts {
+		if post.CoverImageID != nil {
+			ids = append(ids, *post.CoverImageID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	list, err := c.media.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*domain.Media, len(list))
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+	}
+	for i := range posts {
+		if posts[i].CoverImageID == nil {
+			continue
+		}
+		// A cached post may still refer to a deleted file
+		media, ok := byID[*posts[i].CoverImageID]
+		if !ok || !isCover(media) {
+			posts[i].CoverImageID = nil
+			continue
+		}
+		posts[i].Cover = media
+	}
+	return nil
+}
+
+func isCover(media *domain.Media) bool {
+	return !media.IsPrivate() && strings.HasPrefix(media.ContentType, "image/")
+}
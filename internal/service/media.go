@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/imaging"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/storage"
+	"lemara_blog/internal/tracing"
+	"lemara_blog/internal/validation"
+)
+
+// MediaConfig limits uploads
+type MediaConfig struct {
+	// Наибольший размер одного файла и всех файлов пользователя, байт
+	MaxBytes   int64
+	QuotaBytes int64
+	// Допустимые типы, определяемые по содержимому файла
+	AllowedTypes []string
+	// Наибольшее число пикселей изображения
+	MaxPixels int
+}
+
+// Расширения ключей в хранилище, чтобы файлы было удобно просматривать
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// MediaService stores uploaded files in a storage.Storage and keeps their
+// descriptions in the media table
+type MediaService struct {
+	repo      repository.MediaRepository
+	tx        Transactor
+	storage   storage.Storage
+	processor *MediaProcessor
+	cfg       MediaConfig
+}
+
+// NewMediaService queues uploaded images in processor; with a nil processor
+// they stay pending
+func NewMediaService(repo repository.MediaRepository, tx Transactor, store storage.Storage, processor *MediaProcessor, cfg MediaConfig) *MediaService {
+	return &MediaService{repo: repo, tx: tx, storage: store, processor: processor, cfg: cfg}
+}
+
+// Upload stores size bytes of content for ownerID. The content type is
+// sniffed from the data, whatever the client claims. Images lose their
+// metadata before they are stored and are queued for processing.
+func (s *MediaService) Upload(ctx context.Context, ownerID string, req *domain.MediaUploadRequest, content io.ReadSeeker, size int64) (_ *domain.Media, err error) {
+	ctx, span := tracing.Start(ctx, "MediaService.Upload")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	req.Filename = cleanFilename(req.Filename)
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+	if req.Visibility == "" {
+		req.Visibility = domain.MediaPublic
+	}
+	if size > s.cfg.MaxBytes {
+		return nil, domain.ErrMediaTooLarge
+	}
+
+	contentType, err := sniffContentType(content)
+	if err != nil {
+		return nil, err
+	}
+	if !s.allowed(contentType) {
+		return nil, domain.ErrMediaType
+	}
+
+	id := uuid.New()
+	media := &domain.Media{
+		ID:          id,
+		OwnerID:     ownerID,
+		StorageKey:  path.Join("media", id.String()[:2], id.String()+mediaExtensions[contentType]),
+		Filename:    req.Filename,
+		ContentType: contentType,
+		Size:        size,
+		Visibility:  req.Visibility,
+	}
+
+	var body io.Reader = content
+	if strings.HasPrefix(contentType, "image/") {
+		// EXIF with GPS positions must not reach the storage even briefly
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return nil, err
+		}
+		// Normalize decodes rotated JPEGs, so the size is checked first
+		if err := imaging.CheckPixels(data, s.cfg.MaxPixels); err != nil {
+			if errors.Is(err, imaging.ErrTooManyPixels) {
+				return nil, domain.ErrImageTooLarge
+			}
+			return nil, domain.ErrInvalidImage
+		}
+		if data, err = imaging.Normalize(data, contentType); err != nil {
+			return nil, domain.ErrInvalidImage
+		}
+		if media.Width, media.Height, err = imaging.Size(data); err != nil {
+			return nil, domain.ErrInvalidImage
+		}
+		media.Size = int64(len(data))
+		media.Processing = domain.MediaProcessingPending
+		body = bytes.NewReader(data)
+	}
+
+	// Quick check before the upload; the authoritative one runs in the
+	// transaction below
+	usage, err := s.repo.Usage(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if usage+media.Size > s.cfg.QuotaBytes {
+		return nil, domain.ErrMediaQuotaExceeded
+	}
+
+	if err := s.storage.Put(ctx, media.StorageKey, body, media.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.LockOwner(ctx, ownerID); err != nil {
+			return err
+		}
+		usage, err := s.repo.Usage(ctx, ownerID)
+		if err != nil {
+			return err
+		}
+		if usage+media.Size > s.cfg.QuotaBytes {
+			return domain.ErrMediaQuotaExceeded
+		}
+		if err := s.repo.Create(ctx, media); err != nil {
+			return err
+		}
+		if media.Processing == domain.MediaProcessingPending && s.processor != nil {
+			database.AfterCommit(ctx, func() { s.processor.Enqueue(media.ID) })
+		}
+		return nil
+	})
+	if err != nil {
+		deleteMediaObjects(ctx, s.storage, media)
+		return nil, err
+	}
+	return media, nil
+}
+
+// Get returns a file of ownerID
+func (s *MediaService) Get(ctx context.Context, ownerID string, id uuid.UUID) (*domain.Media, error) {
+	media, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if media.OwnerID != ownerID {
+		return nil, domain.ErrMediaNotFound
+	}
+	return media, nil
+}
+
+// MediaPage is a page of a user's files with the space they take
+type MediaPage struct {
+	Media  []domain.Media
+	Usage  int64
+	Quota  int64
+	Limit  int
+	Offset int
+}
+
+func (s *MediaService) List(ctx context.Context, ownerID string, limit, offset int) (*MediaPage, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	list, err := s.repo.ListByOwner(ctx, ownerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.repo.Usage(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return &MediaPage{Media: list, Usage: usage, Quota: s.cfg.QuotaBytes, Limit: limit, Offset: offset}, nil
+}
+
+// Delete removes the row and then the original with its variants. A failure
+// to delete them only leaves orphaned objects behind.
+func (s *MediaService) Delete(ctx context.Context, ownerID string, id uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "MediaService.Delete")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		media, err := s.repo.Delete(ctx, ownerID, id)
+		if err != nil {
+			return err
+		}
+		database.AfterCommit(ctx, func() { deleteMediaObjects(ctx, s.storage, media) })
+		return nil
+	})
+}
+
+// GetByID returns a file of any owner; access checks are up to the caller
+func (s *MediaService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Media, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Open returns the stored content of the original or of a variant by its
+// storage key
+func (s *MediaService) Open(ctx context.Context, key string) (*storage.Object, error) {
+	obj, err := s.storage.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, domain.ErrMediaNotFound
+	}
+	return obj, err
+}
+
+// PresignedURL returns a direct download URL of the stored object from the
+// storage, if it can make one
+func (s *MediaService) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, bool, error) {
+	presigner, ok := s.storage.(storage.Presigner)
+	if !ok {
+		return "", false, nil
+	}
+	url, err := presigner.PresignGet(ctx, key, expires)
+	return url, err == nil, err
+}
+
+func (s *MediaService) allowed(contentType string) bool {
+	for _, t := range s.cfg.AllowedTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffContentType detects the type from the first 512 bytes and rewinds
+// content
+func sniffContentType(content io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	return contentType, nil
+}
+
+// cleanFilename keeps only the base name of what the client sent: browsers
+// of some systems include the full path
+func cleanFilename(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = path.Base(strings.TrimSpace(name))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/database"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/health"
+	"lemara_blog/internal/imaging"
+	"lemara_blog/internal/logging"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/storage"
+	"lemara_blog/internal/tracing"
+)
+
+// ImageConfig describes the variants made of uploaded images
+type ImageConfig struct {
+	// Ширины вариантов; больше исходной ширины варианты не делаются
+	Widths []int
+	// imaging.FormatWebP и/или imaging.FormatJPEG
+	Formats []string
+	// Качество JPEG, 1-100
+	Quality int
+	// Наибольшее число пикселей; большие изображения не декодируются
+	MaxPixels int
+	Workers   int
+}
+
+// Как часто ищутся изображения, оставшиеся в очереди после перезапуска или
+// переполнения канала
+const mediaScanInterval = 30 * time.Second
+
+// MediaProcessor makes variants and blurhash placeholders of uploaded images
+// in the background. Uploads are queued after their transaction commits;
+// images left pending by a restart or a full queue are found by a periodic
+// scan of the media table.
+type MediaProcessor struct {
+	repo      repository.MediaRepository
+	storage   storage.Storage
+	cfg       ImageConfig
+	heartbeat *health.Heartbeat
+
+	queue chan uuid.UUID
+	mu    sync.Mutex
+	// Изображения в очереди или в обработке
+	queued map[uuid.UUID]bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewMediaProcessor(repo repository.MediaRepository, store storage.Storage, cfg ImageConfig) *MediaProcessor {
+	return &MediaProcessor{
+		repo:      repo,
+		storage:   store,
+		cfg:       cfg,
+		heartbeat: health.NewHeartbeat("media_processor", 3*mediaScanInterval),
+		queue:     make(chan uuid.UUID, 256),
+		queued:    make(map[uuid.UUID]bool),
+	}
+}
+
+// Heartbeat fails readiness checks when the scan loop stops
+func (p *MediaProcessor) Heartbeat() *health.Heartbeat {
+	return p.heartbeat
+}
+
+// Start runs the workers and the scan loop until Stop
+func (p *MediaProcessor) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(context.WithoutCancel(ctx))
+
+	for range max(1, p.cfg.Workers) {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-p.queue:
+					p.process(ctx, id)
+				}
+			}
+		}()
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.heartbeat.Stop()
+
+		ticker := time.NewTicker(mediaScanInterval)
+		defer ticker.Stop()
+		for {
+			p.scan(ctx)
+			p.heartbeat.Beat()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels processing and waits for the workers. Interrupted images stay
+// pending and are processed after the next start.
+func (p *MediaProcessor) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue schedules processing without blocking; when the queue is full the
+// scan picks the image up later
+func (p *MediaProcessor) Enqueue(id uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.queued[id] {
+		return
+	}
+	select {
+	case p.queue <- id:
+		p.queued[id] = true
+	default:
+	}
+}
+
+func (p *MediaProcessor) scan(ctx context.Context) {
+	pending, err := p.repo.ListPending(database.UsePrimary(ctx), cap(p.queue))
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.FromContext(ctx).Error("failed to list pending media", "error", err)
+		}
+		return
+	}
+	for _, media := range pending {
+		p.Enqueue(media.ID)
+	}
+}
+
+func (p *MediaProcessor) process(ctx context.Context, id uuid.UUID) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.queued, id)
+		p.mu.Unlock()
+	}()
+
+	ctx, span := tracing.Start(ctx, "MediaProcessor.process")
+	defer span.End()
+	// Загрузка могла ещё не дойти до реплики
+	ctx = database.UsePrimary(ctx)
+	logger := logging.FromContext(ctx).With("media_id", id.String())
+
+	media, err := p.repo.GetByID(ctx, id)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			tracing.RecordError(span, err)
+			logger.Error("failed to load media", "error", err)
+		}
+		return
+	}
+	if media.Processing != domain.MediaProcessingPending {
+		return
+	}
+
+	media.Processing = domain.MediaProcessingReady
+	if err := p.safeProcessImage(ctx, media); err != nil {
+		if ctx.Err() != nil {
+			// Остановка: изображение обработается после перезапуска
+			return
+		}
+		tracing.RecordError(span, err)
+		logger.Warn("failed to process image", "error", err)
+		media.Processing = domain.MediaProcessingFailed
+	}
+
+	err = p.repo.SaveProcessing(ctx, media)
+	if errors.Is(err, domain.ErrNotFound) {
+		// Удалено во время обработки: новые объекты больше никому не нужны
+		deleteMediaObjects(ctx, p.storage, media)
+		return
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Error("failed to save processed media", "error", err)
+	}
+}
+
+// safeProcessImage is processImage that turns a panic of a decoder on a
+// broken file into an error: the image fails instead of the whole server
+func (p *MediaProcessor) safeProcessImage(ctx context.Context, media *domain.Media) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing image: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return p.processImage(ctx, media)
+}
+
+// processImage strips metadata from the original (again, for files uploaded
+// before it was done on upload), measures it, computes the blurhash and
+// stores the variants
+func (p *MediaProcessor) processImage(ctx context.Context, media *domain.Media) error {
+	obj, err := p.storage.Open(ctx, media.StorageKey)
+	if err != nil {
+		return err
+	}
+	original, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := imaging.CheckPixels(original, p.cfg.MaxPixels); err != nil {
+		return err
+	}
+	data, err := imaging.Normalize(original, media.ContentType)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, original) {
+		if err := p.storage.Put(ctx, media.StorageKey, bytes.NewReader(data), int64(len(data)), media.ContentType); err != nil {
+			return err
+		}
+		media.Size = int64(len(data))
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	media.Width, media.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	media.Blurhash = imaging.Blurhash(img)
+
+	media.Variants = nil
+	if !imaging.Resizable(media.ContentType) {
+		return nil
+	}
+	widths := slices.Clone(p.cfg.Widths)
+	slices.Sort(widths)
+	for _, width := range slices.Compact(widths) {
+		if width >= media.Width {
+			break
+		}
+		resized := imaging.Resize(img, width)
+		for _, format := range p.cfg.Formats {
+			var buf bytes.Buffer
+			if err := imaging.Encode(&buf, resized, format, p.cfg.Quality); err != nil {
+				return err
+			}
+			variant := domain.MediaVariant{
+				Name:        fmt.Sprintf("w%d%s", width, imaging.Extension(format)),
+				Width:       width,
+				Height:      resized.Bounds().Dy(),
+				ContentType: imaging.ContentType(format),
+				Size:        int64(buf.Len()),
+			}
+			variant.StorageKey = variantKey(media, variant.Name)
+			if err := p.storage.Put(ctx, variant.StorageKey, &buf, variant.Size, variant.ContentType); err != nil {
+				return err
+			}
+			media.Variants = append(media.Variants, variant)
+		}
+	}
+	return nil
+}
+
+// variantKey places variants next to the original:
+// media/ab/<id>.jpg -> media/ab/<id>/w640.webp
+func variantKey(media *domain.Media, name string) string {
+	return strings.TrimSuffix(media.StorageKey, path.Ext(media.StorageKey)) + "/" + name
+}
+
+// deleteMediaObjects removes the original and the variants, logging failures:
+// an orphaned object only takes space
+func deleteMediaObjects(ctx context.Context, store storage.Storage, media *domain.Media) {
+	ctx = context.WithoutCancel(ctx)
+	keys := []string{media.StorageKey}
+	for _, variant := range media.Variants {
+		keys = append(keys, variant.StorageKey)
+	}
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("failed to delete stored media", "key", key, "error", err)
+		}
+	}
+}
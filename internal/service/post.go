@@ -2,48 +2,242 @@ package service
 
 import (
 	"context"
-	"errors"
+	"lemara_blog/internal/clock"
 	"lemara_blog/internal/domain"
+	"lemara_blog/internal/metrics"
 	"lemara_blog/internal/repository"
-	"time"
+	"lemara_blog/internal/tracing"
+	"lemara_blog/internal/validation"
 
 	"github.com/google/uuid"
 )
 
 type PostService struct {
-	repo repository.PostRepository
+	repo      repository.PostRepository
+	tx        Transactor
+	clock     clock.Clock
+	reactions *ReactionService
+	bookmarks *BookmarkService
+	covers    covers
 }
 
-func NewPostService(repo repository.PostRepository) *PostService {
-	return &PostService{repo: repo}
+// NewPostService adds reactions to the returned posts unless reactions is
+// nil. Unpublished posts leave the bookmarks of readers unless bookmarks is
+// nil. Covers are images from media.
+func NewPostService(repo repository.PostRepository, tx Transactor, clk clock.Clock, reactions *ReactionService, bookmarks *BookmarkService, media repository.MediaRepository) *PostService {
+	return &PostService{repo: repo, tx: tx, clock: clk, reactions: reactions, bookmarks: bookmarks, covers: covers{media: media}}
 }
 
 // Метод для создания новой статьи
-func (s *PostService) CreatePost(ctx context.Context, req *domain.PostCreateRequest) (*domain.Post, error) {
-	// Проверка на пустые поля
-	if req.Title == "" || req.Content == "" || req.Author == "" {
-		return nil, errors.New("Title, Content and Author fields are required")
+func (s *PostService) CreatePost(ctx context.Context, req *domain.PostCreateRequest) (_ *domain.Post, err error) {
+	ctx, span := tracing.Start(ctx, "PostService.CreatePost")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	// Проверка полей запроса
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+	if req.Author == "" {
+		return nil, domain.Validation(domain.FieldError{Field: "author", Code: "required", Message: "author is required"})
+	}
+	coverID, err := parseCover(req.CoverImageID)
+	if err != nil {
+		return nil, err
 	}
 	// Проверка на существование статьи с таким ID
 	post := domain.Post{
-		ID:        uuid.New(),
-		Title:     req.Title,
-		Content:   req.Content,
-		Author:    req.Author,
-		CreatedAt: time.Now(),
+		ID:            uuid.New(),
+		Title:         req.Title,
+		Content:       req.Content,
+		Author:        req.Author,
+		Status:        req.Status,
+		CoverImageID:  coverID,
+		CustomExcerpt: req.Excerpt,
+		CreatedAt:     s.clock.Now(),
+	}
+	if post.Status == "" {
+		post.Status = domain.PostStatusPublished
 	}
-	err := s.repo.Create(ctx, post)
+	summarize(&post)
+	post.UpdatedAt = post.CreatedAt
+	// Пост и его теги сохраняются атомарно
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.covers.check(ctx, post.Author, post.CoverImageID); err != nil {
+			return err
+		}
+		if err := s.repo.Create(ctx, post); err != nil {
+			return err
+		}
+		tags, err := s.repo.SetTags(ctx, post.ID, req.Tags)
+		post.Tags = tags
+		return err
+	})
 	if err != nil {
         return nil, err
     }
+	metrics.PostCreated()
 	return &post, err
 }
 
-// Метод для получения статьи по ID
-func (s *PostService) GetPostByID(ctx context.Context, id uuid.UUID) (*domain.PostSearchResponse, error) {
+// Метод для получения статьи по ID. Черновик видит только автор, для
+// остальных (и анонимных читателей с пустым viewerID) его нет
+func (s *PostService) GetPostByID(ctx context.Context, id uuid.UUID, viewerID string) (_ *domain.PostSearchResponse, err error) {
+	ctx, span := tracing.Start(ctx, "PostService.GetPostByID")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
 	post, err := s.repo.GetByID(ctx, id)
 	if err != nil {
         return nil, err
     }
-	return &post, err
+	if post.Status != domain.PostStatusPublished && post.Author.ID != viewerID {
+		return nil, domain.ErrPostNotFound
+	}
+	posts := []domain.PostSearchResponse{post}
+	if err := s.attach(ctx, posts, viewerID); err != nil {
+		return nil, err
+	}
+	return &posts[0], nil
+}
+
+// Precondition inspects the current state of a resource before it is changed,
+// e.g. to compare its ETag with If-Match. A non-nil error aborts the change.
+// Posts are passed without reactions, which are not the author's to change.
+type Precondition func(current *domain.PostSearchResponse) error
+
+// UpdatePost applies the fields present in req. Only the author may change a
+// post; precondition (may be nil) runs on the current version inside the
+// same transaction as the update.
+func (s *PostService) UpdatePost(ctx context.Context, id uuid.UUID, userID string, req *domain.PostUpdateRequest, precondition Precondition) (_ *domain.PostSearchResponse, err error) {
+	ctx, span := tracing.Start(ctx, "PostService.UpdatePost")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+
+	var updated domain.PostSearchResponse
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		// Чужие черновики не раскрываются даже через ошибку
+		if current.Author.ID != userID && current.Status != domain.PostStatusPublished {
+			return domain.ErrPostNotFound
+		}
+		if current.Author.ID != userID {
+			return domain.ErrNotPostAuthor
+		}
+		// The cached post may still refer to a deleted cover
+		currentPosts := []domain.PostSearchResponse{current}
+		if err := s.covers.attach(ctx, currentPosts); err != nil {
+			return err
+		}
+		current = currentPosts[0]
+		if precondition != nil {
+			if err := precondition(&current); err != nil {
+				return err
+			}
+		}
+
+		post := domain.Post{
+			ID:            id,
+			Title:         current.Title,
+			Content:       current.Content,
+			Author:        userID,
+			Status:        current.Status,
+			CoverImageID:  current.CoverImageID,
+			CustomExcerpt: current.CustomExcerpt,
+		}
+		if req.Status != nil {
+			post.Status = *req.Status
+		}
+		if req.Title != nil {
+			post.Title = *req.Title
+		}
+		if req.Content != nil {
+			post.Content = *req.Content
+		}
+		if req.CoverImageID != nil {
+			coverID, err := parseCover(*req.CoverImageID)
+			if err != nil {
+				return err
+			}
+			if err := s.covers.check(ctx, userID, coverID); err != nil {
+				return err
+			}
+			post.CoverImageID = coverID
+		}
+		if req.Excerpt != nil {
+			post.CustomExcerpt = *req.Excerpt
+		}
+		summarize(&post)
+		if err := s.repo.Update(ctx, &post, current.UpdatedAt); err != nil {
+			return err
+		}
+		if req.Tags != nil {
+			if _, err := s.repo.SetTags(ctx, id, *req.Tags); err != nil {
+				return err
+			}
+		}
+		// Читатели больше не видят пост, он уходит из их закладок
+		if s.bookmarks != nil && current.Status == domain.PostStatusPublished && post.Status != domain.PostStatusPublished {
+			if err := s.bookmarks.postHidden(ctx, id, userID); err != nil {
+				return err
+			}
+		}
+
+		updated, err = s.repo.GetByID(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	posts := []domain.PostSearchResponse{updated}
+	if err := s.attach(ctx, posts, userID); err != nil {
+		return nil, err
+	}
+	return &posts[0], nil
+}
+
+// Размер страницы по умолчанию и максимальный
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListPosts returns a page of posts, newest first. Use filter.Status or
+// filter.VisibleTo to keep drafts of other users out.
+func (s *PostService) ListPosts(ctx context.Context, filter domain.PostFilter) (_ *domain.PostListResponse, err error) {
+	ctx, span := tracing.Start(ctx, "PostService.ListPosts")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	posts, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attach(ctx, posts, filter.VisibleTo); err != nil {
+		return nil, err
+	}
+	return &domain.PostListResponse{Posts: posts, Limit: filter.Limit, Offset: filter.Offset}, nil
+}
+
+// attach adds what the post cache doesn't keep: reactions and covers
+func (s *PostService) attach(ctx context.Context, posts []domain.PostSearchResponse, viewerID string) error {
+	if s.reactions != nil {
+		if err := s.reactions.Attach(ctx, posts, viewerID); err != nil {
+			return err
+		}
+	}
+	return s.covers.attach(ctx, posts)
 }
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/tracing"
+)
+
+// ReactionService keeps reactions of readers to posts. Kinds are configured;
+// reactions of kinds removed from the configuration stay stored but are not
+// shown.
+type ReactionService struct {
+	repo  repository.ReactionRepository
+	posts repository.PostRepository
+	tx    Transactor
+	kinds []string
+}
+
+func NewReactionService(repo repository.ReactionRepository, posts repository.PostRepository, tx Transactor, kinds []string) *ReactionService {
+	return &ReactionService{repo: repo, posts: posts, tx: tx, kinds: kinds}
+}
+
+// React adds a reaction of userID to a post they can see. Repeating it
+// changes nothing.
+func (s *ReactionService) React(ctx context.Context, postID uuid.UUID, userID, kind string) (_ []domain.ReactionSummary, err error) {
+	ctx, span := tracing.Start(ctx, "ReactionService.React")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.change(ctx, postID, userID, kind, s.repo.Add)
+}
+
+// Unreact removes a reaction; removing an absent one is not an error
+func (s *ReactionService) Unreact(ctx context.Context, postID uuid.UUID, userID, kind string) (_ []domain.ReactionSummary, err error) {
+	ctx, span := tracing.Start(ctx, "ReactionService.Unreact")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	return s.change(ctx, postID, userID, kind, s.repo.Remove)
+}
+
+func (s *ReactionService) change(ctx context.Context, postID uuid.UUID, userID, kind string,
+	apply func(ctx context.Context, postID uuid.UUID, userID, kind string) (bool, error)) ([]domain.ReactionSummary, error) {
+	if !slices.Contains(s.kinds, kind) {
+		return nil, domain.ErrReactionKind
+	}
+
+	// Реакция и счётчик меняются вместе
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		post, err := s.posts.GetByID(ctx, postID)
+		if err != nil {
+			return err
+		}
+		if post.Status != domain.PostStatusPublished && post.Author.ID != userID {
+			return domain.ErrPostNotFound
+		}
+		_, err = apply(ctx, postID, userID, kind)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	posts := []domain.PostSearchResponse{{ID: postID}}
+	if err := s.Attach(ctx, posts, userID); err != nil {
+		return nil, err
+	}
+	return posts[0].Reactions, nil
+}
+
+// Attach fills the reactions of posts in the configured order, marking those
+// of viewerID (may be empty for anonymous readers)
+func (s *ReactionService) Attach(ctx context.Context, posts []domain.PostSearchResponse, viewerID string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	counts, err := s.repo.Counts(ctx, ids)
+	if err != nil {
+		return err
+	}
+	var mine map[uuid.UUID][]string
+	if viewerID != "" {
+		if mine, err = s.repo.ByUser(ctx, viewerID, ids); err != nil {
+			return err
+		}
+	}
+
+	for i := range posts {
+		posts[i].Reactions = []domain.ReactionSummary{}
+		posts[i].ReactionsUpdatedAt = counts[posts[i].ID].UpdatedAt
+		for _, kind := range s.kinds {
+			if count := counts[posts[i].ID].Counts[kind]; count > 0 {
+				posts[i].Reactions = append(posts[i].Reactions, domain.ReactionSummary{
+					Kind:    kind,
+					Count:   count,
+					Reacted: slices.Contains(mine[posts[i].ID], kind),
+				})
+			}
+		}
+	}
+	return nil
+}
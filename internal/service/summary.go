@@ -0,0 +1,129 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"lemara_blog/internal/domain"
+)
+
+const (
+	// Длина автоматического анонса в символах
+	excerptLength = 280
+	// Средняя скорость чтения, слов в минуту
+	wordsPerMinute = 200
+)
+
+// Разметка Markdown, которая убирается из анонса и не считается словами
+var (
+	mdFence     = regexp.MustCompile("^\\s*(```|~~~)")
+	mdHeading   = regexp.MustCompile(`^\s{0,3}#{1,6}(\s+|$)`)
+	mdRule      = regexp.MustCompile(`^\s{0,3}([-*_]\s*){3,}$`)
+	mdReference = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s`)
+	mdLineStart = regexp.MustCompile(`^\s*((>\s?)+|[-*+]\s+|\d+[.)]\s+)`)
+	mdImage     = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink      = regexp.MustCompile(`\[([^\]]*)\](\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink  = regexp.MustCompile(`<(https?://[^>]+)>`)
+	mdHTML      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdCode      = regexp.MustCompile("`+([^`]*)`+")
+	mdEmphasis  = regexp.MustCompile(`(\*\*|__|~~)(\S(?:[^*_~]*\S)?)(\*\*|__|~~)|(^|\W)[*_](\S(?:[^*_]*\S)?)[*_](\W|$)`)
+)
+
+// textBlock is a paragraph of post content with the Markdown removed
+type textBlock struct {
+	text    string
+	heading bool
+}
+
+// plainBlocks splits Markdown content into paragraphs of plain text. Code
+// blocks are left out: they are neither a good excerpt nor read word by word.
+func plainBlocks(content string) []textBlock {
+	var (
+		blocks  []textBlock
+		lines   []string
+		heading bool
+		fenced  bool
+	)
+	flush := func() {
+		text := strings.Join(strings.Fields(plainInline(strings.Join(lines, " "))), " ")
+		if text != "" {
+			blocks = append(blocks, textBlock{text: text, heading: heading})
+		}
+		lines, heading = nil, false
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		switch {
+		case mdFence.MatchString(line):
+			flush()
+			fenced = !fenced
+		case fenced:
+		case strings.TrimSpace(line) == "" || mdRule.MatchString(line) || mdReference.MatchString(line):
+			flush()
+		case mdHeading.MatchString(line):
+			// Заголовок - отдельный блок, даже без пустой строки вокруг
+			flush()
+			lines, heading = []string{mdHeading.ReplaceAllString(line, "")}, true
+			flush()
+		default:
+			lines = append(lines, mdLineStart.ReplaceAllString(line, ""))
+		}
+	}
+	flush()
+	return blocks
+}
+
+func plainInline(text string) string {
+	text = mdImage.ReplaceAllString(text, "$1")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdAutolink.ReplaceAllString(text, "$1")
+	text = mdHTML.ReplaceAllString(text, "")
+	text = mdCode.ReplaceAllString(text, "$1")
+	// Вложенное выделение (***текст***) снимается за два прохода
+	for range 2 {
+		text = mdEmphasis.ReplaceAllString(text, "$2$4$5$6")
+	}
+	return text
+}
+
+// summarize fills the excerpt, word count and reading time of post from its
+// content
+func summarize(post *domain.Post) {
+	blocks := plainBlocks(post.Content)
+
+	post.Excerpt = strings.TrimSpace(post.CustomExcerpt)
+	if post.Excerpt == "" {
+		post.Excerpt = excerpt(blocks, excerptLength)
+	}
+
+	post.WordCount = 0
+	for _, block := range blocks {
+		post.WordCount += len(strings.Fields(block.text))
+	}
+	post.ReadingTime = (post.WordCount + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// excerpt returns the first paragraph that is not a heading, cut at a word
+// boundary if it is longer than limit runes
+func excerpt(blocks []textBlock, limit int) string {
+	var text string
+	for _, block := range blocks {
+		if !block.heading {
+			text = block.text
+			break
+		}
+	}
+	if text == "" && len(blocks) > 0 {
+		text = blocks[0].text
+	}
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	cut := string([]rune(text)[:limit])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, ".,;:!?-") + "…"
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"lemara_blog/internal/domain"
+)
+
+func TestSummarize(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		excerpt string
+		words   int
+	}{
+		{"plain", "Just a few words.", "Just a few words.", 4},
+		{"heading is skipped", "# Title\n\nBody text here.", "Body text here.", 4},
+		{"heading without blank line", "## Intro\nFirst line", "First line", 3},
+		{"only a heading", "# Only", "Only", 1},
+		{"setext rule", "Before\n\n---\n\nAfter", "Before", 2},
+		{"code fence", "```go\nfmt.Println(\"x\")\n```\n\nAfter the code.", "After the code.", 3},
+		{"tilde fence", "~~~\nskipped words\n~~~\nText", "Text", 1},
+		{"unclosed fence", "Intro\n\n```\nnever closed\n\nmore", "Intro", 1},
+		{"nested emphasis", "***very*** important", "very important", 2},
+		{"emphasis inside strong", "**bold _italic_ text**", "bold italic text", 3},
+		{"strong inside emphasis", "_**both**_ ways", "both ways", 2},
+		{"strikethrough", "~~old~~ new", "old new", 2},
+		{"underscores in words", "snake_case_name and 2*3*4", "snake_case_name and 2*3*4", 3},
+		{"inline markup", "See [docs](https://example.com) and ![alt](img.png) <b>now</b> `x` <https://e.com>", "See docs and alt now x https://e.com", 7},
+		{"quotes and lists", "> quoted\n- item one\n1. item two", "quoted item one item two", 5},
+		{"reference definitions", "Text [a][1]\n\n[1]: https://example.com", "Text a", 2},
+		{"windows newlines", "# Title\r\n\r\nBody", "Body", 2},
+		{"empty", "", "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			post := domain.Post{Content: tc.content}
+			summarize(&post)
+			if post.Excerpt != tc.excerpt || post.WordCount != tc.words {
+				t.Fatalf("got %q, %d words; want %q, %d words", post.Excerpt, post.WordCount, tc.excerpt, tc.words)
+			}
+		})
+	}
+}
+
+func TestSummarizeReadingTime(t *testing.T) {
+	cases := []struct {
+		words   int
+		minutes int
+	}{
+		{0, 0},
+		{1, 1},
+		{200, 1},
+		{201, 2},
+		{1000, 5},
+	}
+	for _, tc := range cases {
+		post := domain.Post{Content: strings.Repeat("word ", tc.words)}
+		summarize(&post)
+		if post.WordCount != tc.words || post.ReadingTime != tc.minutes {
+			t.Errorf("%d words: got %d words, %d min; want %d min", tc.words, post.WordCount, post.ReadingTime, tc.minutes)
+		}
+	}
+}
+
+func TestSummarizeCustomExcerpt(t *testing.T) {
+	post := domain.Post{Content: "Generated", CustomExcerpt: "  Hand-written  "}
+	summarize(&post)
+	if post.Excerpt != "Hand-written" || post.WordCount != 1 {
+		t.Fatalf("got %q, %d words", post.Excerpt, post.WordCount)
+	}
+}
+
+// Long excerpts are cut by runes, never inside a multibyte character
+func TestExcerptCut(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"at a word boundary", strings.Repeat("слово ", 60), strings.TrimSpace(strings.Repeat("слово ", 46)) + "…"},
+		{"trailing punctuation", strings.Repeat("abcd, ", 60), strings.TrimSpace(strings.Repeat("abcd, ", 46))[:46*6-2] + "…"},
+		{"one long word", strings.Repeat("я", 300), strings.Repeat("я", excerptLength) + "…"},
+		{"emoji", strings.Repeat("🙂", 300), strings.Repeat("🙂", excerptLength) + "…"},
+		{"exactly the limit", strings.Repeat("ж", excerptLength), strings.Repeat("ж", excerptLength)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			post := domain.Post{Content: tc.content}
+			summarize(&post)
+			if !utf8.ValidString(post.Excerpt) || utf8.RuneCountInString(post.Excerpt) > excerptLength+1 {
+				t.Fatalf("invalid excerpt %q", post.Excerpt)
+			}
+			if post.Excerpt != tc.want {
+				t.Fatalf("got %q\nwant %q", post.Excerpt, tc.want)
+			}
+		})
+	}
+}
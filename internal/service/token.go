@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"lemara_blog/internal/clock"
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/tracing"
+	"lemara_blog/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// Personal access tokens look like "lmr_pat_<random>" so they can be told
+// apart from JWTs in the Authorization header.
+const TokenPrefix = "lmr_pat_"
+
+// last_used_at is not rewritten more often than this
+const tokenTouchInterval = time.Minute
+
+var ErrInvalidToken = domain.Unauthorized("invalid_token", "Invalid token")
+
+type TokenService interface {
+	Create(ctx context.Context, userID string, req *domain.CreateTokenRequest) (*domain.CreateTokenResponse, error)
+	List(ctx context.Context, userID string) ([]domain.TokenResponse, error)
+	Revoke(ctx context.Context, userID, id string) error
+	Authenticate(ctx context.Context, raw string) (*domain.PersonalAccessToken, error)
+}
+
+type tokenService struct {
+	tokenRepo repository.TokenRepository
+	clock     clock.Clock
+}
+
+func NewTokenService(tokenRepo repository.TokenRepository, clk clock.Clock) TokenService {
+	return &tokenService{tokenRepo: tokenRepo, clock: clk}
+}
+
+func IsPersonalAccessToken(raw string) bool {
+	return strings.HasPrefix(raw, TokenPrefix)
+}
+
+func (s *tokenService) Create(ctx context.Context, userID string, req *domain.CreateTokenRequest) (_ *domain.CreateTokenResponse, err error) {
+	ctx, span := tracing.Start(ctx, "TokenService.Create")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+
+	raw, err := generateTokenSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &domain.PersonalAccessToken{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    raw[:len(TokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    req.Scopes,
+		CreatedAt: s.clock.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := token.CreatedAt.Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return &domain.CreateTokenResponse{
+		Token: raw,
+		Info:  toTokenResponse(token),
+	}, nil
+}
+
+func (s *tokenService) List(ctx context.Context, userID string) ([]domain.TokenResponse, error) {
+	tokens, err := s.tokenRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]domain.TokenResponse, 0, len(tokens))
+	for i := range tokens {
+		response = append(response, toTokenResponse(&tokens[i]))
+	}
+	return response, nil
+}
+
+func (s *tokenService) Revoke(ctx context.Context, userID, id string) error {
+	return s.tokenRepo.Revoke(ctx, userID, id, s.clock.Now())
+}
+
+// Authenticate resolves a raw token from the Authorization header and records
+// when it was last used.
+func (s *tokenService) Authenticate(ctx context.Context, raw string) (_ *domain.PersonalAccessToken, err error) {
+	ctx, span := tracing.Start(ctx, "TokenService.Authenticate")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if !IsPersonalAccessToken(raw) {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := s.tokenRepo.FindByHash(ctx, hashToken(raw))
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	if token.IsExpired(now) {
+		return nil, ErrInvalidToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > tokenTouchInterval {
+		if err := s.tokenRepo.TouchLastUsed(ctx, token.ID, now); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+
+	return token, nil
+}
+
+func generateTokenSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Tokens are high-entropy, so a plain SHA-256 is enough to store them
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func toTokenResponse(token *domain.PersonalAccessToken) domain.TokenResponse {
+	return domain.TokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
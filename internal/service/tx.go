@@ -0,0 +1,10 @@
+package service
+
+import "context"
+
+// Transactor runs fn as one unit of work: repository calls made with the
+// context passed to fn either all commit or all roll back.
+// *database.TxManager implements it.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
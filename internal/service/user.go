@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"lemara_blog/internal/domain"
+	"lemara_blog/internal/repository"
+	"lemara_blog/internal/tracing"
+	"lemara_blog/internal/validation"
+)
+
+// UserService manages profiles: the account's own settings and the public
+// profile pages found by username
+type UserService struct {
+	repo repository.UserRepository
+	tx   Transactor
+	auth AuthService
+}
+
+func NewUserService(repo repository.UserRepository, tx Transactor, auth AuthService) *UserService {
+	return &UserService{repo: repo, tx: tx, auth: auth}
+}
+
+// UpdateProfile applies the fields present in req. precondition (may be nil)
+// runs on the current user inside the transaction, before anything changes.
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, req *domain.UpdateUserRequest, precondition func(current *domain.User) error) (_ *domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateProfile")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	if req.Username != nil {
+		username := domain.NormalizeUsername(*req.Username)
+		req.Username = &username
+		// Once chosen, a username can be changed but not removed
+		if username == "" {
+			return nil, domain.Validation(domain.FieldError{Field: "username", Code: "required", Message: "username is required"})
+		}
+	}
+	if err := validation.Validate(req); err != nil {
+		return nil, err
+	}
+
+	var user *domain.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err = s.repo.FindByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if precondition != nil {
+			if err := precondition(user); err != nil {
+				return err
+			}
+		}
+
+		if req.Email != nil && *req.Email != "" {
+			existing, err := s.repo.FindByEmail(ctx, *req.Email)
+			if err != nil && !errors.Is(err, domain.ErrNotFound) {
+				return err
+			}
+			if existing != nil && existing.ID != userID {
+				return domain.ErrEmailTaken
+			}
+			user.Email = *req.Email
+		}
+		if req.Password != nil && *req.Password != "" {
+			hashed, err := s.auth.HashPassword(*req.Password)
+			if err != nil {
+				return err
+			}
+			user.PasswordHash = hashed
+		}
+		if req.FirstName != nil && *req.FirstName != "" {
+			user.FirstName = *req.FirstName
+		}
+		if req.LastName != nil && *req.LastName != "" {
+			user.LastName = *req.LastName
+		}
+		if req.Bio != nil {
+			user.Bio = *req.Bio
+		}
+		if req.Website != nil {
+			user.Website = *req.Website
+		}
+		if req.AvatarURL != nil {
+			user.AvatarURL = *req.AvatarURL
+		}
+
+		if req.Username != nil && *req.Username != user.Username {
+			if err := s.changeUsername(ctx, user, *req.Username); err != nil {
+				return err
+			}
+		}
+
+		return s.repo.Update(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// changeUsername checks that username is free (previous names of other users
+// are not) and keeps the old name for redirects
+func (s *UserService) changeUsername(ctx context.Context, user *domain.User, username string) error {
+	owner, err := s.repo.FindByUsername(ctx, username)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if owner != nil && owner.ID != user.ID {
+		return domain.ErrUsernameTaken
+	}
+
+	if err := s.repo.RecordUsernameChange(ctx, user.ID, user.Username, username); err != nil {
+		return err
+	}
+	user.Username = username
+	return nil
+}
+
+// FindByUsername returns the user with the current or a previous username.
+// moved reports a previous one: clients should be redirected to
+// user.Username.
+func (s *UserService) FindByUsername(ctx context.Context, username string) (user *domain.User, moved bool, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.FindByUsername")
+	defer func() { tracing.RecordError(span, err); span.End() }()
+
+	username = domain.NormalizeUsername(username)
+	user, err = s.repo.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, user.Username != username, nil
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"lemara_blog/internal/storage/sigv4"
+)
+
+// S3Config describes a bucket in an S3-compatible object store
+type S3Config struct {
+	// Base URL of the service, e.g. https://s3.eu-central-1.amazonaws.com
+	// or http://localhost:9000 for MinIO
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Address the bucket in the path (endpoint/bucket/key) instead of the
+	// host (bucket.endpoint/key). Most self-hosted stores need it.
+	PathStyle bool
+}
+
+// S3 stores objects in a bucket using the S3 REST API signed with Signature
+// Version 4. Payloads are sent unsigned, so use an https endpoint outside of
+// trusted networks.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	signer   sigv4.Signer
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 uses client for requests, http.DefaultClient when nil
+func NewS3(cfg S3Config, client *http.Client) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("storage: invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage: S3 bucket is required")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{
+		cfg:      cfg,
+		endpoint: endpoint,
+		signer: sigv4.Signer{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			Region:          cfg.Region,
+			Service:         "s3",
+		},
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+// objectURL is the URL of key, or of the bucket itself for an empty key
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		path += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	path += "/" + key
+	u.Path = path
+	u.RawPath = sigv4.EscapePath(path)
+	return &u
+}
+
+func (s *S3) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	if key != "" {
+		if err := validKey(key); err != nil {
+			return nil, err
+		}
+	}
+	return http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), body)
+}
+
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.signer.Sign(req, sigv4.UnsignedPayload, s.now())
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	// S3 rejects chunked uploads without a length
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(req, resp)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (*Object, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(req, resp)
+	}
+	return &Object{
+		ReadCloser:  resp.Body,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 for missing keys too, some compatible stores 404
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(req, resp)
+	}
+	return nil
+}
+
+// PresignGet returns a download URL for key valid for expires (at most seven
+// days). The object is not checked to exist.
+func (s *S3) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return s.signer.Presign(req, expires, s.now()), nil
+}
+
+// Ping checks that the bucket exists and the credentials are accepted
+func (s *S3) Ping(ctx context.Context) error {
+	req, err := s.newRequest(ctx, http.MethodHead, "", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(req, resp)
+	}
+	return nil
+}
+
+// responseError turns an S3 error response (<Error><Code>...) into an error
+func responseError(req *http.Request, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if body.Code == "" {
+		body.Code = resp.Status
+	}
+	return fmt.Errorf("storage: S3 %s %s: %s %s", req.Method, req.URL.Path, body.Code, body.Message)
+}
@@ -0,0 +1,213 @@
+// Package s3test provides a minimal in-process S3-compatible object store,
+// a stand-in for MinIO to exercise storage.S3 without external services. It
+// serves one bucket with path-style addressing and checks request
+// signatures.
+package s3test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lemara_blog/internal/storage/sigv4"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+}
+
+type Server struct {
+	Server          *httptest.Server
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+// NewServer starts a store with an empty bucket
+func NewServer(bucket string) *Server {
+	s := &Server{
+		Bucket:          bucket,
+		Region:          "us-east-1",
+		AccessKeyID:     "s3test-access-key",
+		SecretAccessKey: "s3test-secret-key",
+		objects:         make(map[string]object),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) URL() string {
+	return s.Server.URL
+}
+
+func (s *Server) Close() {
+	s.Server.Close()
+}
+
+// Object returns the stored content of key
+func (s *Server) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj.data, ok
+}
+
+// Len is the number of stored objects
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	if code := s.authenticate(r, body); code != "" {
+		writeError(w, http.StatusForbidden, code)
+		return
+	}
+
+	if key == "" {
+		if r.Method != http.MethodHead {
+			writeError(w, http.StatusNotImplemented, "NotImplemented")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			writeError(w, http.StatusLengthRequired, "MissingContentLength")
+			return
+		}
+		s.objects[key] = object{data: body, contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// authenticate checks the Authorization header or, for presigned URLs, the
+// query string. It returns an S3 error code on failure.
+func (s *Server) authenticate(r *http.Request, body []byte) string {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Signature") != "" {
+		return s.authenticateQuery(r)
+	}
+
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), sigv4.Algorithm+" ")
+	params := map[string]string{}
+	for _, part := range strings.Split(auth, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		params[name] = value
+	}
+	t, err := time.Parse(sigv4.TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil || params["Signature"] == "" {
+		return "AccessDenied"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != sigv4.UnsignedPayload {
+		sum := sha256.Sum256(body)
+		if payloadHash != hex.EncodeToString(sum[:]) {
+			return "XAmzContentSHA256Mismatch"
+		}
+	}
+
+	headers := strings.Split(params["SignedHeaders"], ";")
+	canonical := sigv4.CanonicalRequest(r, query, headers, payloadHash)
+	return s.check(params["Credential"], t, canonical, params["Signature"])
+}
+
+func (s *Server) authenticateQuery(r *http.Request) string {
+	query := r.URL.Query()
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+
+	t, err := time.Parse(sigv4.TimeFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return "AccessDenied"
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires > 7*24*3600 {
+		return "AuthorizationQueryParametersError"
+	}
+	if time.Now().After(t.Add(time.Duration(expires) * time.Second)) {
+		return "AccessDenied"
+	}
+
+	headers := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	canonical := sigv4.CanonicalRequest(r, query, headers, sigv4.UnsignedPayload)
+	return s.check(query.Get("X-Amz-Credential"), t, canonical, signature)
+}
+
+func (s *Server) check(credential string, t time.Time, canonical, signature string) string {
+	signer := sigv4.Signer{
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: s.SecretAccessKey,
+		Region:          s.Region,
+		Service:         "s3",
+	}
+	if credential != s.AccessKeyID+"/"+signer.Scope(t) {
+		return "InvalidAccessKeyId"
+	}
+	if signature != signer.Signature(t, canonical) {
+		return "SignatureDoesNotMatch"
+	}
+	return ""
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	var buf bytes.Buffer
+	xml.NewEncoder(&buf).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: http.StatusText(status)})
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,155 @@
+// Package sigv4 implements AWS Signature Version 4 as accepted by S3 and
+// the object stores compatible with it.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Algorithm = "AWS4-HMAC-SHA256"
+	// Payload hash for bodies that are not signed (streamed uploads,
+	// presigned URLs)
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	TimeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+)
+
+// Signer signs requests for one region and service ("s3")
+type Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	Service         string
+}
+
+// Заголовки, подписываемые в Authorization
+var signedHeaders = []string{"host", "x-amz-content-sha256", "x-amz-date"}
+
+// Sign adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers
+func (s Signer) Sign(r *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	r.Header.Set("X-Amz-Date", now.Format(TimeFormat))
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical := CanonicalRequest(r, r.URL.Query(), signedHeaders, payloadHash)
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		Algorithm, s.AccessKeyID, s.Scope(now), strings.Join(signedHeaders, ";"), s.Signature(now, canonical)))
+}
+
+// Presign returns the URL of r with the signature in the query string. It is
+// valid for expires (at most seven days) and only for r's method.
+func (s Signer) Presign(r *http.Request, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	query := r.URL.Query()
+	query.Set("X-Amz-Algorithm", Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKeyID+"/"+s.Scope(now))
+	query.Set("X-Amz-Date", now.Format(TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := CanonicalRequest(r, query, []string{"host"}, UnsignedPayload)
+	query.Set("X-Amz-Signature", s.Signature(now, canonical))
+
+	u := *r.URL
+	u.RawQuery = CanonicalQuery(query)
+	return u.String()
+}
+
+// Scope is the credential scope: date/region/service/aws4_request
+func (s Signer) Scope(t time.Time) string {
+	return t.UTC().Format(dateFormat) + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+// Signature signs a canonical request made at t
+func (s Signer) Signature(t time.Time, canonicalRequest string) string {
+	t = t.UTC()
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := Algorithm + "\n" + t.Format(TimeFormat) + "\n" + s.Scope(t) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), t.Format(dateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// CanonicalRequest describes r the way both sides compute the signature.
+// headers are lowercase names; "host" is taken from r.Host.
+func CanonicalRequest(r *http.Request, query url.Values, headers []string, payloadHash string) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+			if value == "" {
+				value = r.URL.Host
+			}
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		EscapePath(r.URL.Path),
+		CanonicalQuery(query),
+		canonicalHeaders.String(),
+		strings.Join(headers, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// CanonicalQuery encodes query sorted by name and value
+func CanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escape(name, false)+"="+escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// EscapePath percent-encodes everything in path except unreserved
+// characters and "/". Requests must be sent with exactly this encoding.
+func EscapePath(path string) string {
+	return escape(path, true)
+}
+
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
@@ -0,0 +1,60 @@
+// Package storage keeps uploaded files on the local filesystem or in an
+// S3-compatible object store (AWS S3, MinIO, Ceph, Cloudflare R2).
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage stores opaque objects under slash-separated keys. Implementations
+// must be safe for concurrent use.
+type Storage interface {
+	// Put stores size bytes read from body, replacing an existing object
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open returns ErrNotFound for missing objects
+	Open(ctx context.Context, key string) (*Object, error)
+	// Delete succeeds for missing objects
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by storages that can hand out time-limited
+// download URLs, so clients fetch private files without going through the
+// application
+type Presigner interface {
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// Object is a stored file opened for reading. The caller must close it.
+type Object struct {
+	io.ReadCloser
+	Size int64
+	// Empty when the storage doesn't keep it (local filesystem)
+	ContentType string
+}
+
+// validKey accepts keys that map to the same path on every backend: ASCII
+// letters, digits, "-", "_" and "." in non-empty segments other than "." and
+// ".."
+func validKey(key string) error {
+	if key == "" || len(key) > 512 {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+				return fmt.Errorf("storage: invalid key %q", key)
+			}
+		}
+	}
+	return nil
+}
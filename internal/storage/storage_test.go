@@ -0,0 +1,122 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"lemara_blog/internal/storage"
+	"lemara_blog/internal/storage/s3test"
+)
+
+func TestLocal(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, store)
+}
+
+func TestS3(t *testing.T) {
+	server := s3test.NewServer("media")
+	defer server.Close()
+
+	store, err := storage.NewS3(storage.S3Config{
+		Endpoint:        server.URL(),
+		Region:          server.Region,
+		Bucket:          server.Bucket,
+		AccessKeyID:     server.AccessKeyID,
+		SecretAccessKey: server.SecretAccessKey,
+		PathStyle:       true,
+	}, server.Server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ping(context.Background()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	testStorage(t, store)
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "private/doc.txt", strings.NewReader("secret"), 6, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := store.PresignGet(ctx, "private/doc.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "secret" {
+		t.Fatalf("presigned GET = %d %q", resp.StatusCode, body)
+	}
+
+	// The signature covers the key
+	resp, err = http.Get(strings.Replace(signed, "doc.txt", "other.txt", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("tampered presigned GET = %d, want 403", resp.StatusCode)
+	}
+
+	wrong, err := storage.NewS3(storage.S3Config{
+		Endpoint:        server.URL(),
+		Region:          server.Region,
+		Bucket:          server.Bucket,
+		AccessKeyID:     server.AccessKeyID,
+		SecretAccessKey: "wrong",
+		PathStyle:       true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Open(ctx, "private/doc.txt"); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("open with a wrong secret: %v", err)
+	}
+}
+
+func testStorage(t *testing.T, store storage.Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Open(ctx, "a/missing.png"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("open missing: %v", err)
+	}
+
+	if err := store.Put(ctx, "a/b/file.png", strings.NewReader("content"), 7, "image/png"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	obj, err := store.Open(ctx, "a/b/file.png")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil || string(data) != "content" || obj.Size != 7 {
+		t.Fatalf("read = %q (size %d), %v", data, obj.Size, err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, ""); err == nil {
+		t.Fatal("put with .. in the key succeeded")
+	}
+
+	if err := store.Delete(ctx, "a/b/file.png"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := store.Delete(ctx, "a/b/file.png"); err != nil {
+		t.Fatalf("delete missing: %v", err)
+	}
+	if _, err := store.Open(ctx, "a/b/file.png"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("open deleted: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"lemara_blog/internal/domain"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+func init() {
+	RegisterRule("required", required)
+	RegisterRule("min", minRule)
+	RegisterRule("max", maxRule)
+	RegisterRule("len", length)
+	RegisterRule("oneof", oneOf)
+	RegisterRule("email", stringRule(isEmail, "must be a valid email address"))
+	RegisterRule("url", stringRule(isURL, "must be an absolute http(s) URL"))
+	RegisterRule("uuid", stringRule(isUUID, "must be a valid UUID"))
+	RegisterRule("slug", stringRule(slugPattern.MatchString, "must contain only lowercase letters, digits and dashes"))
+	// Usernames are case-insensitive; services store them normalized
+	RegisterRule("username", stringRule(func(s string) bool {
+		return domain.IsValidUsername(domain.NormalizeUsername(s))
+	}, "must be 3-30 letters, digits, dashes or underscores and not a reserved name"))
+	RegisterRule("scope", stringRule(domain.IsValidScope, "must be one of: "+strings.Join(domain.Scopes, ", ")))
+}
+
+func required(value reflect.Value, _ string) (bool, string) {
+	value = indirect(value)
+	if !value.IsValid() {
+		return false, "is required"
+	}
+	if value.Kind() == reflect.String {
+		return strings.TrimSpace(value.String()) != "", "is required"
+	}
+	return !isZero(value), "is required"
+}
+
+func minRule(value reflect.Value, param string) (bool, string) {
+	n, unit, ok := measure(value)
+	limit, err := strconv.ParseFloat(param, 64)
+	if !ok || err != nil {
+		return true, ""
+	}
+	if unit == "" {
+		return n >= limit, "must be at least " + param
+	}
+	return n >= limit, "must contain at least " + param + " " + unit
+}
+
+func maxRule(value reflect.Value, param string) (bool, string) {
+	n, unit, ok := measure(value)
+	limit, err := strconv.ParseFloat(param, 64)
+	if !ok || err != nil {
+		return true, ""
+	}
+	if unit == "" {
+		return n <= limit, "must be at most " + param
+	}
+	return n <= limit, "must contain at most " + param + " " + unit
+}
+
+func length(value reflect.Value, param string) (bool, string) {
+	n, unit, ok := measure(value)
+	limit, err := strconv.ParseFloat(param, 64)
+	if !ok || err != nil {
+		return true, ""
+	}
+	return n == limit, "must contain exactly " + param + " " + unit
+}
+
+func oneOf(value reflect.Value, param string) (bool, string) {
+	options := strings.Fields(param)
+	s := ""
+	switch value.Kind() {
+	case reflect.String:
+		s = value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(value.Int(), 10)
+	default:
+		return true, ""
+	}
+	for _, option := range options {
+		if s == option {
+			return true, ""
+		}
+	}
+	return false, "must be one of: " + strings.Join(options, ", ")
+}
+
+// measure returns the length of strings (in characters) and collections, or
+// the numeric value itself
+func measure(value reflect.Value) (float64, string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), "characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), "items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func stringRule(check func(string) bool, message string) Rule {
+	return func(value reflect.Value, _ string) (bool, string) {
+		if value.Kind() != reflect.String {
+			return true, ""
+		}
+		return check(value.String()), message
+	}
+}
+
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	// Reject "Name <addr>" forms, only the bare address is acceptable
+	return err == nil && addr.Address == s && strings.Contains(s[strings.LastIndex(s, "@"):], ".")
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
@@ -0,0 +1,216 @@
+// Package validation checks request structs against their `validate` tags.
+//
+// Rules are separated by commas, parameters follow "=":
+//
+//	Email string   `json:"email" validate:"required,email"`
+//	Tags  []string `json:"tags" validate:"max=10,dive,slug"`
+//
+// "omitempty" skips the remaining rules for zero values, including pointers
+// to them, and "omitnil" only for nil pointers, so that a field present in
+// the request must still satisfy them ("omitnil,required" rejects ""). "dive"
+// applies the rules after it to every element of a slice. Field names in
+// errors are taken from the json tag.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"lemara_blog/internal/domain"
+)
+
+// Rule reports whether value satisfies the rule with the given parameter.
+// It returns a human-readable message on failure.
+type Rule func(value reflect.Value, param string) (ok bool, message string)
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{}
+)
+
+// RegisterRule adds a custom rule or replaces an existing one
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule
+}
+
+func lookupRule(name string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+// Validate checks v (a struct or a pointer to one) and returns a
+// domain validation error listing every failed field, or nil.
+func Validate(v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []domain.FieldError
+	validateStruct(value, "", &fields)
+	if len(fields) > 0 {
+		return domain.Validation(fields...)
+	}
+	return nil
+}
+
+func validateStruct(value reflect.Value, prefix string, fields *[]domain.FieldError) {
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := fieldName(field)
+		if name == "" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fieldValue := value.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag != "" && tag != "-" {
+			validateValue(fieldValue, path, strings.Split(tag, ","), fields)
+		}
+
+		// Nested structs are validated with their own tags
+		nested := indirect(fieldValue)
+		if nested.IsValid() && nested.Kind() == reflect.Struct && nested.Type().PkgPath() != "time" {
+			validateStruct(nested, path, fields)
+		}
+	}
+}
+
+func validateValue(value reflect.Value, path string, tagRules []string, fields *[]domain.FieldError) {
+	for i, raw := range tagRules {
+		name, param, _ := strings.Cut(strings.TrimSpace(raw), "=")
+
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if isZero(value) {
+				return
+			}
+			continue
+		case "omitnil":
+			if value.Kind() == reflect.Pointer && value.IsNil() {
+				return
+			}
+			continue
+		case "dive":
+			elem := indirect(value)
+			if !elem.IsValid() || (elem.Kind() != reflect.Slice && elem.Kind() != reflect.Array) {
+				return
+			}
+			for j := 0; j < elem.Len(); j++ {
+				validateValue(elem.Index(j), fmt.Sprintf("%s[%d]", path, j), tagRules[i+1:], fields)
+			}
+			return
+		}
+
+		rule, ok := lookupRule(name)
+		if !ok {
+			panic(fmt.Sprintf("validation: unknown rule %q on %s", name, path))
+		}
+
+		// Nil pointers only fail "required"; other rules apply to the pointee
+		target := value
+		if name != "required" {
+			target = indirect(value)
+			if !target.IsValid() {
+				continue
+			}
+		}
+
+		if ok, message := rule(target, param); !ok {
+			*fields = append(*fields, domain.FieldError{
+				Field:   path,
+				Code:    name,
+				Message: path + " " + message,
+			})
+			// One error per field is enough: "required" failing makes the
+			// rest meaningless
+			return
+		}
+	}
+}
+
+// checkTag reports unknown rules and malformed parameters in a validate tag.
+// Validate panics on them at request time; the tests run checkTag over the
+// tags of every domain type instead.
+func checkTag(tag string) error {
+	if tag == "-" {
+		return nil
+	}
+	for _, raw := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(raw), "=")
+		switch name {
+		case "", "omitempty", "omitnil", "dive":
+			continue
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				return fmt.Errorf("rule %q needs a number, got %q", name, param)
+			}
+		case "oneof":
+			if strings.TrimSpace(param) == "" {
+				return fmt.Errorf("rule %q needs options", name)
+			}
+		}
+		if _, ok := lookupRule(name); !ok {
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// isZero looks through pointers: a pointer to "" is as empty as "" itself
+func isZero(value reflect.Value) bool {
+	value = indirect(value)
+	if !value.IsValid() {
+		return true
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}